@@ -5,19 +5,26 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/zeebo/blake3"
 	"go.uber.org/zap"
 
 	"github.com/example/qsafe/internal/platform/logging"
+	"github.com/example/qsafe/pkg/attestation"
 	"github.com/example/qsafe/pkg/crypto/kem"
 	"github.com/example/qsafe/pkg/crypto/scheduler"
 	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/audit"
 	"github.com/example/qsafe/pkg/session/policy"
 	"github.com/example/qsafe/pkg/session/replay"
 	"github.com/example/qsafe/pkg/session/rotation"
@@ -25,17 +32,39 @@ import (
 )
 
 type handshakeMetadata struct {
-	Mode            string              `json:"mode"`
-	AEAD            string              `json:"aead"`
-	Capabilities    state.CapabilitySet `json:"capabilities"`
-	KEMPublic       []byte              `json:"kem_public"`
-	SignaturePublic []byte              `json:"signature_public"`
-	RotationSeconds uint32              `json:"rotation_seconds"`
+	Mode                string              `json:"mode"`
+	Capabilities        state.CapabilitySet `json:"capabilities"`
+	KEMPublicKeys       map[string][]byte   `json:"kem_public_keys"`
+	SignaturePublicKeys map[string][]byte   `json:"signature_public_keys"`
+	RotationSeconds     uint32              `json:"rotation_seconds"`
 }
 
 type handshakeInitResponse struct {
-	ServerResponse state.ServerResponse `json:"server_response"`
+	ServerResponse state.ServerResponse     `json:"server_response"`
+	SessionID      string                   `json:"session_id"`
+	Retry          *state.HelloRetryRequest `json:"retry,omitempty"`
+}
+
+type handshakeFinishedRequest struct {
+	SessionID string                  `json:"session_id"`
+	Finished  state.HandshakeFinished `json:"finished"`
+}
+
+type handshakeFinishedResponse struct {
+	Ticket *state.NewSessionTicket `json:"ticket,omitempty"`
+}
+
+type handshakeResumeResponse struct {
+	ResumeResponse state.ResumeResponse `json:"resume_response"`
 	SessionID      string               `json:"session_id"`
+	EarlyData      *messageResponse     `json:"early_data,omitempty"`
+}
+
+// completedHandshake is satisfied by both full and resumed handshakes once finished.
+type completedHandshake interface {
+	Finished() (state.HandshakeFinished, error)
+	StoreTicket(state.NewSessionTicket) (state.ClientTicket, error)
+	Close()
 }
 
 type messageRequest struct {
@@ -47,12 +76,27 @@ type messageResponse struct {
 	Plaintext []byte    `json:"plaintext"`
 	Rotate    bool      `json:"rotate"`
 	Received  time.Time `json:"received_at"`
+	EarlyData bool      `json:"early_data,omitempty"`
+	// Rehandshake asks the agent to run a fresh KEM exchange at /rehandshake.
+	Rehandshake bool `json:"rehandshake,omitempty"`
 }
 
 func main() {
 	var (
-		gatewayURL = flag.String("gateway", "http://localhost:8443", "Gateway base URL")
-		message    = flag.String("message", "hello from agent", "Message to send after handshake")
+		gatewayURL  = flag.String("gateway", "http://localhost:8443", "Gateway base URL")
+		message     = flag.String("message", "hello from agent", "Message to send after handshake")
+		kems        = flag.String("kem", "ML-KEM-768", "Comma-separated KEM suites in preference order")
+		sigs        = flag.String("sig", "ML-DSA-65,ML-DSA-87", "Comma-separated signature schemes accepted from the gateway")
+		identity    = flag.String("identity", "", "Path to the agent signing identity (created if missing; empty for anonymous)")
+		aead        = flag.String("aead", strings.Join(state.SupportedAEADs(), ","), "Comma-separated AEAD suites in preference order")
+		attestSeed  = flag.String("attest-seed", "", "Seed for the software attestation simulator (dev only; empty disables attestation)")
+		ticketPath  = flag.String("ticket", "", "Path to a resumption ticket file, used and refreshed when the gateway issues tickets")
+		earlyData   = flag.Bool("early-data", false, "Send the message as 0-RTT data when resuming (it may be replayed; idempotent requests only)")
+		auditPath   = flag.String("audit-log", "", "Append a transcript record of each handshake to this file (check with transcript-verify)")
+		count       = flag.Int("count", 1, "Number of times to send the message over the session")
+		rekeyAfter  = flag.Uint64("rekey-packets", 1<<20, "Rekey the session after sealing this many messages in one epoch")
+		rehandshake = flag.Duration("rehandshake", 0, "Run a fresh in-session KEM exchange once session keys are this old (0 waits for the gateway to ask)")
+		sendPath    = flag.String("send-file", "", "Stream this file to the gateway over the session after the messages")
 	)
 	flag.Parse()
 
@@ -80,11 +124,25 @@ func main() {
 	}
 	logger.Info("fetched gateway metadata",
 		zap.String("mode", meta.Mode),
-		zap.String("aead", meta.AEAD),
+		zap.Strings("kems", meta.Capabilities.PQKEMs),
+		zap.Strings("aeads", meta.Capabilities.AEADs),
 	)
 
-	kemSuite := kem.NewKyber768()
-	sigScheme := sign.NewDilithium3()
+	kemOffer := strings.Split(*kems, ",")
+	aeads := strings.Split(*aead, ",")
+
+	kemSuite, kemPublic, err := selectKEM(kemOffer, meta.KEMPublicKeys)
+	if err != nil {
+		logger.Fatal("select kem", zap.Error(err))
+	}
+	verifiers, err := signatureVerifiers(strings.Split(*sigs, ","), meta.SignaturePublicKeys)
+	if err != nil {
+		logger.Fatal("select signature schemes", zap.Error(err))
+	}
+	sigOffer := make([]string, 0, len(verifiers))
+	for _, v := range verifiers {
+		sigOffer = append(sigOffer, v.Scheme.Name())
+	}
 
 	schedCfg := scheduler.Config{
 		Mode:             meta.Mode,
@@ -94,76 +152,332 @@ func main() {
 		ExporterSize:     32,
 	}
 
+	var clientIdentity *state.ClientIdentity
+	if *identity != "" {
+		clientIdentity, err = loadOrCreateIdentity(*identity, "ML-DSA-65")
+		if err != nil {
+			logger.Fatal("load identity", zap.Error(err))
+		}
+		defer clientIdentity.KeyPair.Wipe()
+		logger.Info("using agent identity",
+			zap.String("scheme", clientIdentity.Scheme.Name()),
+			zap.String("fingerprint", clientIdentity.Public().Fingerprint()),
+		)
+	}
+
+	var attester attestation.Attester
+	if *attestSeed != "" {
+		sim, err := attestation.NewSimulator([]byte(*attestSeed))
+		if err != nil {
+			logger.Fatal("attestation simulator", zap.Error(err))
+		}
+		attester = sim
+		logger.Warn("using software attestation simulator; not for production")
+	}
+
+	var auditHook func(state.HandshakeRecord)
+	if *auditPath != "" {
+		auditLog, err := audit.OpenFile(*auditPath)
+		if err != nil {
+			logger.Fatal("open audit log", zap.Error(err))
+		}
+		defer func() {
+			if err := auditLog.Close(); err != nil {
+				logger.Error("audit log", zap.Error(err))
+			}
+		}()
+		auditHook = auditLog.Record
+	}
+
 	clientState, err := state.NewClient(state.ClientConfig{
-		Mode:               meta.Mode,
-		KEMSuite:           kemSuite,
-		ServerPublicKey:    meta.KEMPublic,
-		Scheduler:          schedCfg,
-		SignatureScheme:    sigScheme,
-		ServerSignatureKey: meta.SignaturePublic,
-		Capabilities:       meta.Capabilities,
+		Mode:                meta.Mode,
+		KEMSuite:            kemSuite,
+		ServerPublicKey:     kemPublic,
+		Scheduler:           schedCfg,
+		SignatureScheme:     verifiers[0].Scheme,
+		ServerSignatureKey:  verifiers[0].PublicKey,
+		AdditionalVerifiers: verifiers[1:],
+		Capabilities: state.CapabilitySet{
+			PQKEMs:     kemOffer,
+			PQSigs:     sigOffer,
+			AEADs:      aeads,
+			Transports: []string{"http"},
+		},
+		Identity: clientIdentity,
+		Attester: attester,
+		Audit:    auditHook,
 	})
 	if err != nil {
 		logger.Fatal("client init", zap.Error(err))
 	}
 
-	initMsg, pending, err := clientState.Initiate(ctx)
-	if err != nil {
-		logger.Fatal("handshake initiate", zap.Error(err))
+	metadata := map[string]string{"intent": "demo"}
+	var (
+		sessionID string
+		keys      scheduler.Keys
+		selected  state.Selection
+		done      completedHandshake
+		msgResp   *messageResponse
+	)
+	if stored, ok, err := takeTicket(*ticketPath); err != nil {
+		logger.Warn("ignoring unreadable ticket", zap.Error(err))
+	} else if ok {
+		var early []byte
+		if *earlyData && stored.EarlyData {
+			early = []byte(*message)
+		}
+		result, resumedKeys, resumed, err := resumeSession(ctx, client, *gatewayURL, clientState, stored, early, metadata)
+		if err != nil {
+			logger.Warn("resumption failed; falling back to full handshake", zap.Error(err))
+		} else {
+			sessionID, keys, selected, done = result.SessionID, resumedKeys, stored.Selected, resumed
+			if early != nil && resumed.EarlyDataAccepted() {
+				msgResp = result.EarlyData
+			}
+			logger.Info("session resumed", zap.Bool("early_data", msgResp != nil))
+		}
 	}
 
-	resp, err := sendHandshake(client, *gatewayURL, initMsg)
-	if err != nil {
-		logger.Fatal("handshake exchange", zap.Error(err))
+	if done == nil {
+		initMsg, pending, err := clientState.Initiate(ctx)
+		if err != nil {
+			logger.Fatal("handshake initiate", zap.Error(err))
+		}
+
+		resp, err := sendHandshake(client, *gatewayURL, initMsg)
+		if err != nil {
+			fatalHandshake(logger, "handshake exchange", err)
+		}
+
+		keys, err = pending.Finish(ctx, resp.ServerResponse)
+		if errors.Is(err, state.ErrDowngrade) {
+			logger.Fatal("handshake downgrade detected; refusing session", zap.Error(err))
+		}
+		if err != nil {
+			logger.Fatal("handshake finish", zap.Error(err))
+		}
+		sessionID, selected, done = resp.SessionID, resp.ServerResponse.Payload.Selected, pending
 	}
 
-	keys, err := pending.Finish(ctx, resp.ServerResponse)
+	finished, err := done.Finished()
+	if err != nil {
+		logger.Fatal("handshake finished", zap.Error(err))
+	}
+	nst, err := sendFinished(client, *gatewayURL, sessionID, finished)
 	if err != nil {
-		logger.Fatal("handshake finish", zap.Error(err))
+		fatalHandshake(logger, "handshake finished exchange", err)
+	}
+	if nst != nil && *ticketPath != "" {
+		stored, err := done.StoreTicket(*nst)
+		if err == nil {
+			err = saveTicket(*ticketPath, stored)
+		}
+		if err != nil {
+			logger.Warn("store ticket", zap.Error(err))
+		}
 	}
 
 	policyEnforcer := policy.New(policy.Config{
 		AllowedModes: []string{meta.Mode},
-		AllowedAEAD:  []string{meta.AEAD},
+		AllowedAEAD:  aeads,
 		MinRotation:  time.Minute,
 		MaxRotation:  2 * time.Hour,
 	})
 
+	var signer *state.SignatureCredential
+	if clientIdentity != nil {
+		signer = &state.SignatureCredential{Scheme: clientIdentity.Scheme, KeyPair: clientIdentity.KeyPair}
+	}
+	var serverVerifier *state.SignatureVerifier
+	for i := range verifiers {
+		if verifiers[i].Scheme.Name() == selected.PQSig {
+			serverVerifier = &verifiers[i]
+		}
+	}
 	session, err := state.NewSession(state.SessionConfig{
-		Role:     state.RoleClient,
-		Mode:     meta.Mode,
-		AEAD:     meta.AEAD,
-		Keys:     keys,
-		Rotation: rotation.Config{Interval: time.Duration(meta.RotationSeconds) * time.Second, MaxPackets: 1 << 20, Skew: 10 * time.Second},
-		Replay:   replay.Config{Depth: 4096},
-		Policy:   policyEnforcer,
-		Epoch:    1,
+		Role: state.RoleClient,
+		Mode: meta.Mode,
+		AEAD: selected.AEAD,
+		KEM:  selected.PQKEM,
+		Keys: keys,
+		Rotation: rotation.Config{
+			Interval:    time.Duration(meta.RotationSeconds) * time.Second,
+			MaxPackets:  *rekeyAfter,
+			Skew:        10 * time.Second,
+			Rehandshake: *rehandshake,
+		},
+		Replay:       replay.Config{Depth: 4096},
+		Policy:       policyEnforcer,
+		Epoch:        state.InitialEpoch,
+		Signer:       signer,
+		PeerVerifier: serverVerifier,
 	})
 	if err != nil {
 		logger.Fatal("session setup", zap.Error(err))
 	}
+	// The session holds its own copy of the keys; the handshake's are no longer needed.
+	keys.Wipe()
+	done.Close()
 
-	env, rotate, err := session.Encrypt(ctx, []byte(*message), map[string]string{"intent": "demo"})
-	if err != nil {
-		logger.Fatal("encrypt", zap.Error(err))
+	// Early data, when accepted, already delivered the first message.
+	sent := 0
+	if msgResp != nil {
+		sent = 1
 	}
-	logger.Info("message sealed",
-		zap.String("session_id", hex.EncodeToString(session.SessionID())),
-		zap.Bool("rotate_suggested", rotate),
-	)
+	for ; sent < *count; sent++ {
+		env, rotate, err := session.Encrypt(ctx, []byte(*message), metadata)
+		if err != nil {
+			logger.Fatal("encrypt", zap.Error(err))
+		}
+		logger.Info("message sealed",
+			zap.String("session_id", hex.EncodeToString(session.SessionID())),
+			zap.Uint64("epoch", env.Epoch),
+			zap.Bool("rotate_suggested", rotate),
+		)
 
-	msgResp, err := sendMessage(client, *gatewayURL, resp.SessionID, env)
-	if err != nil {
-		logger.Fatal("send message", zap.Error(err))
+		resp, err := sendMessage(client, *gatewayURL, sessionID, env)
+		if err != nil {
+			logger.Fatal("send message", zap.Error(err))
+		}
+		msgResp = &resp
+
+		switch {
+		case resp.Rehandshake || session.RehandshakeDue():
+			epoch, err := rehandshakeSession(client, *gatewayURL, sessionID, session)
+			if err != nil {
+				fatalHandshake(logger, "rehandshake", err)
+			}
+			logger.Info("session re-handshaked", zap.Uint64("epoch", epoch))
+		case rotate || resp.Rotate:
+			epoch, err := rekeySession(client, *gatewayURL, sessionID, session)
+			if err != nil {
+				logger.Fatal("rekey", zap.Error(err))
+			}
+			logger.Info("session rekeyed", zap.Uint64("epoch", epoch))
+		}
+	}
+
+	if *sendPath != "" {
+		resp, err := sendFile(ctx, *gatewayURL, sessionID, session, *sendPath)
+		if err != nil {
+			logger.Fatal("send file", zap.Error(err))
+		}
+		logger.Info("file sent",
+			zap.String("stream_id", resp.StreamID),
+			zap.String("name", resp.Name),
+			zap.Int64("bytes", resp.Bytes),
+			zap.String("blake3", resp.BLAKE3),
+		)
+	}
+
+	if err := closeSession(ctx, client, *gatewayURL, sessionID, session); err != nil {
+		logger.Warn("close session", zap.Error(err))
 	}
 
 	logger.Info("gateway response",
 		zap.Int("plaintext_bytes", len(msgResp.Plaintext)),
 		zap.Bool("rotate", msgResp.Rotate),
+		zap.Bool("early_data", msgResp.EarlyData),
 	)
 	fmt.Printf("Gateway responded: %s (rotate=%v)\n", string(msgResp.Plaintext), msgResp.Rotate)
 }
 
+// fatalHandshake exits with the gateway's alert, including its remediation hint, when
+// the failure was a rejection rather than a transport error.
+func fatalHandshake(logger *zap.Logger, msg string, err error) {
+	var alert state.Alert
+	if errors.As(err, &alert) {
+		logger.Fatal(msg+" rejected by gateway",
+			zap.String("code", string(alert.Code)),
+			zap.Stringer("severity", alert.Severity),
+			zap.String("reason", alert.Reason),
+			zap.String("hint", alert.RemediationHint),
+		)
+	}
+	logger.Fatal(msg, zap.Error(err))
+}
+
+// selectKEM picks the first locally preferred suite the gateway publishes a key for.
+func selectKEM(offer []string, published map[string][]byte) (kem.Suite, []byte, error) {
+	for _, name := range offer {
+		public, ok := published[name]
+		if !ok {
+			continue
+		}
+		suite, err := kem.Lookup(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return suite, public, nil
+	}
+	return nil, nil, fmt.Errorf("gateway offers none of %v", offer)
+}
+
+// signatureVerifiers keeps the locally accepted schemes the gateway publishes a key for.
+func signatureVerifiers(accepted []string, published map[string][]byte) ([]state.SignatureVerifier, error) {
+	var out []state.SignatureVerifier
+	for _, name := range accepted {
+		public, ok := published[name]
+		if !ok {
+			continue
+		}
+		scheme, err := sign.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, state.SignatureVerifier{Scheme: scheme, PublicKey: public})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("gateway offers none of %v", accepted)
+	}
+	return out, nil
+}
+
+type identityFile struct {
+	Scheme  string `json:"scheme"`
+	Public  []byte `json:"public"`
+	Private []byte `json:"private"`
+}
+
+// loadOrCreateIdentity reads the agent signing key from path, generating one on first use.
+func loadOrCreateIdentity(path, defaultScheme string) (*state.ClientIdentity, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var stored identityFile
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("parse identity %s: %w", path, err)
+		}
+		scheme, err := sign.Lookup(stored.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		return &state.ClientIdentity{
+			Scheme:  scheme,
+			KeyPair: sign.KeyPair{Public: stored.Public, Private: stored.Private},
+		}, nil
+	case os.IsNotExist(err):
+		scheme, err := sign.Lookup(defaultScheme)
+		if err != nil {
+			return nil, err
+		}
+		keyPair, err := scheme.GenerateKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(identityFile{Scheme: scheme.Name(), Public: keyPair.Public, Private: keyPair.Private})
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, encoded, 0o600); err != nil {
+			return nil, fmt.Errorf("write identity %s: %w", path, err)
+		}
+		return &state.ClientIdentity{Scheme: scheme, KeyPair: keyPair}, nil
+	default:
+		return nil, fmt.Errorf("read identity %s: %w", path, err)
+	}
+}
+
 func fetchMetadata(client *http.Client, baseURL string) (handshakeMetadata, error) {
 	req, err := http.NewRequest(http.MethodGet, baseURL+"/handshake/config", nil)
 	if err != nil {
@@ -185,31 +499,251 @@ func fetchMetadata(client *http.Client, baseURL string) (handshakeMetadata, erro
 	return meta, nil
 }
 
+// sendHandshake posts the init, resending it once with the cookie if the gateway asks
+// for a retry.
 func sendHandshake(client *http.Client, baseURL string, initMsg *state.ClientInit) (handshakeInitResponse, error) {
+	msg := *initMsg
+	for attempt := 0; attempt < 2; attempt++ {
+		var result handshakeInitResponse
+		if err := postJSON(client, baseURL+"/handshake/init", msg, &result); err != nil {
+			return handshakeInitResponse{}, fmt.Errorf("handshake %w", err)
+		}
+		if result.Retry == nil {
+			return result, nil
+		}
+		msg = msg.Retry(*result.Retry)
+	}
+	return handshakeInitResponse{}, errors.New("handshake: gateway requested a second retry")
+}
+
+// sendFinished confirms the handshake and returns the resumption ticket, if one was issued.
+func sendFinished(client *http.Client, baseURL, sessionID string, fin state.HandshakeFinished) (*state.NewSessionTicket, error) {
+	var result handshakeFinishedResponse
+	if err := postJSON(client, baseURL+"/handshake/finished", handshakeFinishedRequest{SessionID: sessionID, Finished: fin}, &result); err != nil {
+		return nil, fmt.Errorf("finished %w", err)
+	}
+	return result.Ticket, nil
+}
+
+// resumeSession runs the abbreviated handshake from a stored ticket, carrying early as
+// 0-RTT data when it is non-nil.
+func resumeSession(ctx context.Context, client *http.Client, baseURL string, c *state.Client, t state.ClientTicket, early []byte, metadata map[string]string) (handshakeResumeResponse, scheduler.Keys, *state.PendingResumption, error) {
+	var (
+		init    *state.ResumeInit
+		pending *state.PendingResumption
+		err     error
+	)
+	if early != nil {
+		init, pending, err = c.ResumeWithEarlyData(ctx, t, early, metadata)
+	} else {
+		init, pending, err = c.Resume(ctx, t)
+	}
+	if err != nil {
+		return handshakeResumeResponse{}, scheduler.Keys{}, nil, err
+	}
+	var result handshakeResumeResponse
+	if err := postJSON(client, baseURL+"/handshake/resume", init, &result); err != nil {
+		pending.Close()
+		return handshakeResumeResponse{}, scheduler.Keys{}, nil, fmt.Errorf("resume %w", err)
+	}
+	keys, err := pending.Finish(ctx, result.ResumeResponse)
+	if err != nil {
+		pending.Close()
+		return handshakeResumeResponse{}, scheduler.Keys{}, nil, err
+	}
+	return result, keys, pending, nil
+}
+
+// takeTicket loads and deletes the stored ticket; tickets are single-use either way.
+func takeTicket(path string) (state.ClientTicket, bool, error) {
+	if path == "" {
+		return state.ClientTicket{}, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state.ClientTicket{}, false, nil
+	}
+	if err != nil {
+		return state.ClientTicket{}, false, err
+	}
+	if err := os.Remove(path); err != nil {
+		return state.ClientTicket{}, false, err
+	}
+	var t state.ClientTicket
+	if err := json.Unmarshal(data, &t); err != nil {
+		return state.ClientTicket{}, false, fmt.Errorf("parse ticket %s: %w", path, err)
+	}
+	return t, true, nil
+}
+
+func saveTicket(path string, t state.ClientTicket) error {
+	encoded, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, encoded, 0o600); err != nil {
+		return fmt.Errorf("write ticket %s: %w", path, err)
+	}
+	return nil
+}
+
+func postJSON(client *http.Client, url string, in, out any) error {
 	buf := new(bytes.Buffer)
-	if err := json.NewEncoder(buf).Encode(initMsg); err != nil {
-		return handshakeInitResponse{}, err
+	if err := json.NewEncoder(buf).Encode(in); err != nil {
+		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, baseURL+"/handshake/init", buf)
+	req, err := http.NewRequest(http.MethodPost, url, buf)
 	if err != nil {
-		return handshakeInitResponse{}, err
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := client.Do(req)
 	if err != nil {
-		return handshakeInitResponse{}, err
+		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return handshakeInitResponse{}, fmt.Errorf("handshake status %d: %s", resp.StatusCode, string(body))
+		return statusError(resp)
 	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
 
-	var result handshakeInitResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return handshakeInitResponse{}, err
+type alertResponse struct {
+	Alert state.Alert `json:"alert"`
+}
+
+// statusError turns a failed response into an error, preserving a gateway alert so
+// callers can match it with errors.As.
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	var rejected alertResponse
+	if json.Unmarshal(body, &rejected) == nil && rejected.Alert.Code != "" {
+		return fmt.Errorf("status %d: %w", resp.StatusCode, rejected.Alert)
 	}
-	return result, nil
+	return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+}
+
+type rekeyRequest struct {
+	SessionID string            `json:"session_id"`
+	Notice    state.RekeyNotice `json:"notice"`
+}
+
+// rekeySession moves the session's sending direction to the next epoch and announces it
+// to the gateway, returning the new epoch. The gateway must accept the notice before any
+// envelope from the new epoch can be opened.
+func rekeySession(client *http.Client, baseURL, sessionID string, session *state.Session) (uint64, error) {
+	notice, err := session.Rekey()
+	if err != nil {
+		return 0, err
+	}
+	if err := postJSON(client, baseURL+"/rekey", rekeyRequest{SessionID: sessionID, Notice: notice}, &struct{}{}); err != nil {
+		return 0, err
+	}
+	return notice.NextEpoch, nil
+}
+
+type rehandshakeRequest struct {
+	SessionID string                `json:"session_id"`
+	Init      state.RehandshakeInit `json:"init"`
+}
+
+// rehandshakeSession runs a fresh KEM exchange with the gateway inside the session and
+// switches to the resulting keys, returning the new epoch.
+func rehandshakeSession(client *http.Client, baseURL, sessionID string, session *state.Session) (uint64, error) {
+	init, pending, err := session.Rehandshake()
+	if err != nil {
+		return 0, err
+	}
+	defer pending.Close()
+	var resp state.RehandshakeResponse
+	if err := postJSON(client, baseURL+"/rehandshake", rehandshakeRequest{SessionID: sessionID, Init: *init}, &resp); err != nil {
+		return 0, err
+	}
+	if err := pending.Finish(resp); err != nil {
+		return 0, err
+	}
+	return init.Epoch, nil
+}
+
+// closeSession asks the gateway to drop the session, authenticating the request with an
+// envelope sealed under it, and then wipes the local keys.
+func closeSession(ctx context.Context, client *http.Client, baseURL, sessionID string, session *state.Session) error {
+	defer session.Close()
+	env, _, err := session.Encrypt(ctx, nil, map[string]string{"intent": "close"})
+	if err != nil {
+		return err
+	}
+	return postJSON(client, baseURL+"/close", messageRequest{SessionID: sessionID, Envelope: env}, &struct{}{})
+}
+
+type streamResponse struct {
+	StreamID    string `json:"stream_id"`
+	Name        string `json:"name,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	BLAKE3      string `json:"blake3"`
+	Rotate      bool   `json:"rotate"`
+	Rehandshake bool   `json:"rehandshake,omitempty"`
+}
+
+// sendFile streams the file at path to the gateway's /stream endpoint as sealed chunks,
+// without holding more than one chunk in memory, and checks that the gateway received
+// exactly what was read.
+func sendFile(ctx context.Context, baseURL, sessionID string, session *state.Session, path string) (streamResponse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return streamResponse{}, err
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	hasher := blake3.New()
+	var sent int64
+	done := make(chan error, 1)
+	go func() {
+		enc := json.NewEncoder(pw)
+		stream, err := session.NewStreamWriter(ctx, func(env state.Envelope) error {
+			return enc.Encode(env)
+		}, state.StreamConfig{Metadata: map[string]string{"name": filepath.Base(path)}})
+		if err == nil {
+			sent, err = io.Copy(stream, io.TeeReader(f, hasher))
+			if cerr := stream.Close(); err == nil {
+				err = cerr
+			}
+		}
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/stream?session_id="+url.QueryEscape(sessionID), pr)
+	if err != nil {
+		_ = pr.CloseWithError(err)
+		return streamResponse{}, errors.Join(err, <-done)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	// No overall client timeout: the request lasts as long as the file takes to send.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		_ = pr.CloseWithError(err)
+		return streamResponse{}, errors.Join(err, <-done)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// The gateway may answer before reading the whole body; stop the writer.
+		_ = pr.CloseWithError(errors.New("stream rejected"))
+		<-done
+		return streamResponse{}, statusError(resp)
+	}
+	if err := <-done; err != nil {
+		return streamResponse{}, err
+	}
+	var out streamResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return streamResponse{}, err
+	}
+	if digest := hex.EncodeToString(hasher.Sum(nil)); out.Bytes != sent || out.BLAKE3 != digest {
+		return out, fmt.Errorf("gateway received %d bytes (blake3 %s), sent %d (blake3 %s)", out.Bytes, out.BLAKE3, sent, digest)
+	}
+	return out, nil
 }
 
 func sendMessage(client *http.Client, baseURL, sessionID string, env state.Envelope) (messageResponse, error) {
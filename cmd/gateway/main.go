@@ -2,24 +2,58 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/example/qsafe/internal/platform/logging"
+	"github.com/example/qsafe/pkg/attestation"
+	"github.com/example/qsafe/pkg/session/audit"
+	"github.com/example/qsafe/pkg/session/replay"
+	"github.com/example/qsafe/pkg/session/state"
 )
 
 func main() {
 	var (
 		addr        = flag.String("addr", ":8443", "HTTP listen address")
 		mode        = flag.String("mode", "strict", "PQ mode (strict|hybrid)")
-		aead        = flag.String("aead", "xchacha20poly1305", "AEAD suite")
+		kems        = flag.String("kem", "ML-KEM-768,ML-KEM-1024", "Comma-separated KEM suites in preference order")
+		sigs        = flag.String("sig", "ML-DSA-65,ML-DSA-87", "Comma-separated signature schemes in preference order")
+		aead        = flag.String("aead", strings.Join(state.SupportedAEADs(), ","), "Comma-separated AEAD suites in preference order (aes256gcm only for FIPS deployments)")
+		clientAuth  = flag.Bool("require-client-auth", false, "Reject agents that do not present a signing identity")
+		allowed     = flag.String("authorized-clients", "", "Comma-separated client identity fingerprints allowed to connect (empty allows any)")
 		rotationSec = flag.Uint("rotation", 300, "Session rotation interval in seconds")
+		attestPol   = flag.String("attestation-policy", "", "Path to a JSON attestation policy; agents must present passing evidence")
+		attestSeed  = flag.String("attestation-sim-seed", "", "Trust the software attestation simulator derived from this seed (dev only)")
+		clockSkew   = flag.Duration("max-clock-skew", 30*time.Second, "Maximum accepted drift of agent handshake timestamps")
+		replaySize  = flag.Int("replay-cache-size", 65536, "Number of recent handshakes remembered for replay detection")
+		finTimeout  = flag.Duration("finished-timeout", 10*time.Second, "How long an accepted handshake waits for the agent's Finished message")
+		maxPending  = flag.Int("max-pending", 4096, "Accepted handshakes that may await their Finished message at once; further handshakes are refused")
+		idleTimeout = flag.Duration("session-idle-timeout", 30*time.Minute, "Close sessions, wiping their keys, after this long without traffic")
+		resumption  = flag.Bool("resumption", false, "Issue session resumption tickets after confirmed handshakes")
+		ticketLife  = flag.Duration("ticket-lifetime", time.Hour, "Maximum age of a resumption ticket (at most 24h)")
+		ticketRot   = flag.Duration("ticket-key-rotation", 0, "Ticket sealing key rotation interval (defaults to the ticket lifetime)")
+		strictResum = flag.Bool("allow-strict-resumption", false, "Permit ticket resumption in strict mode (resumed sessions skip the PQ KEM)")
+		earlyData   = flag.Bool("early-data", false, "Accept one replayable 0-RTT message with each resumption")
+		maxEarly    = flag.Int("max-early-data", 16<<10, "Maximum size in bytes of accepted 0-RTT data")
+		retryCookie = flag.String("retry-cookies", "load", "When to demand a stateless retry cookie before handshake work: off, load, always")
+		cookieLoad  = flag.Int("cookie-threshold", 32, "Concurrent handshakes at which retry cookies are demanded in load mode")
+		auditPath   = flag.String("audit-log", "", "Append a transcript record of every handshake and resumption to this file")
+		rehandshake = flag.Duration("rehandshake-interval", 0, "Ask agents for a fresh in-session KEM exchange once session keys are this old (0 disables)")
+		streamDir   = flag.String("stream-dir", "", "Store files agents stream to /stream in this directory (empty verifies and discards them)")
+		replayStore = flag.String("replay-store", "", "Persist session replay windows: file:<path> or kv:<url> (empty keeps them in memory)")
+		sessState   = flag.String("session-state", "", "Drain sessions to this file on shutdown and reload them at startup")
+		sessKey     = flag.String("session-state-key", "", "File holding the hex-encoded 32-byte key that seals --session-state")
 	)
 	flag.Parse()
 
@@ -37,12 +71,73 @@ func main() {
 		_ = cleanup(ctx)
 	}()
 
+	verifier, err := attestationVerifier(*attestPol, *attestSeed)
+	if err != nil {
+		logger.Fatal("init attestation", zap.Error(err))
+	}
+
+	var auditHook func(state.HandshakeRecord)
+	if *auditPath != "" {
+		auditLog, err := audit.OpenFile(*auditPath)
+		if err != nil {
+			logger.Fatal("open audit log", zap.Error(err))
+		}
+		defer func() {
+			if err := auditLog.Close(); err != nil {
+				logger.Error("audit log", zap.Error(err))
+			}
+		}()
+		auditHook = auditLog.Record
+	}
+
+	stateKey, err := readSessionStateKey(*sessKey)
+	if err != nil {
+		logger.Fatal("read session state key", zap.Error(err))
+	}
+
+	windows, closeWindows, err := openReplayStore(*replayStore)
+	if err != nil {
+		logger.Fatal("open replay store", zap.Error(err))
+	}
+	defer func() {
+		if err := closeWindows(); err != nil {
+			logger.Error("replay store", zap.Error(err))
+		}
+	}()
+
 	srv, err := NewGatewayServer(GatewayConfig{
 		Address:  *addr,
 		Mode:     *mode,
-		AEAD:     *aead,
+		KEMs:     strings.Split(*kems, ","),
+		Sigs:     strings.Split(*sigs, ","),
+		AEADs:    strings.Split(*aead, ","),
 		Rotation: time.Duration(*rotationSec) * time.Second,
 		Logger:   logger,
+
+		Rehandshake: *rehandshake,
+
+		RequireClientAuth:  *clientAuth,
+		AuthorizedClients:  splitNonEmpty(*allowed),
+		Attestation:        verifier,
+		MaxClockSkew:       *clockSkew,
+		ReplayCacheSize:    *replaySize,
+		FinishedTimeout:    *finTimeout,
+		MaxPending:         *maxPending,
+		SessionIdleTimeout: *idleTimeout,
+
+		Resumption:            *resumption,
+		TicketLifetime:        *ticketLife,
+		TicketKeyRotation:     *ticketRot,
+		AllowStrictResumption: *strictResum,
+		EarlyData:             *earlyData,
+		MaxEarlyData:          *maxEarly,
+		RetryCookies:          *retryCookie,
+		CookieThreshold:       *cookieLoad,
+		Audit:                 auditHook,
+		StreamDir:             *streamDir,
+		ReplayStore:           windows,
+		SessionState:          *sessState,
+		SessionStateKey:       stateKey,
 	})
 	if err != nil {
 		logger.Fatal("init gateway", zap.Error(err))
@@ -74,3 +169,74 @@ func main() {
 	}
 	logger.Info("gateway stopped")
 }
+
+// readSessionStateKey loads the hex-encoded session state key from path, if one is given.
+func readSessionStateKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
+// openReplayStore builds the replay window store selected by spec, or nil for in-memory
+// windows, along with a function releasing it.
+func openReplayStore(spec string) (replay.Store, func() error, error) {
+	noop := func() error { return nil }
+	kind, target, _ := strings.Cut(spec, ":")
+	switch {
+	case spec == "":
+		return nil, noop, nil
+	case kind == "file" && target != "":
+		store, err := replay.OpenFileStore(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case kind == "kv" && target != "":
+		store, err := replay.NewKVStore(replay.KVConfig{URL: target})
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, noop, nil
+	default:
+		return nil, nil, fmt.Errorf("replay-store %q: want file:<path> or kv:<url>", spec)
+	}
+}
+
+// attestationVerifier builds the verifier selected by flags, or nil when attestation is off.
+func attestationVerifier(policyPath, simSeed string) (attestation.Verifier, error) {
+	var p attestation.Policy
+	switch {
+	case policyPath != "" && simSeed != "":
+		return nil, errors.New("attestation-policy and attestation-sim-seed are mutually exclusive")
+	case policyPath != "":
+		loaded, err := attestation.LoadPolicyFile(policyPath)
+		if err != nil {
+			return nil, err
+		}
+		p = loaded
+	case simSeed != "":
+		sim, err := attestation.NewSimulator([]byte(simSeed))
+		if err != nil {
+			return nil, err
+		}
+		p = sim.Policy()
+	default:
+		return nil, nil
+	}
+	return attestation.NewVerifier(p)
+}
+
+func splitNonEmpty(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -1,35 +1,132 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"container/list"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/zeebo/blake3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 
+	"github.com/example/qsafe/internal/platform/metrics"
+	"github.com/example/qsafe/pkg/attestation"
 	"github.com/example/qsafe/pkg/crypto/kem"
 	"github.com/example/qsafe/pkg/crypto/scheduler"
 	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/cookie"
 	"github.com/example/qsafe/pkg/session/policy"
 	"github.com/example/qsafe/pkg/session/replay"
 	"github.com/example/qsafe/pkg/session/rotation"
 	"github.com/example/qsafe/pkg/session/state"
+	"github.com/example/qsafe/pkg/session/ticket"
 )
 
 // GatewayConfig wires runtime parameters for the gateway server.
 type GatewayConfig struct {
 	Address  string
 	Mode     string
-	AEAD     string
+	KEMs     []string
+	Sigs     []string
+	AEADs    []string
 	Rotation time.Duration
 	Logger   *zap.Logger
+	// Rehandshake, when non-zero, asks agents to run a fresh in-session KEM exchange once
+	// a session's keys are this old.
+	Rehandshake time.Duration
+
+	// RequireClientAuth rejects anonymous agents; AuthorizedClients, when non-empty,
+	// restricts access to the listed identity fingerprints.
+	RequireClientAuth bool
+	AuthorizedClients []string
+	// Attestation, when set, must accept agent evidence before session keys are derived.
+	Attestation attestation.Verifier
+	// MaxClockSkew bounds ClientInit timestamp drift; ReplayCacheSize bounds how many
+	// recent handshakes are remembered for replay detection. Once that many arrive
+	// within twice the skew, further inits are refused until entries expire.
+	MaxClockSkew    time.Duration
+	ReplayCacheSize int
+	// FinishedTimeout is how long a session may wait for the client Finished message
+	// before it is discarded; at most MaxPending sessions wait at once, and further
+	// handshakes are refused until one is confirmed or expires. SessionIdleTimeout
+	// closes, and wipes the keys of, confirmed sessions that carry no traffic for that
+	// long; it defaults to 30 minutes.
+	FinishedTimeout    time.Duration
+	MaxPending         int
+	SessionIdleTimeout time.Duration
+	// Resumption enables session tickets with the given lifetime and ticket key rotation
+	// interval. AllowStrictResumption must also be set for tickets in strict mode.
+	Resumption            bool
+	TicketLifetime        time.Duration
+	TicketKeyRotation     time.Duration
+	AllowStrictResumption bool
+	// EarlyData lets resumed agents send one message of at most MaxEarlyData bytes with
+	// the ResumeInit. Such messages can be replayed and are only suitable for idempotent
+	// requests.
+	EarlyData    bool
+	MaxEarlyData int
+	// RetryCookies selects when /handshake/init answers with a stateless retry cookie
+	// instead of doing KEM and signature work: "off", "load" (once CookieThreshold
+	// handshakes are being processed concurrently) or "always". Defaults to "load".
+	RetryCookies    string
+	CookieThreshold int
+	// Audit, when set, receives a transcript record for every handshake and resumption
+	// the gateway processes, successful or not.
+	Audit func(state.HandshakeRecord)
+	// StreamDir, when set, is where files streamed to /stream are stored, named by
+	// session ID and stream ID. A stored file is never replaced. Without it the gateway
+	// verifies and hashes streams but keeps nothing.
+	StreamDir string
+	// ReplayStore, when set, persists the receive replay windows of sessions so that a
+	// session rebuilt after a restart, or on another replica, refuses envelopes already
+	// accepted. Without it windows live in memory only.
+	ReplayStore replay.Store
+	// SessionState, when set, is the file that Stop drains confirmed sessions to and
+	// NewGatewayServer reloads them from, sealed under SessionStateKey, so a restart does
+	// not force every agent to re-handshake. The file is removed once loaded.
+	SessionState    string
+	SessionStateKey []byte
+}
+
+// sessionStateFile is the on-disk form of drained sessions.
+type sessionStateFile struct {
+	Sessions [][]byte `json:"sessions"`
 }
 
+// errStreamExists is returned when a stream's file has already been stored. Stream IDs
+// are random, so this is a stream sent twice.
+var errStreamExists = fmt.Errorf("gateway: stream already stored: %w", replay.ErrDuplicate)
+
+// errEnvelopeTooLarge is returned for a stream line longer than streamEnvelopeLimit.
+var errEnvelopeTooLarge = fmt.Errorf("%w: stream envelope too large", state.ErrDecode)
+
+// errPendingFull is returned when MaxPending handshakes are already awaiting Finished.
+var errPendingFull = errors.New("gateway: too many handshakes awaiting Finished")
+
+// streamEnvelopeLimit bounds one line of a stream body: a default-size chunk in base64,
+// plus room for the nonce, metadata and JSON framing. Chunks are also checked against
+// the default size once decoded.
+const streamEnvelopeLimit = state.DefaultStreamChunkSize*4/3 + 16<<10
+
+// streamChunkTimeout bounds the wait for each envelope of a stream, in place of the
+// server's whole-request timeouts, which a large stream would exceed.
+const streamChunkTimeout = 30 * time.Second
+
 // GatewayServer hosts the HTTP interface for handshake negotiation and messaging.
 type GatewayServer struct {
 	cfg     GatewayConfig
@@ -38,6 +135,9 @@ type GatewayServer struct {
 
 	kemSuite  kem.Suite
 	sigScheme sign.Scheme
+	// signers holds the gateway's credential for each signature scheme, used to sign
+	// in-session re-handshakes under the scheme the handshake selected.
+	signers map[string]*state.SignatureCredential
 
 	serverState *state.Server
 
@@ -48,8 +148,43 @@ type GatewayServer struct {
 
 	capabilities state.CapabilitySet
 
-	sessions map[string]*state.Session
-	mu       sync.RWMutex
+	handshakeRejects metric.Int64Counter
+	handshakeRetries metric.Int64Counter
+
+	cookies  *cookie.Issuer
+	inFlight atomic.Int64
+
+	sessions map[string]*liveSession
+	// pending indexes pendingOrder, which holds *pendingSession in insertion order. All
+	// share FinishedTimeout, so that is also expiry order.
+	pending      map[string]*list.Element
+	pendingOrder *list.List
+	mu           sync.RWMutex
+}
+
+// liveSession is a confirmed session and when it last carried traffic, in Unix
+// nanoseconds.
+type liveSession struct {
+	session  *state.Session
+	lastSeen atomic.Int64
+}
+
+// pendingSession holds a handshake that has been accepted but not yet confirmed by the
+// client Finished message; it carries no traffic until promoted to sessions.
+type pendingSession struct {
+	id             string
+	session        *state.Session
+	keys           scheduler.Keys
+	transcriptHash []byte
+	selected       state.Selection
+	resumed        bool
+	expires        time.Time
+}
+
+// discard wipes a pending handshake that will never be promoted.
+func (p *pendingSession) discard() {
+	_ = p.session.Close()
+	p.keys.Wipe()
 }
 
 // NewGatewayServer constructs the gateway and prepares HTTP handlers.
@@ -63,23 +198,67 @@ func NewGatewayServer(cfg GatewayConfig) (*GatewayServer, error) {
 	if cfg.Mode == "" {
 		cfg.Mode = "strict"
 	}
-	if cfg.AEAD == "" {
-		cfg.AEAD = "xchacha20poly1305"
+	if len(cfg.KEMs) == 0 {
+		cfg.KEMs = []string{"ML-KEM-768"}
+	}
+	if len(cfg.Sigs) == 0 {
+		cfg.Sigs = []string{"ML-DSA-65"}
+	}
+	if len(cfg.AEADs) == 0 {
+		cfg.AEADs = state.SupportedAEADs()
 	}
 	if cfg.Rotation <= 0 {
 		cfg.Rotation = 5 * time.Minute
 	}
+	if cfg.MaxClockSkew <= 0 {
+		cfg.MaxClockSkew = 30 * time.Second
+	}
+	if cfg.FinishedTimeout <= 0 {
+		cfg.FinishedTimeout = 10 * time.Second
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 4096
+	}
+	if cfg.SessionIdleTimeout <= 0 {
+		cfg.SessionIdleTimeout = 30 * time.Minute
+	}
+	if cfg.RetryCookies == "" {
+		cfg.RetryCookies = "load"
+	}
+	if cfg.CookieThreshold <= 0 {
+		cfg.CookieThreshold = 32
+	}
 
-	kemSuite := kem.NewKyber768()
-	kemKeyPair, err := kemSuite.GenerateKeyPair()
-	if err != nil {
-		return nil, fmt.Errorf("gateway: generate KEM keypair: %w", err)
+	kemCreds := make([]state.KEMCredential, 0, len(cfg.KEMs))
+	for _, name := range cfg.KEMs {
+		suite, err := kem.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("gateway: %w", err)
+		}
+		keyPair, err := suite.GenerateKeyPair()
+		if err != nil {
+			return nil, fmt.Errorf("gateway: generate %s keypair: %w", name, err)
+		}
+		kemCreds = append(kemCreds, state.KEMCredential{Suite: suite, KeyPair: keyPair})
 	}
+	kemSuite := kemCreds[0].Suite
 
-	sigScheme := sign.NewDilithium3()
-	sigKeyPair, err := sigScheme.GenerateKeyPair()
-	if err != nil {
-		return nil, fmt.Errorf("gateway: generate signature keypair: %w", err)
+	sigCreds := make([]state.SignatureCredential, 0, len(cfg.Sigs))
+	for _, name := range cfg.Sigs {
+		scheme, err := sign.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("gateway: %w", err)
+		}
+		keyPair, err := scheme.GenerateKeyPair()
+		if err != nil {
+			return nil, fmt.Errorf("gateway: generate %s keypair: %w", name, err)
+		}
+		sigCreds = append(sigCreds, state.SignatureCredential{Scheme: scheme, KeyPair: keyPair})
+	}
+	sigScheme := sigCreds[0].Scheme
+	signers := make(map[string]*state.SignatureCredential, len(sigCreds))
+	for i := range sigCreds {
+		signers[sigCreds[i].Scheme.Name()] = &sigCreds[i]
 	}
 
 	schedulerCfg := scheduler.Config{
@@ -91,40 +270,112 @@ func NewGatewayServer(cfg GatewayConfig) (*GatewayServer, error) {
 	}
 
 	capabilities := state.CapabilitySet{
-		PQKEM:      kemSuite.Name(),
-		PQSigs:     sigScheme.Name(),
-		AEAD:       cfg.AEAD,
+		PQKEMs:     cfg.KEMs,
+		PQSigs:     cfg.Sigs,
+		AEADs:      cfg.AEADs,
 		Transports: []string{"http"},
 	}
 
+	var authorize func(state.PeerIdentity) error
+	if len(cfg.AuthorizedClients) > 0 {
+		allowed := make(map[string]struct{}, len(cfg.AuthorizedClients))
+		for _, fp := range cfg.AuthorizedClients {
+			allowed[fp] = struct{}{}
+		}
+		authorize = func(id state.PeerIdentity) error {
+			if _, ok := allowed[id.Fingerprint()]; !ok {
+				return fmt.Errorf("fingerprint %s not in allow-list", id.Fingerprint())
+			}
+			return nil
+		}
+	}
+
+	policyEnforcer := policy.New(policy.Config{
+		AllowedModes:          []string{cfg.Mode},
+		AllowedAEAD:           cfg.AEADs,
+		MinRotation:           time.Minute,
+		MaxRotation:           2 * time.Hour,
+		AllowStrictResumption: cfg.AllowStrictResumption,
+		DisableEarlyData:      !cfg.EarlyData,
+	})
+
+	var keyring *ticket.Keyring
+	if cfg.Resumption {
+		var err error
+		keyring, err = ticket.NewKeyring(ticket.Config{
+			Lifetime:         cfg.TicketLifetime,
+			RotationInterval: cfg.TicketKeyRotation,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("gateway: %w", err)
+		}
+	}
+
 	serverState, err := state.NewServer(state.ServerConfig{
-		Mode:             cfg.Mode,
-		KEMSuite:         kemSuite,
-		KEMKeyPair:       kemKeyPair,
-		SignatureScheme:  sigScheme,
-		SignatureKeyPair: sigKeyPair,
-		Capabilities:     capabilities,
-		Scheduler:        schedulerCfg,
+		Mode:                 cfg.Mode,
+		KEMSuite:             kemSuite,
+		KEMKeyPair:           kemCreds[0].KeyPair,
+		AdditionalKEMs:       kemCreds[1:],
+		SignatureScheme:      sigScheme,
+		SignatureKeyPair:     sigCreds[0].KeyPair,
+		AdditionalSignatures: sigCreds[1:],
+		Capabilities:         capabilities,
+		Scheduler:            schedulerCfg,
+		RequireClientAuth:    cfg.RequireClientAuth,
+		AuthorizeClient:      authorize,
+		Attestation:          cfg.Attestation,
+		MaxClockSkew:         cfg.MaxClockSkew,
+		ReplayCache: replay.NewCache(replay.CacheConfig{
+			Capacity:       cfg.ReplayCacheSize,
+			TTL:            2 * cfg.MaxClockSkew,
+			RejectWhenFull: true,
+		}),
+		Tickets:      keyring,
+		Policy:       policyEnforcer,
+		MaxEarlyData: cfg.MaxEarlyData,
+		Audit:        cfg.Audit,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("gateway: construct handshake server: %w", err)
 	}
 
-	policyEnforcer := policy.New(policy.Config{
-		AllowedModes: []string{cfg.Mode},
-		AllowedAEAD:  []string{cfg.AEAD},
-		MinRotation:  time.Minute,
-		MaxRotation:  2 * time.Hour,
-	})
-
 	rotationCfg := rotation.Config{
-		Interval:   cfg.Rotation,
-		MaxPackets: 1 << 20,
-		Skew:       10 * time.Second,
+		Interval:    cfg.Rotation,
+		MaxPackets:  1 << 20,
+		Skew:        10 * time.Second,
+		Rehandshake: cfg.Rehandshake,
 	}
 
 	replayCfg := replay.Config{
 		Depth: 4096,
+		Store: cfg.ReplayStore,
+	}
+
+	handshakeRejects, err := metrics.Meter("qsafe/gateway").Int64Counter(
+		"qsafe.gateway.handshake.rejected",
+		metric.WithDescription("Handshake initiations rejected, by reason"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: register metrics: %w", err)
+	}
+	handshakeRetries, err := metrics.Meter("qsafe/gateway").Int64Counter(
+		"qsafe.gateway.handshake.retries",
+		metric.WithDescription("Handshake initiations answered with a retry cookie"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: register metrics: %w", err)
+	}
+
+	var cookies *cookie.Issuer
+	switch cfg.RetryCookies {
+	case "off":
+	case "load", "always":
+		cookies, err = cookie.NewIssuer(cookie.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("gateway: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("gateway: unknown retry cookie mode %q", cfg.RetryCookies)
 	}
 
 	g := &GatewayServer{
@@ -132,20 +383,42 @@ func NewGatewayServer(cfg GatewayConfig) (*GatewayServer, error) {
 		logger:       cfg.Logger,
 		kemSuite:     kemSuite,
 		sigScheme:    sigScheme,
+		signers:      signers,
 		serverState:  serverState,
 		schedulerCfg: schedulerCfg,
 		rotationCfg:  rotationCfg,
 		replayCfg:    replayCfg,
 		policy:       policyEnforcer,
-		capabilities: capabilities,
-		sessions:     make(map[string]*state.Session),
+		capabilities: serverState.Config().Capabilities,
+
+		handshakeRejects: handshakeRejects,
+		handshakeRetries: handshakeRetries,
+		cookies:          cookies,
+
+		sessions:     make(map[string]*liveSession),
+		pending:      make(map[string]*list.Element),
+		pendingOrder: list.New(),
+	}
+	if cfg.SessionState != "" {
+		if len(cfg.SessionStateKey) != state.SealedKeySize {
+			return nil, fmt.Errorf("gateway: session state key must be %d bytes", state.SealedKeySize)
+		}
+		if err := g.reloadSessions(); err != nil {
+			return nil, err
+		}
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", g.handleHealth)
 	mux.HandleFunc("/handshake/config", g.handleHandshakeConfig)
 	mux.HandleFunc("/handshake/init", g.handleHandshakeInit)
+	mux.HandleFunc("/handshake/finished", g.handleHandshakeFinished)
+	mux.HandleFunc("/handshake/resume", g.handleHandshakeResume)
 	mux.HandleFunc("/message", g.handleMessage)
+	mux.HandleFunc("/rekey", g.handleRekey)
+	mux.HandleFunc("/rehandshake", g.handleRehandshake)
+	mux.HandleFunc("/close", g.handleClose)
+	mux.HandleFunc("/stream", g.handleStream)
 
 	g.httpSrv = &http.Server{
 		Addr:         cfg.Address,
@@ -162,9 +435,107 @@ func (g *GatewayServer) Start() error {
 	return g.httpSrv.ListenAndServe()
 }
 
-// Stop gracefully shuts down the HTTP server.
+// Stop gracefully shuts down the HTTP server, then closes every session and pending
+// handshake so their keys are wiped, and finally wipes the handshake private keys. With
+// SessionState set, confirmed sessions are sealed to it first; pending handshakes are
+// always dropped.
 func (g *GatewayServer) Stop(ctx context.Context) error {
-	return g.httpSrv.Shutdown(ctx)
+	err := g.httpSrv.Shutdown(ctx)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var drained [][]byte
+	for id, live := range g.sessions {
+		delete(g.sessions, id)
+		if g.cfg.SessionState != "" {
+			sealed, serr := live.session.MarshalSealed(g.cfg.SessionStateKey)
+			if serr == nil {
+				drained = append(drained, sealed)
+				_ = live.session.Release()
+				continue
+			}
+			g.logger.Warn("session not drained", zap.String("session_id", id), zap.Error(serr))
+		}
+		_ = live.session.Close()
+	}
+	for e := g.pendingOrder.Front(); e != nil; e = g.pendingOrder.Front() {
+		g.dropPending(e).discard()
+	}
+	g.serverState.Close()
+	if g.cfg.SessionState != "" {
+		if werr := writeSessionState(g.cfg.SessionState, drained); werr != nil {
+			return errors.Join(err, werr)
+		}
+		g.logger.Info("sessions drained", zap.Int("sessions", len(drained)), zap.String("path", g.cfg.SessionState))
+	}
+	return err
+}
+
+// reloadSessions restores the sessions drained to SessionState and removes the file, so
+// the same sealed sessions are never restored twice. Sessions that no longer restore,
+// for example because policy has changed, are dropped and their agents re-handshake.
+func (g *GatewayServer) reloadSessions() error {
+	data, err := os.ReadFile(g.cfg.SessionState)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("gateway: session state: %w", err)
+	}
+	if err := os.Remove(g.cfg.SessionState); err != nil {
+		return fmt.Errorf("gateway: session state: %w", err)
+	}
+	var file sessionStateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("gateway: session state: %w", err)
+	}
+
+	restoreCfg := state.RestoreConfig{
+		Rotation: g.rotationCfg,
+		Replay:   g.replayCfg,
+		Policy:   g.policy,
+		Signers:  g.signers,
+	}
+	now := time.Now().UnixNano()
+	for _, sealed := range file.Sessions {
+		session, err := state.RestoreSession(sealed, g.cfg.SessionStateKey, restoreCfg)
+		if err != nil {
+			g.logger.Warn("session not restored", zap.Error(err))
+			continue
+		}
+		live := &liveSession{session: session}
+		live.lastSeen.Store(now)
+		g.sessions[hex.EncodeToString(session.SessionID())] = live
+	}
+	g.logger.Info("sessions restored", zap.Int("sessions", len(g.sessions)), zap.Int("drained", len(file.Sessions)))
+	return nil
+}
+
+// writeSessionState atomically replaces path with the sealed sessions, readable only by
+// the owner.
+func writeSessionState(path string, sealed [][]byte) error {
+	data, err := json.Marshal(sessionStateFile{Sessions: sealed})
+	if err != nil {
+		return fmt.Errorf("gateway: session state: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("gateway: session state: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("gateway: session state: %w", err)
+	}
+	return nil
 }
 
 func (g *GatewayServer) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -173,12 +544,11 @@ func (g *GatewayServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 type handshakeMetadata struct {
-	Mode            string              `json:"mode"`
-	AEAD            string              `json:"aead"`
-	Capabilities    state.CapabilitySet `json:"capabilities"`
-	KEMPublic       []byte              `json:"kem_public"`
-	SignaturePublic []byte              `json:"signature_public"`
-	RotationSeconds uint32              `json:"rotation_seconds"`
+	Mode                string              `json:"mode"`
+	Capabilities        state.CapabilitySet `json:"capabilities"`
+	KEMPublicKeys       map[string][]byte   `json:"kem_public_keys"`
+	SignaturePublicKeys map[string][]byte   `json:"signature_public_keys"`
+	RotationSeconds     uint32              `json:"rotation_seconds"`
 }
 
 func (g *GatewayServer) handleHandshakeConfig(w http.ResponseWriter, r *http.Request) {
@@ -186,14 +556,12 @@ func (g *GatewayServer) handleHandshakeConfig(w http.ResponseWriter, r *http.Req
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	serverCfg := g.serverState.Config()
 	meta := handshakeMetadata{
-		Mode:            g.cfg.Mode,
-		AEAD:            g.cfg.AEAD,
-		Capabilities:    g.capabilities,
-		KEMPublic:       serverCfg.KEMKeyPair.Public,
-		SignaturePublic: serverCfg.SignatureKeyPair.Public,
-		RotationSeconds: uint32(g.schedulerCfg.RotationInterval.Seconds()),
+		Mode:                g.cfg.Mode,
+		Capabilities:        g.capabilities,
+		KEMPublicKeys:       g.serverState.KEMPublicKeys(),
+		SignaturePublicKeys: g.serverState.SignaturePublicKeys(),
+		RotationSeconds:     uint32(g.schedulerCfg.RotationInterval.Seconds()),
 	}
 	writeJSON(w, meta, http.StatusOK)
 }
@@ -203,6 +571,12 @@ type handshakeInitResponse struct {
 	SessionID      string               `json:"session_id"`
 }
 
+// handshakeRetryResponse replaces handshakeInitResponse when the gateway wants proof of
+// the client's address before doing any handshake work.
+type handshakeRetryResponse struct {
+	Retry state.HelloRetryRequest `json:"retry"`
+}
+
 func (g *GatewayServer) handleHandshakeInit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -211,41 +585,68 @@ func (g *GatewayServer) handleHandshakeInit(w http.ResponseWriter, r *http.Reque
 
 	var init state.ClientInit
 	if err := json.NewDecoder(r.Body).Decode(&init); err != nil {
-		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		g.writeAlert(w, r, "handshake", fmt.Errorf("%w: %v", state.ErrDecode, err))
+		return
+	}
+
+	if retry, err := g.retryRequest(r, init); err != nil {
+		g.writeAlert(w, r, "handshake", err)
+		return
+	} else if retry != nil {
+		writeJSON(w, handshakeRetryResponse{Retry: *retry}, http.StatusOK)
 		return
 	}
+	g.inFlight.Add(1)
+	defer g.inFlight.Add(-1)
 
 	resp, keys, err := g.serverState.Accept(r.Context(), init)
 	if err != nil {
-		g.logger.Warn("handshake failed", zap.Error(err))
-		http.Error(w, "handshake failed: "+err.Error(), http.StatusBadRequest)
+		g.writeAlert(w, r, "handshake", err)
 		return
 	}
 
+	verifier, err := peerVerifier(init.Identity)
+	if err != nil {
+		keys.Wipe()
+		g.writeAlert(w, r, "session setup", err)
+		return
+	}
 	session, err := state.NewSession(state.SessionConfig{
 		Role:     state.RoleServer,
 		Mode:     g.cfg.Mode,
-		AEAD:     g.cfg.AEAD,
+		AEAD:     resp.Payload.Selected.AEAD,
+		KEM:      resp.Payload.Selected.PQKEM,
 		Keys:     keys,
 		Rotation: g.rotationCfg,
 		Replay:   g.replayCfg,
 		Policy:   g.policy,
-		Epoch:    1,
+		Epoch:    state.InitialEpoch,
+		Signer:   g.signers[resp.Payload.Selected.PQSig],
+
+		PeerIdentity: init.Identity,
+		PeerVerifier: verifier,
 	})
 	if err != nil {
-		g.logger.Error("session setup failed", zap.Error(err))
-		http.Error(w, "session setup failed: "+err.Error(), http.StatusInternalServerError)
+		keys.Wipe()
+		g.writeAlert(w, r, "session setup", err)
 		return
 	}
 
 	sessionID := hex.EncodeToString(session.SessionID())
-	g.storeSession(sessionID, session)
+	p := &pendingSession{
+		id:             sessionID,
+		session:        session,
+		keys:           keys,
+		transcriptHash: resp.TranscriptHash,
+		selected:       resp.Payload.Selected,
+	}
+	if err := g.storePending(p); err != nil {
+		p.discard()
+		g.writeAlert(w, r, "handshake", err)
+		return
+	}
 
-	g.logger.Info("handshake complete",
-		zap.String("session_id", sessionID),
-		zap.String("mode", g.cfg.Mode),
-		zap.String("aead", g.cfg.AEAD),
-	)
+	g.logger.Debug("handshake awaiting finished", zap.String("session_id", sessionID))
 
 	writeJSON(w, handshakeInitResponse{
 		ServerResponse: resp,
@@ -253,6 +654,194 @@ func (g *GatewayServer) handleHandshakeInit(w http.ResponseWriter, r *http.Reque
 	}, http.StatusOK)
 }
 
+// retryRequest returns a HelloRetryRequest if init must prove its address before the
+// gateway does any asymmetric work. A valid cookie is always honoured; without one, a
+// cookie is demanded in "always" mode or once the in-flight threshold is reached.
+func (g *GatewayServer) retryRequest(r *http.Request, init state.ClientInit) (*state.HelloRetryRequest, error) {
+	if g.cookies == nil {
+		return nil, nil
+	}
+	binding := state.RetryBinding(remoteHost(r), init)
+	if len(init.Cookie) > 0 {
+		err := g.cookies.Verify(init.Cookie, binding)
+		if err == nil {
+			return nil, nil
+		}
+		// The client may simply have changed address or been slow; answer with a fresh
+		// cookie, which costs no more than the rejection would.
+		g.logger.Debug("retry cookie rejected", zap.String("remote", r.RemoteAddr), zap.Error(err))
+	} else if g.cfg.RetryCookies == "load" && g.inFlight.Load() < int64(g.cfg.CookieThreshold) {
+		return nil, nil
+	}
+
+	c, err := g.cookies.Issue(binding)
+	if err != nil {
+		return nil, err
+	}
+	g.handshakeRetries.Add(r.Context(), 1)
+	return &state.HelloRetryRequest{Cookie: c}, nil
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type handshakeFinishedRequest struct {
+	SessionID string                  `json:"session_id"`
+	Finished  state.HandshakeFinished `json:"finished"`
+}
+
+type handshakeFinishedResponse struct {
+	Ticket *state.NewSessionTicket `json:"ticket,omitempty"`
+}
+
+func (g *GatewayServer) handleHandshakeFinished(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req handshakeFinishedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		g.writeAlert(w, r, "handshake finished", fmt.Errorf("%w: %v", state.ErrDecode, err))
+		return
+	}
+
+	// A pending session gets exactly one Finished attempt.
+	p, ok := g.takePending(req.SessionID)
+	if !ok {
+		g.writeAlert(w, r, "handshake finished", fmt.Errorf("%w: no handshake awaiting Finished for session %q", state.ErrUnexpectedMessage, req.SessionID))
+		return
+	}
+	if err := state.VerifyFinished(p.keys, p.transcriptHash, req.Finished); err != nil {
+		p.discard()
+		g.writeAlert(w, r, "handshake finished", err)
+		return
+	}
+	// The session holds its own copy; the handshake keys are only kept for the ticket.
+	defer p.keys.Wipe()
+
+	g.storeSession(req.SessionID, p.session)
+
+	g.logger.Info("handshake complete",
+		zap.String("session_id", req.SessionID),
+		zap.String("mode", g.cfg.Mode),
+		zap.String("kem", p.selected.PQKEM),
+		zap.String("signature", p.selected.PQSig),
+		zap.String("aead", p.selected.AEAD),
+		zap.String("client", clientFingerprint(p.session)),
+		zap.Bool("resumed", p.resumed),
+	)
+
+	var out handshakeFinishedResponse
+	if g.cfg.Resumption {
+		var peer *state.PeerIdentity
+		if id, ok := p.session.PeerIdentity(); ok {
+			peer = &id
+		}
+		nst, err := g.serverState.IssueTicket(p.keys, p.selected, peer)
+		switch {
+		case err == nil:
+			out.Ticket = &nst
+		case errors.Is(err, state.ErrResumptionDisabled):
+			g.logger.Debug("ticket not issued", zap.Error(err))
+		default:
+			g.logger.Error("ticket issuance failed", zap.Error(err))
+		}
+	}
+	writeJSON(w, out, http.StatusOK)
+}
+
+type handshakeResumeResponse struct {
+	ResumeResponse state.ResumeResponse `json:"resume_response"`
+	SessionID      string               `json:"session_id"`
+	EarlyData      *messageResponse     `json:"early_data,omitempty"`
+}
+
+func (g *GatewayServer) handleHandshakeResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var init state.ResumeInit
+	if err := json.NewDecoder(r.Body).Decode(&init); err != nil {
+		g.writeAlert(w, r, "resumption", fmt.Errorf("%w: %v", state.ErrDecode, err))
+		return
+	}
+
+	resp, resumed, err := g.serverState.Resume(r.Context(), init)
+	if err != nil {
+		g.writeAlert(w, r, "resumption", err)
+		return
+	}
+
+	verifier, err := peerVerifier(resumed.Peer)
+	if err != nil {
+		resumed.Keys.Wipe()
+		g.writeAlert(w, r, "session setup", err)
+		return
+	}
+	session, err := state.NewSession(state.SessionConfig{
+		Role:     state.RoleServer,
+		Mode:     g.cfg.Mode,
+		AEAD:     resp.Payload.Selected.AEAD,
+		KEM:      resp.Payload.Selected.PQKEM,
+		Keys:     resumed.Keys,
+		Rotation: g.rotationCfg,
+		Replay:   g.replayCfg,
+		Policy:   g.policy,
+		Epoch:    state.InitialEpoch,
+		Signer:   g.signers[resp.Payload.Selected.PQSig],
+
+		PeerIdentity: resumed.Peer,
+		PeerVerifier: verifier,
+	})
+	if err != nil {
+		resumed.Keys.Wipe()
+		g.writeAlert(w, r, "session setup", err)
+		return
+	}
+
+	sessionID := hex.EncodeToString(session.SessionID())
+	p := &pendingSession{
+		id:             sessionID,
+		session:        session,
+		keys:           resumed.Keys,
+		transcriptHash: resp.TranscriptHash,
+		selected:       resp.Payload.Selected,
+		resumed:        true,
+	}
+	if err := g.storePending(p); err != nil {
+		p.discard()
+		g.writeAlert(w, r, "resumption", err)
+		return
+	}
+
+	out := handshakeResumeResponse{
+		ResumeResponse: resp,
+		SessionID:      sessionID,
+	}
+	if early := resumed.EarlyData; early != nil {
+		g.logger.Info("early data received",
+			zap.String("session_id", sessionID),
+			zap.String("client", clientFingerprint(session)),
+			zap.Int("bytes", len(early.Plaintext)),
+			zap.Bool("replayable", early.Replayable),
+		)
+		out.EarlyData = &messageResponse{
+			Plaintext: early.Plaintext,
+			Received:  time.Now().UTC(),
+			EarlyData: true,
+		}
+	}
+	writeJSON(w, out, http.StatusOK)
+}
+
 type messageRequest struct {
 	SessionID string         `json:"session_id"`
 	Envelope  state.Envelope `json:"envelope"`
@@ -262,6 +851,9 @@ type messageResponse struct {
 	Plaintext []byte    `json:"plaintext"`
 	Rotate    bool      `json:"rotate"`
 	Received  time.Time `json:"received_at"`
+	EarlyData bool      `json:"early_data,omitempty"`
+	// Rehandshake asks the agent to run a fresh KEM exchange at /rehandshake.
+	Rehandshake bool `json:"rehandshake,omitempty"`
 }
 
 func (g *GatewayServer) handleMessage(w http.ResponseWriter, r *http.Request) {
@@ -272,7 +864,7 @@ func (g *GatewayServer) handleMessage(w http.ResponseWriter, r *http.Request) {
 
 	var req messageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		g.writeAlert(w, r, "message", fmt.Errorf("%w: %v", state.ErrDecode, err))
 		return
 	}
 	if req.SessionID == "" {
@@ -288,38 +880,430 @@ func (g *GatewayServer) handleMessage(w http.ResponseWriter, r *http.Request) {
 
 	plaintext, rotate, err := session.Decrypt(r.Context(), req.Envelope)
 	if err != nil {
-		if errors.Is(err, replay.ErrDuplicate) || errors.Is(err, replay.ErrStale) {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return
-		}
-		http.Error(w, "decrypt failed: "+err.Error(), http.StatusBadRequest)
+		g.writeAlert(w, r, "message", err,
+			zap.String("session_id", req.SessionID),
+			zap.String("client", clientFingerprint(session)),
+		)
 		return
 	}
 
 	g.logger.Info("message received",
 		zap.String("session_id", req.SessionID),
+		zap.String("client", clientFingerprint(session)),
 		zap.Int("bytes", len(plaintext)),
 		zap.Bool("rotate", rotate),
 	)
 
 	writeJSON(w, messageResponse{
-		Plaintext: plaintext,
-		Rotate:    rotate,
-		Received:  time.Now().UTC(),
+		Plaintext:   plaintext,
+		Rotate:      rotate,
+		Rehandshake: session.RehandshakeDue(),
+		Received:    time.Now().UTC(),
 	}, http.StatusOK)
 }
 
+type rekeyRequest struct {
+	SessionID string            `json:"session_id"`
+	Notice    state.RekeyNotice `json:"notice"`
+}
+
+type rekeyResponse struct {
+	Epoch uint64 `json:"epoch"`
+}
+
+// handleRekey applies an agent's RekeyNotice, moving the session's receive direction to
+// the announced epoch. Envelopes from the previous epoch are accepted for the rotation
+// grace period.
+func (g *GatewayServer) handleRekey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rekeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		g.writeAlert(w, r, "rekey", fmt.Errorf("%w: %v", state.ErrDecode, err))
+		return
+	}
+	session, ok := g.loadSession(req.SessionID)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	if err := session.ApplyRekey(req.Notice); err != nil {
+		g.writeAlert(w, r, "rekey", err,
+			zap.String("session_id", req.SessionID),
+			zap.String("client", clientFingerprint(session)),
+		)
+		return
+	}
+
+	g.logger.Info("session rekeyed",
+		zap.String("session_id", req.SessionID),
+		zap.String("client", clientFingerprint(session)),
+		zap.Uint64("epoch", req.Notice.NextEpoch),
+	)
+	writeJSON(w, rekeyResponse{Epoch: req.Notice.NextEpoch}, http.StatusOK)
+}
+
+type rehandshakeRequest struct {
+	SessionID string                `json:"session_id"`
+	Init      state.RehandshakeInit `json:"init"`
+}
+
+// handleRehandshake answers an agent's in-session KEM exchange. The session switches to
+// the new keys before the response is written; envelopes the agent sealed under the old
+// keys are accepted for the rotation grace period.
+func (g *GatewayServer) handleRehandshake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rehandshakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		g.writeAlert(w, r, "rehandshake", fmt.Errorf("%w: %v", state.ErrDecode, err))
+		return
+	}
+	session, ok := g.loadSession(req.SessionID)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	resp, err := session.AcceptRehandshake(req.Init)
+	if err != nil {
+		g.writeAlert(w, r, "rehandshake", err)
+		return
+	}
+
+	g.logger.Info("session re-handshaked",
+		zap.String("session_id", req.SessionID),
+		zap.String("client", clientFingerprint(session)),
+		zap.Uint64("epoch", req.Init.Epoch),
+	)
+	writeJSON(w, resp, http.StatusOK)
+}
+
+type closeResponse struct {
+	Closed bool `json:"closed"`
+}
+
+// handleClose ends a session at the agent's request. The request carries an envelope
+// sealed under the session, so only the agent holding its keys can close it; the
+// gateway then wipes the keys and forgets the session ID.
+func (g *GatewayServer) handleClose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req messageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		g.writeAlert(w, r, "close", fmt.Errorf("%w: %v", state.ErrDecode, err))
+		return
+	}
+	session, ok := g.loadSession(req.SessionID)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	if _, _, err := session.Decrypt(r.Context(), req.Envelope); err != nil {
+		g.writeAlert(w, r, "close", err,
+			zap.String("session_id", req.SessionID),
+			zap.String("client", clientFingerprint(session)),
+		)
+		return
+	}
+
+	stats := session.ReplayStats()
+	g.closeSession(req.SessionID)
+	g.logger.Info("session closed",
+		zap.String("session_id", req.SessionID),
+		zap.String("client", clientFingerprint(session)),
+		zap.Uint64("replay_duplicates", stats.Duplicates),
+		zap.Uint64("replay_stale", stats.Stale),
+	)
+	writeJSON(w, closeResponse{Closed: true}, http.StatusOK)
+}
+
+type streamResponse struct {
+	StreamID string `json:"stream_id"`
+	Name     string `json:"name,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	// BLAKE3 is the hex digest of the received plaintext, for the agent to compare with
+	// what it sent.
+	BLAKE3      string `json:"blake3"`
+	Rotate      bool   `json:"rotate"`
+	Rehandshake bool   `json:"rehandshake,omitempty"`
+}
+
+// handleStream receives a file as a stream of envelopes: newline-delimited JSON in the
+// request body, for the session named by the session_id query parameter. The stream is
+// only stored, under StreamDir, once its final chunk has been authenticated.
+func (g *GatewayServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		http.Error(w, "session_id required", http.StatusBadRequest)
+		return
+	}
+	session, ok := g.loadSession(sessionID)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	lines := bufio.NewReaderSize(r.Body, streamEnvelopeLimit)
+	source := func() (state.Envelope, error) {
+		deadline := time.Now().Add(streamChunkTimeout)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline)
+		// Marking the session active keeps a long stream from being closed as idle.
+		g.loadSession(sessionID)
+		return readStreamEnvelope(lines)
+	}
+	stream, err := session.NewStreamReader(r.Context(), source, state.StreamConfig{})
+	if err != nil {
+		g.writeAlert(w, r, "stream", err, zap.String("session_id", sessionID))
+		return
+	}
+	name := stream.Metadata()["name"]
+
+	dst, commit, err := g.streamSink(hex.EncodeToString(session.SessionID()), stream.ID())
+	if err != nil {
+		g.writeAlert(w, r, "stream", err, zap.String("session_id", sessionID))
+		return
+	}
+	hasher := blake3.New()
+	n, err := io.Copy(io.MultiWriter(dst, hasher), stream)
+	if err = commit(err); err != nil {
+		g.writeAlert(w, r, "stream", err, zap.String("session_id", sessionID), zap.String("stream_id", stream.ID()))
+		return
+	}
+
+	g.logger.Info("stream received",
+		zap.String("session_id", sessionID),
+		zap.String("client", clientFingerprint(session)),
+		zap.String("stream_id", stream.ID()),
+		zap.String("name", name),
+		zap.Int64("bytes", n),
+	)
+	writeJSON(w, streamResponse{
+		StreamID:    stream.ID(),
+		Name:        name,
+		Bytes:       n,
+		BLAKE3:      hex.EncodeToString(hasher.Sum(nil)),
+		Rotate:      stream.RotateSuggested(),
+		Rehandshake: session.RehandshakeDue(),
+	}, http.StatusOK)
+}
+
+// readStreamEnvelope decodes the next non-blank line of a stream body, refusing lines
+// that do not fit in the reader's buffer rather than growing it.
+func readStreamEnvelope(lines *bufio.Reader) (state.Envelope, error) {
+	for {
+		line, err := lines.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return state.Envelope{}, errEnvelopeTooLarge
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return state.Envelope{}, err
+			}
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return state.Envelope{}, err
+		}
+		var env state.Envelope
+		if err := json.Unmarshal(line, &env); err != nil {
+			return state.Envelope{}, fmt.Errorf("%w: stream envelope: %v", state.ErrDecode, err)
+		}
+		return env, nil
+	}
+}
+
+// streamSink returns where a stream's plaintext goes and a commit function that, given
+// the outcome of copying it, keeps or discards the result. Files are written under a
+// temporary name and linked into place once complete, so a truncated stream never looks
+// whole. The final name is prefixed with the session ID, so one agent cannot collide
+// with another's streams, and linking fails rather than replace an existing file.
+func (g *GatewayServer) streamSink(sessionID, id string) (io.Writer, func(error) error, error) {
+	if g.cfg.StreamDir == "" {
+		return io.Discard, func(err error) error { return err }, nil
+	}
+	// The ID is authenticated but chosen by the agent, so it must not name a path.
+	if raw, err := hex.DecodeString(id); err != nil || len(raw) != 16 {
+		return nil, nil, fmt.Errorf("gateway: malformed stream id %q", id)
+	}
+	f, err := os.CreateTemp(g.cfg.StreamDir, ".stream-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("gateway: stream file: %w", err)
+	}
+	commit := func(err error) error {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			name := sessionID + "-" + id
+			if err = os.Link(f.Name(), filepath.Join(g.cfg.StreamDir, name)); errors.Is(err, fs.ErrExist) {
+				err = fmt.Errorf("%w: %s", errStreamExists, name)
+			}
+		}
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return f, commit, nil
+}
+
+// storeSession registers a confirmed session and closes any that have been idle for
+// longer than SessionIdleTimeout.
 func (g *GatewayServer) storeSession(id string, session *state.Session) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	g.sessions[id] = session
+	now := time.Now()
+	idleBefore := now.Add(-g.cfg.SessionIdleTimeout).UnixNano()
+	for sid, old := range g.sessions {
+		if old.lastSeen.Load() < idleBefore {
+			_ = old.session.Close()
+			delete(g.sessions, sid)
+			g.logger.Debug("idle session closed", zap.String("session_id", sid))
+		}
+	}
+	live := &liveSession{session: session}
+	live.lastSeen.Store(now.UnixNano())
+	g.sessions[id] = live
+}
+
+// closeSession removes a session and wipes its keys.
+func (g *GatewayServer) closeSession(id string) {
+	g.mu.Lock()
+	live, ok := g.sessions[id]
+	delete(g.sessions, id)
+	g.mu.Unlock()
+	if ok {
+		_ = live.session.Close()
+	}
+}
+
+// storePending records an unconfirmed handshake, due to expire after FinishedTimeout,
+// and drops any that have expired. It fails with errPendingFull once MaxPending
+// handshakes are waiting.
+func (g *GatewayServer) storePending(p *pendingSession) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	g.expirePending(now)
+	if g.pendingOrder.Len() >= g.cfg.MaxPending {
+		return errPendingFull
+	}
+	p.expires = now.Add(g.cfg.FinishedTimeout)
+	g.pending[p.id] = g.pendingOrder.PushBack(p)
+	return nil
+}
+
+// takePending removes and returns an unexpired pending handshake.
+func (g *GatewayServer) takePending(id string) (*pendingSession, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expirePending(time.Now())
+	e, ok := g.pending[id]
+	if !ok {
+		return nil, false
+	}
+	return g.dropPending(e), true
+}
+
+// expirePending discards handshakes from the front of pendingOrder until it reaches one
+// that has not expired.
+func (g *GatewayServer) expirePending(now time.Time) {
+	for e := g.pendingOrder.Front(); e != nil; e = g.pendingOrder.Front() {
+		if now.Before(e.Value.(*pendingSession).expires) {
+			return
+		}
+		g.dropPending(e).discard()
+	}
+}
+
+// dropPending removes e from the pending handshakes and returns its session.
+func (g *GatewayServer) dropPending(e *list.Element) *pendingSession {
+	p := g.pendingOrder.Remove(e).(*pendingSession)
+	delete(g.pending, p.id)
+	return p
 }
 
+// loadSession returns a confirmed session and marks it as active.
 func (g *GatewayServer) loadSession(id string) (*state.Session, bool) {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
-	session, ok := g.sessions[id]
-	return session, ok
+	live, ok := g.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	live.lastSeen.Store(time.Now().UnixNano())
+	return live.session, true
+}
+
+// peerVerifier returns the key an authenticated agent must sign its rekey notices with;
+// anonymous agents rely on the notice commitment alone.
+func peerVerifier(peer *state.PeerIdentity) (*state.SignatureVerifier, error) {
+	if peer == nil {
+		return nil, nil
+	}
+	verifier, err := peer.Verifier()
+	if err != nil {
+		return nil, fmt.Errorf("gateway: client identity: %w", err)
+	}
+	return &verifier, nil
+}
+
+func clientFingerprint(session *state.Session) string {
+	if peer, ok := session.PeerIdentity(); ok {
+		return peer.Fingerprint()
+	}
+	return "anonymous"
+}
+
+type alertResponse struct {
+	Alert state.Alert `json:"alert"`
+}
+
+// writeAlert rejects a handshake or session step with a structured alert. The agent
+// only sees the alert's fixed reason and hint; the underlying error is logged, with any
+// extra fields, and counted by code.
+func (g *GatewayServer) writeAlert(w http.ResponseWriter, r *http.Request, stage string, err error, extra ...zap.Field) {
+	alert := state.AlertFor(err)
+	g.handshakeRejects.Add(r.Context(), 1, metric.WithAttributes(attribute.String("reason", string(alert.Code))))
+	fields := append([]zap.Field{
+		zap.String("code", string(alert.Code)),
+		zap.String("remote", r.RemoteAddr),
+		zap.Error(err),
+	}, extra...)
+	if alert.Severity == state.SeverityCritical {
+		g.logger.Error(stage+" rejected", fields...)
+	} else {
+		g.logger.Warn(stage+" rejected", fields...)
+	}
+	writeJSON(w, alertResponse{Alert: alert}, alertStatus(alert.Code))
+}
+
+func alertStatus(code state.AlertCode) int {
+	switch code {
+	case state.AlertInternal:
+		return http.StatusInternalServerError
+	case state.AlertUnauthorized, state.AlertAttestation, state.AlertPolicyDenied:
+		return http.StatusForbidden
+	case state.AlertReplay, state.AlertUnexpectedMessage:
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
 }
 
 func writeJSON(w http.ResponseWriter, v any, status int) {
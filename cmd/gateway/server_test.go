@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/qsafe/pkg/session/replay"
+	"github.com/example/qsafe/pkg/session/rotation"
+	"github.com/example/qsafe/pkg/session/state"
+)
+
+func TestMessageRejectsWithAlerts(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGateway(t)
+	sessionID, session := handshake(t, g)
+
+	env, _, err := session.Encrypt(ctx, []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if rec := post(t, g.handleMessage, "/message", messageRequest{SessionID: sessionID, Envelope: env}); rec.Code != http.StatusOK {
+		t.Fatalf("first delivery: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := post(t, g.handleMessage, "/message", messageRequest{SessionID: sessionID, Envelope: env})
+	expectAlert(t, rec, http.StatusConflict, replay.ErrDuplicate, replay.ErrDuplicate.Error())
+
+	tampered, _, err := session.Encrypt(ctx, []byte("world"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	tampered.Ciphertext[0] ^= 0x01
+	rec = post(t, g.handleMessage, "/message", messageRequest{SessionID: sessionID, Envelope: tampered})
+	expectAlert(t, rec, http.StatusBadRequest, state.ErrDecrypt, state.ErrDecrypt.Error())
+
+	rec = httptest.NewRecorder()
+	g.handleMessage(rec, httptest.NewRequest(http.MethodPost, "/message", strings.NewReader("{")))
+	expectAlert(t, rec, http.StatusBadRequest, state.ErrDecode, "unexpected EOF")
+}
+
+func TestPendingHandshakesBounded(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGateway(t, func(cfg *GatewayConfig) { cfg.MaxPending = 2 })
+	client := newTestClient(t, g)
+	initiate := func() *httptest.ResponseRecorder {
+		t.Helper()
+		init, pending, err := client.Initiate(ctx)
+		if err != nil {
+			t.Fatalf("client initiate: %v", err)
+		}
+		pending.Close()
+		return post(t, g.handleHandshakeInit, "/handshake/init", init)
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := initiate(); rec.Code != http.StatusOK {
+			t.Fatalf("init %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+	}
+	expectAlert(t, initiate(), http.StatusInternalServerError, errPendingFull, errPendingFull.Error())
+
+	// Once the oldest handshake expires it is discarded and its slot reused.
+	oldest := g.pendingOrder.Front().Value.(*pendingSession)
+	oldest.expires = time.Now().Add(-time.Second)
+	if rec := initiate(); rec.Code != http.StatusOK {
+		t.Fatalf("init after expiry: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := g.pending[oldest.id]; ok || g.pendingOrder.Len() != 2 {
+		t.Fatalf("expired handshake kept: %d pending", g.pendingOrder.Len())
+	}
+	if !oldest.keys.ClientToServer.Wiped() {
+		t.Fatal("expired handshake keys not wiped")
+	}
+}
+
+// newTestGateway returns a gateway with default algorithms that never demands retry
+// cookies, adjusted by configure.
+func newTestGateway(t *testing.T, configure ...func(*GatewayConfig)) *GatewayServer {
+	t.Helper()
+	cfg := GatewayConfig{Address: "127.0.0.1:0", RetryCookies: "off"}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	g, err := NewGatewayServer(cfg)
+	if err != nil {
+		t.Fatalf("new gateway: %v", err)
+	}
+	return g
+}
+
+// handshake runs a full handshake against g's handlers and returns the confirmed
+// session ID with the agent's side of the session.
+func handshake(t *testing.T, g *GatewayServer) (string, *state.Session) {
+	t.Helper()
+	ctx := context.Background()
+	init, pending, err := newTestClient(t, g).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	defer pending.Close()
+
+	rec := post(t, g.handleHandshakeInit, "/handshake/init", init)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handshake init: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp handshakeInitResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode init response: %v", err)
+	}
+	keys, err := pending.Finish(ctx, resp.ServerResponse)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	finished, err := pending.Finished()
+	if err != nil {
+		t.Fatalf("finished: %v", err)
+	}
+	rec = post(t, g.handleHandshakeFinished, "/handshake/finished", handshakeFinishedRequest{SessionID: resp.SessionID, Finished: finished})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handshake finished: status %d: %s", rec.Code, rec.Body)
+	}
+
+	session, err := state.NewSession(state.SessionConfig{
+		Role:     state.RoleClient,
+		Mode:     g.cfg.Mode,
+		AEAD:     resp.ServerResponse.Payload.Selected.AEAD,
+		KEM:      resp.ServerResponse.Payload.Selected.PQKEM,
+		Keys:     keys,
+		Rotation: rotation.Config{Interval: g.cfg.Rotation, MaxPackets: 1 << 20, Skew: 10 * time.Second},
+		Replay:   replay.Config{Depth: 4096},
+		Epoch:    state.InitialEpoch,
+	})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+	return resp.SessionID, session
+}
+
+// newTestClient returns an agent that trusts g's keys and offers g's capabilities.
+func newTestClient(t *testing.T, g *GatewayServer) *state.Client {
+	t.Helper()
+	cfg := g.serverState.Config()
+	client, err := state.NewClient(state.ClientConfig{
+		Mode:               cfg.Mode,
+		KEMSuite:           cfg.KEMSuite,
+		ServerPublicKey:    cfg.KEMKeyPair.Public,
+		Scheduler:          g.schedulerCfg,
+		SignatureScheme:    cfg.SignatureScheme,
+		ServerSignatureKey: cfg.SignatureKeyPair.Public,
+		Capabilities:       g.capabilities,
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client
+}
+
+func post(t *testing.T, handler http.HandlerFunc, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("encode request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw)))
+	return rec
+}
+
+// expectAlert checks that rec carries exactly the alert the gateway sends for cause, and
+// that the underlying error text, leak, is not in the body.
+func expectAlert(t *testing.T, rec *httptest.ResponseRecorder, status int, cause error, leak string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, leak) {
+		t.Fatalf("response leaks error text %q: %s", leak, body)
+	}
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.DisallowUnknownFields()
+	var got alertResponse
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("expected an alert response, got %s: %v", body, err)
+	}
+	if want := state.AlertFor(cause); got.Alert != want {
+		t.Fatalf("expected alert %+v, got %+v", want, got.Alert)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/example/qsafe/pkg/session/audit"
+	"github.com/example/qsafe/pkg/session/state"
+)
+
+func main() {
+	var (
+		in          = flag.String("in", "-", "Audit log to verify (JSON lines as written by -audit-log; - for stdin)")
+		serverPrint = flag.String("server-fingerprint", "", "Require server signatures to be made by the key with this fingerprint")
+		verbose     = flag.Bool("v", false, "Print every transcript entry with its running hash")
+	)
+	flag.Parse()
+
+	records, err := readRecords(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "transcript-verify: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Without a pinned fingerprint a signature only proves that the record is consistent
+	// with the key stored next to it, which whoever wrote the record also chose.
+	if *serverPrint == "" {
+		fmt.Fprintln(os.Stderr, "transcript-verify: warning: no -server-fingerprint given; server signatures are checked only against the keys recorded with them")
+	}
+
+	failed, unverified := 0, 0
+	for i, rec := range records {
+		err := state.VerifyRecord(rec)
+		if err == nil && *serverPrint != "" && rec.ServerFingerprint != *serverPrint {
+			err = fmt.Errorf("signed by server %s, expected %s", rec.ServerFingerprint, *serverPrint)
+		}
+		report(os.Stdout, i+1, rec, err, *verbose)
+		switch {
+		case errors.Is(err, state.ErrRecordUnverified):
+			unverified++
+		case err != nil:
+			failed++
+		}
+	}
+	fmt.Printf("%d record(s), %d failed verification, %d unverified\n", len(records), failed, unverified)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readRecords(path string) ([]state.HandshakeRecord, error) {
+	if path == "-" {
+		return audit.Read(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return audit.Read(f)
+}
+
+func report(w io.Writer, n int, rec state.HandshakeRecord, err error, verbose bool) {
+	result := "ok"
+	switch {
+	case errors.Is(err, state.ErrRecordUnverified):
+		result = "UNVERIFIED: " + err.Error()
+	case err != nil:
+		result = "FAIL: " + err.Error()
+	}
+	fmt.Fprintf(w, "#%d %s %s %s entries=%d %s\n", n, rec.Time.Format("2006-01-02T15:04:05Z"), rec.Role, rec.Transcript.Domain, len(rec.Transcript.Entries), result)
+	if rec.Alert != nil {
+		fmt.Fprintf(w, "    handshake failed: %s (%s)\n", rec.Alert.Code, rec.Alert.Reason)
+	}
+	if rec.Server != nil {
+		fmt.Fprintf(w, "    server %s %s\n", rec.Server.Scheme, rec.ServerFingerprint)
+	}
+	if rec.Client != nil {
+		fmt.Fprintf(w, "    client %s %s\n", rec.Client.Scheme, rec.ClientFingerprint)
+	}
+	if !verbose {
+		return
+	}
+	for _, e := range rec.Transcript.Entries {
+		fmt.Fprintf(w, "    %-16s %x\n", e.Label, e.Hash)
+		fmt.Fprintf(w, "    %-16s %x\n", "", e.Encoding)
+	}
+	if rec.TranscriptHash != nil {
+		fmt.Fprintf(w, "    %-16s %x\n", "transcript_hash", rec.TranscriptHash)
+	}
+}
@@ -0,0 +1,65 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrMissingEvidence indicates no attestation bundle accompanied the handshake.
+	ErrMissingEvidence = errors.New("attestation: evidence required")
+	// ErrNonceMismatch indicates the evidence was produced for a different challenge.
+	ErrNonceMismatch = errors.New("attestation: nonce mismatch")
+	// ErrStaleEvidence indicates the quote timestamp falls outside the freshness window.
+	ErrStaleEvidence = errors.New("attestation: evidence not fresh")
+	// ErrUntrustedChain indicates the certificate chain does not lead to a trusted root.
+	ErrUntrustedChain = errors.New("attestation: untrusted certificate chain")
+	// ErrBadSignature indicates the evidence signature does not verify under the leaf key.
+	ErrBadSignature = errors.New("attestation: evidence signature invalid")
+	// ErrPolicyVersion indicates the bundle targets a policy the verifier does not enforce.
+	ErrPolicyVersion = errors.New("attestation: policy version mismatch")
+	// ErrMeasurementMismatch indicates a measured register differs from policy.
+	ErrMeasurementMismatch = errors.New("attestation: measurement mismatch")
+)
+
+// evidenceContext and certificateContext domain-separate attestation signatures.
+const (
+	evidenceContext    = "qsafe-attestation-evidence-v1"
+	certificateContext = "qsafe-attestation-certificate-v1"
+)
+
+// Bundle mirrors AttestationBundle in proto/api/v1/handshake.proto.
+type Bundle struct {
+	Evidence         []byte `json:"evidence"`
+	Signature        []byte `json:"signature"`
+	CertificateChain []byte `json:"certificate_chain"`
+	PolicyVersion    string `json:"policy_version"`
+	Nonce            []byte `json:"nonce"`
+}
+
+// Evidence is the decoded quote carried in Bundle.Evidence.
+type Evidence struct {
+	Platform     string            `json:"platform"`
+	Measurements map[uint32][]byte `json:"measurements"`
+	Nonce        []byte            `json:"nonce"`
+	Timestamp    time.Time         `json:"timestamp"`
+}
+
+// Result summarises a successful verification.
+type Result struct {
+	Subject       string
+	Platform      string
+	PolicyVersion string
+	Measurements  map[uint32][]byte
+}
+
+// Attester produces evidence bound to a verifier-supplied challenge.
+type Attester interface {
+	Attest(ctx context.Context, nonce []byte) (Bundle, error)
+}
+
+// Verifier appraises a bundle against the expected challenge.
+type Verifier interface {
+	Verify(ctx context.Context, bundle Bundle, nonce []byte) (Result, error)
+}
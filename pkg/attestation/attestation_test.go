@@ -0,0 +1,104 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSimulatorEvidenceVerifies(t *testing.T) {
+	ctx := context.Background()
+	sim, err := NewSimulator([]byte("test-seed"))
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	verifier, err := NewVerifier(sim.Policy())
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+
+	nonce := []byte("challenge-0001")
+	bundle, err := sim.Attest(ctx, nonce)
+	if err != nil {
+		t.Fatalf("attest: %v", err)
+	}
+	result, err := verifier.Verify(ctx, bundle, nonce)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if result.Subject != "qsafe-sim-ak" || result.PolicyVersion != "sim-v1" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if _, err := verifier.Verify(ctx, bundle, []byte("other-challenge")); !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("expected nonce mismatch, got %v", err)
+	}
+
+	tampered := bundle
+	tampered.Evidence = bytes.Replace(bundle.Evidence, []byte("software"), []byte("hardware"), 1)
+	if _, err := verifier.Verify(ctx, tampered, nonce); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected bad signature, got %v", err)
+	}
+
+	verifier.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := verifier.Verify(ctx, bundle, nonce); !errors.Is(err, ErrStaleEvidence) {
+		t.Fatalf("expected stale evidence, got %v", err)
+	}
+}
+
+func TestVerifierRejectsUnexpectedMeasurementsAndRoots(t *testing.T) {
+	ctx := context.Background()
+	sim, err := NewSimulator([]byte("test-seed"))
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	verifier, err := NewVerifier(sim.Policy())
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+
+	sim.SetMeasurement(7, digest("tampered-boot-chain"))
+	bundle, err := sim.Attest(ctx, []byte("nonce"))
+	if err != nil {
+		t.Fatalf("attest: %v", err)
+	}
+	if _, err := verifier.Verify(ctx, bundle, []byte("nonce")); !errors.Is(err, ErrMeasurementMismatch) {
+		t.Fatalf("expected measurement mismatch, got %v", err)
+	}
+
+	other, err := NewSimulator([]byte("other-seed"))
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	foreign, err := other.Attest(ctx, []byte("nonce"))
+	if err != nil {
+		t.Fatalf("attest: %v", err)
+	}
+	if _, err := verifier.Verify(ctx, foreign, []byte("nonce")); !errors.Is(err, ErrUntrustedChain) {
+		t.Fatalf("expected untrusted chain, got %v", err)
+	}
+}
+
+func TestLoadPolicyRoundTrip(t *testing.T) {
+	sim, err := NewSimulator([]byte("test-seed"))
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	policy := sim.Policy()
+	policy.MaxAge = Duration(2 * time.Minute)
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(policy); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	loaded, err := LoadPolicy(&buf)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.Version != policy.Version || loaded.MaxAge != policy.MaxAge || len(loaded.Roots) != 1 {
+		t.Fatalf("policy did not round-trip: %+v", loaded)
+	}
+}
@@ -0,0 +1,123 @@
+package attestation
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+// Certificate is a compact endorsement binding a subject to a post-quantum public key.
+type Certificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Scheme    string    `json:"scheme"`
+	PublicKey []byte    `json:"public_key"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+func (c Certificate) tbs() ([]byte, error) {
+	c.Signature = nil
+	return json.Marshal(c)
+}
+
+// IssueCertificate signs tmpl with the issuer key, filling in the issuer name.
+func IssueCertificate(tmpl Certificate, issuer string, scheme sign.Scheme, issuerPrivate []byte) (Certificate, error) {
+	tmpl.Issuer = issuer
+	tbs, err := tmpl.tbs()
+	if err != nil {
+		return Certificate{}, fmt.Errorf("attestation: encode certificate: %w", err)
+	}
+	sig, err := signWithContext(scheme, issuerPrivate, tbs, certificateContext)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("attestation: sign certificate: %w", err)
+	}
+	tmpl.Signature = sig
+	return tmpl, nil
+}
+
+// EncodeChain serialises a leaf-first certificate chain for Bundle.CertificateChain.
+func EncodeChain(chain []Certificate) ([]byte, error) {
+	return json.Marshal(chain)
+}
+
+// DecodeChain parses Bundle.CertificateChain.
+func DecodeChain(data []byte) ([]Certificate, error) {
+	var chain []Certificate
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("attestation: decode chain: %w", err)
+	}
+	return chain, nil
+}
+
+// verifyChain walks a leaf-first chain and requires it to terminate at one of roots.
+func verifyChain(chain []Certificate, roots []Certificate, now time.Time) (Certificate, error) {
+	if len(chain) == 0 {
+		return Certificate{}, fmt.Errorf("%w: empty chain", ErrUntrustedChain)
+	}
+	for i, cert := range chain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return Certificate{}, fmt.Errorf("%w: %s outside validity period", ErrUntrustedChain, cert.Subject)
+		}
+
+		var issuer Certificate
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+			if issuer.Subject != cert.Issuer {
+				return Certificate{}, fmt.Errorf("%w: %s not issued by %s", ErrUntrustedChain, cert.Subject, issuer.Subject)
+			}
+		} else {
+			root, ok := findRoot(roots, cert.Issuer)
+			if !ok {
+				return Certificate{}, fmt.Errorf("%w: unknown root %s", ErrUntrustedChain, cert.Issuer)
+			}
+			issuer = root
+		}
+
+		if err := verifySignedBy(cert, issuer); err != nil {
+			return Certificate{}, err
+		}
+	}
+	return chain[0], nil
+}
+
+func verifySignedBy(cert, issuer Certificate) error {
+	scheme, err := sign.Lookup(issuer.Scheme)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedChain, err)
+	}
+	tbs, err := cert.tbs()
+	if err != nil {
+		return fmt.Errorf("attestation: encode certificate: %w", err)
+	}
+	if err := verifyWithContext(scheme, issuer.PublicKey, tbs, cert.Signature, certificateContext); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUntrustedChain, cert.Subject, err)
+	}
+	return nil
+}
+
+func findRoot(roots []Certificate, subject string) (Certificate, bool) {
+	for _, r := range roots {
+		if r.Subject == subject {
+			return r, true
+		}
+	}
+	return Certificate{}, false
+}
+
+func signWithContext(scheme sign.Scheme, privateKey, message []byte, context string) ([]byte, error) {
+	if cs, ok := scheme.(sign.ContextScheme); ok {
+		return cs.SignWithContext(privateKey, message, []byte(context))
+	}
+	return scheme.Sign(privateKey, message)
+}
+
+func verifyWithContext(scheme sign.Scheme, publicKey, message, signature []byte, context string) error {
+	if cs, ok := scheme.(sign.ContextScheme); ok {
+		return cs.VerifyWithContext(publicKey, message, []byte(context), signature)
+	}
+	return scheme.Verify(publicKey, message, signature)
+}
@@ -0,0 +1,160 @@
+package attestation
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+// Policy describes what the verifier accepts. Measurements maps register indices to
+// the expected hex-encoded digest; registers not listed are not checked.
+type Policy struct {
+	Version      string            `json:"version"`
+	Roots        []Certificate     `json:"roots"`
+	Measurements map[uint32]string `json:"measurements"`
+	MaxAge       Duration          `json:"max_age"`
+	Skew         Duration          `json:"skew"`
+}
+
+// Duration wraps time.Duration with string JSON encoding ("30s", "5m").
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadPolicy decodes a JSON policy document.
+func LoadPolicy(r io.Reader) (Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Policy{}, fmt.Errorf("attestation: decode policy: %w", err)
+	}
+	return p, nil
+}
+
+// LoadPolicyFile reads a JSON policy document from disk.
+func LoadPolicyFile(path string) (Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("attestation: open policy: %w", err)
+	}
+	defer f.Close()
+	return LoadPolicy(f)
+}
+
+// PolicyVerifier appraises bundles against a static Policy.
+type PolicyVerifier struct {
+	policy   Policy
+	expected map[uint32][]byte
+	now      func() time.Time
+}
+
+// NewVerifier builds a verifier for the given policy.
+func NewVerifier(p Policy) (*PolicyVerifier, error) {
+	if len(p.Roots) == 0 {
+		return nil, errors.New("attestation: policy requires at least one root")
+	}
+	if p.MaxAge <= 0 {
+		p.MaxAge = Duration(5 * time.Minute)
+	}
+	if p.Skew <= 0 {
+		p.Skew = Duration(30 * time.Second)
+	}
+	expected := make(map[uint32][]byte, len(p.Measurements))
+	for idx, digest := range p.Measurements {
+		raw, err := hex.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("attestation: measurement %d: %w", idx, err)
+		}
+		expected[idx] = raw
+	}
+	return &PolicyVerifier{policy: p, expected: expected, now: time.Now}, nil
+}
+
+// Verify checks chain, signature, nonce, freshness, policy version and measurements.
+func (v *PolicyVerifier) Verify(ctx context.Context, bundle Bundle, nonce []byte) (Result, error) {
+	if len(bundle.Evidence) == 0 {
+		return Result{}, ErrMissingEvidence
+	}
+	if bundle.PolicyVersion != v.policy.Version {
+		return Result{}, fmt.Errorf("%w: got %q want %q", ErrPolicyVersion, bundle.PolicyVersion, v.policy.Version)
+	}
+	if subtle.ConstantTimeCompare(bundle.Nonce, nonce) != 1 {
+		return Result{}, ErrNonceMismatch
+	}
+
+	now := v.now().UTC()
+	chain, err := DecodeChain(bundle.CertificateChain)
+	if err != nil {
+		return Result{}, err
+	}
+	leaf, err := verifyChain(chain, v.policy.Roots, now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	scheme, err := sign.Lookup(leaf.Scheme)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if err := verifyWithContext(scheme, leaf.PublicKey, bundle.Evidence, bundle.Signature, evidenceContext); err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+
+	var ev Evidence
+	if err := json.Unmarshal(bundle.Evidence, &ev); err != nil {
+		return Result{}, fmt.Errorf("attestation: decode evidence: %w", err)
+	}
+	if subtle.ConstantTimeCompare(ev.Nonce, nonce) != 1 {
+		return Result{}, ErrNonceMismatch
+	}
+	skew := time.Duration(v.policy.Skew)
+	if ev.Timestamp.After(now.Add(skew)) || now.Sub(ev.Timestamp) > time.Duration(v.policy.MaxAge) {
+		return Result{}, fmt.Errorf("%w: quoted at %s", ErrStaleEvidence, ev.Timestamp.Format(time.RFC3339))
+	}
+
+	indices := make([]uint32, 0, len(v.expected))
+	for idx := range v.expected {
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	for _, idx := range indices {
+		got, ok := ev.Measurements[idx]
+		if !ok || subtle.ConstantTimeCompare(got, v.expected[idx]) != 1 {
+			return Result{}, fmt.Errorf("%w: register %d", ErrMeasurementMismatch, idx)
+		}
+	}
+
+	return Result{
+		Subject:       leaf.Subject,
+		Platform:      ev.Platform,
+		PolicyVersion: bundle.PolicyVersion,
+		Measurements:  ev.Measurements,
+	}, nil
+}
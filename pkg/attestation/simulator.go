@@ -0,0 +1,150 @@
+package attestation
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+// Simulator is a software stand-in for a TPM/HSM quoting engine, intended for
+// development and tests only. Keys and certificates are derived from a seed so a
+// gateway and agent configured with the same seed agree on the root of trust.
+type Simulator struct {
+	scheme        *sign.MLDSA
+	root          Certificate
+	leaf          Certificate
+	leafPrivate   []byte
+	policyVersion string
+	measurements  map[uint32][]byte
+	now           func() time.Time
+}
+
+// simulatorValidity spans the lifetime of simulated certificates; fixed bounds keep
+// the derived certificates byte-identical across processes.
+var (
+	simulatorNotBefore = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	simulatorNotAfter  = time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// NewSimulator derives a root CA and attestation key from seed.
+func NewSimulator(seed []byte) (*Simulator, error) {
+	if len(seed) == 0 {
+		return nil, fmt.Errorf("attestation: simulator seed required")
+	}
+	scheme := sign.NewMLDSA65()
+
+	rootKeys, err := scheme.DeriveKeyPair(expandSeed("root", seed, scheme.SeedLength()))
+	if err != nil {
+		return nil, err
+	}
+	leafKeys, err := scheme.DeriveKeyPair(expandSeed("leaf", seed, scheme.SeedLength()))
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := IssueCertificate(Certificate{
+		Subject:   "qsafe-sim-root",
+		Scheme:    scheme.Name(),
+		PublicKey: rootKeys.Public,
+		NotBefore: simulatorNotBefore,
+		NotAfter:  simulatorNotAfter,
+	}, "qsafe-sim-root", scheme, rootKeys.Private)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := IssueCertificate(Certificate{
+		Subject:   "qsafe-sim-ak",
+		Scheme:    scheme.Name(),
+		PublicKey: leafKeys.Public,
+		NotBefore: simulatorNotBefore,
+		NotAfter:  simulatorNotAfter,
+	}, root.Subject, scheme, rootKeys.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Simulator{
+		scheme:        scheme,
+		root:          root,
+		leaf:          leaf,
+		leafPrivate:   leafKeys.Private,
+		policyVersion: "sim-v1",
+		measurements: map[uint32][]byte{
+			0: digest("qsafe-sim-firmware"),
+			7: digest("qsafe-sim-secure-boot"),
+		},
+		now: time.Now,
+	}, nil
+}
+
+// SetMeasurement overrides a simulated register value.
+func (s *Simulator) SetMeasurement(index uint32, value []byte) {
+	s.measurements[index] = append([]byte(nil), value...)
+}
+
+// Root returns the simulated root certificate.
+func (s *Simulator) Root() Certificate {
+	return s.root
+}
+
+// Policy returns a policy that trusts the simulator root and expects its current measurements.
+func (s *Simulator) Policy() Policy {
+	expected := make(map[uint32]string, len(s.measurements))
+	for idx, v := range s.measurements {
+		expected[idx] = hex.EncodeToString(v)
+	}
+	return Policy{
+		Version:      s.policyVersion,
+		Roots:        []Certificate{s.root},
+		Measurements: expected,
+	}
+}
+
+// Attest produces a signed quote over the current measurements and nonce.
+func (s *Simulator) Attest(ctx context.Context, nonce []byte) (Bundle, error) {
+	evidence, err := json.Marshal(Evidence{
+		Platform:     "software-simulator",
+		Measurements: s.measurements,
+		Nonce:        nonce,
+		Timestamp:    s.now().UTC(),
+	})
+	if err != nil {
+		return Bundle{}, fmt.Errorf("attestation: encode evidence: %w", err)
+	}
+	sig, err := signWithContext(s.scheme, s.leafPrivate, evidence, evidenceContext)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("attestation: sign evidence: %w", err)
+	}
+	chain, err := EncodeChain([]Certificate{s.leaf})
+	if err != nil {
+		return Bundle{}, err
+	}
+	return Bundle{
+		Evidence:         evidence,
+		Signature:        sig,
+		CertificateChain: chain,
+		PolicyVersion:    s.policyVersion,
+		Nonce:            append([]byte(nil), nonce...),
+	}, nil
+}
+
+func expandSeed(label string, seed []byte, size int) []byte {
+	h := blake3.New()
+	_, _ = h.Write([]byte("qsafe-attestation-sim:"))
+	_, _ = h.Write([]byte(label))
+	_, _ = h.Write(seed)
+	out := make([]byte, size)
+	_, _ = h.Digest().Read(out)
+	return out
+}
+
+func digest(s string) []byte {
+	sum := blake3.Sum256([]byte(s))
+	return sum[:]
+}
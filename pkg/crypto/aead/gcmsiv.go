@@ -0,0 +1,234 @@
+package aead
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	gcmSIVNonceSize = 12
+	gcmSIVTagSize   = 16
+	// gcmSIVMaxInput is the RFC 8452 limit on plaintext and additional data (2^36 bytes).
+	gcmSIVMaxInput = 1 << 36
+)
+
+var errOpen = errors.New("cipher: message authentication failed")
+
+// gcmSIV implements AES-GCM-SIV (RFC 8452). Each nonce derives its own POLYVAL and AES
+// keys from the key-generating key; the tag is computed over the plaintext and then
+// used as the CTR initial counter, so a repeated nonce only leaks message equality.
+type gcmSIV struct {
+	block   cipher.Block
+	keySize int
+}
+
+// NewGCMSIV returns AES-GCM-SIV keyed with a 16- or 32-byte key-generating key.
+func NewGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("aead: AES-GCM-SIV key must be 16 or 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &gcmSIV{block: block, keySize: len(key)}, nil
+}
+
+func (g *gcmSIV) NonceSize() int { return gcmSIVNonceSize }
+func (g *gcmSIV) Overhead() int  { return gcmSIVTagSize }
+
+func (g *gcmSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("aead: incorrect nonce length given to AES-GCM-SIV")
+	}
+	if uint64(len(plaintext)) > gcmSIVMaxInput || uint64(len(additionalData)) > gcmSIVMaxInput {
+		panic("aead: message too large for AES-GCM-SIV")
+	}
+	authKey, enc := g.deriveKeys(nonce)
+	tag := g.tag(authKey, enc, nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmSIVTagSize)
+	ctr(enc, tag, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (g *gcmSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("aead: incorrect nonce length given to AES-GCM-SIV")
+	}
+	if len(ciphertext) < gcmSIVTagSize || uint64(len(ciphertext)) > gcmSIVMaxInput+gcmSIVTagSize || uint64(len(additionalData)) > gcmSIVMaxInput {
+		return nil, errOpen
+	}
+	var tag [16]byte
+	copy(tag[:], ciphertext[len(ciphertext)-gcmSIVTagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-gcmSIVTagSize]
+
+	authKey, enc := g.deriveKeys(nonce)
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	ctr(enc, tag, out, ciphertext)
+	expected := g.tag(authKey, enc, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expected[:], tag[:]) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// deriveKeys computes the per-nonce message authentication key and encryption cipher
+// (RFC 8452 section 4): the first 8 bytes of AES(K, le32(i) || nonce) for each i.
+func (g *gcmSIV) deriveKeys(nonce []byte) ([16]byte, cipher.Block) {
+	var authKey [16]byte
+	encKey := make([]byte, g.keySize)
+	var in, out [16]byte
+	copy(in[4:], nonce)
+	for i := 0; i < 2+g.keySize/8; i++ {
+		binary.LittleEndian.PutUint32(in[:4], uint32(i))
+		g.block.Encrypt(out[:], in[:])
+		if i < 2 {
+			copy(authKey[i*8:], out[:8])
+		} else {
+			copy(encKey[(i-2)*8:], out[:8])
+		}
+	}
+	enc, err := aes.NewCipher(encKey)
+	clear(encKey)
+	if err != nil {
+		panic("aead: derived AES-GCM-SIV key rejected: " + err.Error())
+	}
+	return authKey, enc
+}
+
+func (g *gcmSIV) tag(authKey [16]byte, enc cipher.Block, nonce, plaintext, additionalData []byte) [16]byte {
+	p := newPolyval(authKey)
+	p.updatePadded(additionalData)
+	p.updatePadded(plaintext)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.update(lengths[:])
+
+	s := p.sum()
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+	enc.Encrypt(s[:], s[:])
+	return s
+}
+
+// ctr is AES-CTR with the tag as initial block (top bit set) and a 32-bit little-endian
+// counter in the first four bytes that wraps without carrying.
+func ctr(enc cipher.Block, tag [16]byte, dst, src []byte) {
+	counter := tag
+	counter[15] |= 0x80
+	var stream [16]byte
+	for len(src) > 0 {
+		enc.Encrypt(stream[:], counter[:])
+		n := subtle.XORBytes(dst, src, stream[:])
+		dst, src = dst[n:], src[n:]
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+// polyval is the RFC 8452 universal hash. Field elements are little-endian, so bit i of
+// the 128-bit value is the coefficient of x^i and no bit reflection is needed.
+type polyval struct {
+	h0, h1 uint64
+	s0, s1 uint64
+}
+
+func newPolyval(key [16]byte) *polyval {
+	return &polyval{h0: binary.LittleEndian.Uint64(key[:8]), h1: binary.LittleEndian.Uint64(key[8:])}
+}
+
+// update absorbs whole 16-byte blocks.
+func (p *polyval) update(blocks []byte) {
+	for len(blocks) >= 16 {
+		p.s0 ^= binary.LittleEndian.Uint64(blocks[:8])
+		p.s1 ^= binary.LittleEndian.Uint64(blocks[8:16])
+		p.s0, p.s1 = polyvalDot(p.s0, p.s1, p.h0, p.h1)
+		blocks = blocks[16:]
+	}
+}
+
+// updatePadded absorbs data, zero-padding the final partial block.
+func (p *polyval) updatePadded(data []byte) {
+	full := len(data) &^ 15
+	p.update(data[:full])
+	if full < len(data) {
+		var last [16]byte
+		copy(last[:], data[full:])
+		p.update(last[:])
+	}
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+	binary.LittleEndian.PutUint64(out[:8], p.s0)
+	binary.LittleEndian.PutUint64(out[8:], p.s1)
+	return out
+}
+
+// polyvalDot returns a*b*x^-128 modulo x^128 + x^127 + x^126 + x^121 + 1.
+func polyvalDot(a0, a1, b0, b1 uint64) (uint64, uint64) {
+	lo0, lo1 := clmul(a0, b0)
+	hi0, hi1 := clmul(a1, b1)
+	m0, m1 := clmul(a0, b1)
+	n0, n1 := clmul(a1, b0)
+	p0 := lo0
+	p1 := lo1 ^ m0 ^ n0
+	p2 := hi0 ^ m1 ^ n1
+	p3 := hi1
+
+	// Montgomery reduction: add multiples of the modulus that clear the low two words,
+	// then drop them (the division by x^128).
+	p1 ^= p0<<63 ^ p0<<62 ^ p0<<57
+	p2 ^= p0 ^ p0>>1 ^ p0>>2 ^ p0>>7
+	p2 ^= p1<<63 ^ p1<<62 ^ p1<<57
+	p3 ^= p1 ^ p1>>1 ^ p1>>2 ^ p1>>7
+	return p2, p3
+}
+
+// clmul is a constant-time 64x64 carry-less multiplication returning the low and high
+// words of the product.
+func clmul(x, y uint64) (uint64, uint64) {
+	lo := bmul64(x, y)
+	hi := bits.Reverse64(bmul64(bits.Reverse64(x), bits.Reverse64(y))) >> 1
+	return lo, hi
+}
+
+// bmul64 returns the low 64 bits of the carry-less product of x and y using integer
+// multiplications on operands with holes, so carries never reach a bit that is kept
+// (the technique from BearSSL's ghash_ctmul64).
+func bmul64(x, y uint64) uint64 {
+	const (
+		m0 = 0x1111111111111111
+		m1 = 0x2222222222222222
+		m2 = 0x4444444444444444
+		m3 = 0x8888888888888888
+	)
+	x0, x1, x2, x3 := x&m0, x&m1, x&m2, x&m3
+	y0, y1, y2, y3 := y&m0, y&m1, y&m2, y&m3
+	z0 := (x0 * y0) ^ (x1 * y3) ^ (x2 * y2) ^ (x3 * y1)
+	z1 := (x0 * y1) ^ (x1 * y0) ^ (x2 * y3) ^ (x3 * y2)
+	z2 := (x0 * y2) ^ (x1 * y1) ^ (x2 * y0) ^ (x3 * y3)
+	z3 := (x0 * y3) ^ (x1 * y2) ^ (x2 * y1) ^ (x3 * y0)
+	return z0&m0 | z1&m1 | z2&m2 | z3&m3
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,58 @@
+package aead
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPolyvalVector(t *testing.T) {
+	// RFC 8452, Appendix A.
+	var key [16]byte
+	copy(key[:], mustHex(t, "25629347589242761d31f826ba4b757b"))
+	p := newPolyval(key)
+	p.update(mustHex(t, "4f4f95668c83dfb6401762bb2d01a262d1a24ddd2721d006bbe45f20d3c9f362"))
+	sum := p.sum()
+	if got := hex.EncodeToString(sum[:]); got != "f7a3b47b846119fae5b7866cf5e5b77e" {
+		t.Fatalf("POLYVAL = %s", got)
+	}
+}
+
+func TestGCMSIVVectors(t *testing.T) {
+	// RFC 8452, Appendix C.1 (AES-128) and C.2 (AES-256).
+	vectors := []struct {
+		key, nonce, plaintext, aad, result string
+	}{
+		{"01000000000000000000000000000000", "030000000000000000000000", "", "", "dc20e2d83f25705bb49e439eca56de25"},
+		{"01000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "", "b5d839330ac7b786578782fff6013b815b287c22493a364c"},
+		{"01000000000000000000000000000000", "030000000000000000000000", "0200000000000000", "01", "1e6daba35669f4273b0a1a2560969cdf790d99759abd1508"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "", "07f5f4169bbf55a8400cd47ea6fd400f"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "", "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "010000000000000000000000", "", "9aab2aeb3faa0a34aea8e2b18ca50da9ae6559e48fd10f6e5c9ca17e"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "0100000000000000000000000000000002000000000000000000000000000000", "", "4a6a9db4c8c6549201b9edb53006cba821ec9cf850948a7c86c68ac7539d027fe819e63abcd020b006a976397632eb5d"},
+	}
+	for i, v := range vectors {
+		a, err := NewGCMSIV(mustHex(t, v.key))
+		if err != nil {
+			t.Fatalf("vector %d: %v", i, err)
+		}
+		nonce, plaintext, aad := mustHex(t, v.nonce), mustHex(t, v.plaintext), mustHex(t, v.aad)
+		sealed := a.Seal(nil, nonce, plaintext, aad)
+		if got := hex.EncodeToString(sealed); got != v.result {
+			t.Fatalf("vector %d: seal\n got %s\nwant %s", i, got, v.result)
+		}
+		opened, err := a.Open(nil, nonce, sealed, aad)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("vector %d: open: %x, %v", i, opened, err)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package aead
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrUnknownSuite indicates no suite is registered under the requested name.
+var ErrUnknownSuite = errors.New("aead: unknown suite")
+
+// Suite describes an AEAD construction usable for session traffic.
+type Suite interface {
+	Name() string
+	KeySize() int
+	NonceSize() int
+	New(key []byte) (cipher.AEAD, error)
+}
+
+// Factory constructs a fresh Suite instance.
+type Factory func() Suite
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"xchacha20poly1305": func() Suite { return XChaCha20Poly1305() },
+		"chacha20poly1305":  func() Suite { return ChaCha20Poly1305() },
+		"aes256gcm":         func() Suite { return AES256GCM() },
+		"aes256gcmsiv":      func() Suite { return AES256GCMSIV() },
+	}
+)
+
+// Register makes a suite available under its canonical name, replacing any previous entry.
+func Register(name string, factory Factory) error {
+	if name == "" {
+		return errors.New("aead: suite name required")
+	}
+	if factory == nil {
+		return fmt.Errorf("aead: nil factory for %s", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+	return nil
+}
+
+// Lookup returns a new instance of the suite registered under name.
+func Lookup(name string) (Suite, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSuite, name)
+	}
+	return factory(), nil
+}
+
+// Names lists every registered suite name in lexical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for name := range registry {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+type suite struct {
+	name      string
+	keySize   int
+	nonceSize int
+	build     func(key []byte) (cipher.AEAD, error)
+}
+
+func (s suite) Name() string   { return s.name }
+func (s suite) KeySize() int   { return s.keySize }
+func (s suite) NonceSize() int { return s.nonceSize }
+
+func (s suite) New(key []byte) (cipher.AEAD, error) {
+	if len(key) != s.keySize {
+		return nil, fmt.Errorf("aead: %s key must be %d bytes, got %d", s.name, s.keySize, len(key))
+	}
+	return s.build(key)
+}
+
+// XChaCha20Poly1305 has a 192-bit nonce, large enough to pick at random.
+func XChaCha20Poly1305() Suite {
+	return suite{name: "xchacha20poly1305", keySize: chacha20poly1305.KeySize, nonceSize: chacha20poly1305.NonceSizeX, build: chacha20poly1305.NewX}
+}
+
+// ChaCha20Poly1305 is RFC 8439 ChaCha20-Poly1305 with a 96-bit nonce.
+func ChaCha20Poly1305() Suite {
+	return suite{name: "chacha20poly1305", keySize: chacha20poly1305.KeySize, nonceSize: chacha20poly1305.NonceSize, build: chacha20poly1305.New}
+}
+
+// AES256GCM is AES-256 in GCM mode with a 96-bit nonce, for deployments that need a
+// FIPS-approved AEAD.
+func AES256GCM() Suite {
+	return suite{name: "aes256gcm", keySize: 32, nonceSize: 12, build: func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}}
+}
+
+// AES256GCMSIV is RFC 8452 AES-256-GCM-SIV: repeating a nonce reveals only whether two
+// messages are identical rather than breaking confidentiality and integrity.
+func AES256GCMSIV() Suite {
+	return suite{name: "aes256gcmsiv", keySize: 32, nonceSize: gcmSIVNonceSize, build: NewGCMSIV}
+}
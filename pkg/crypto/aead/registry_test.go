@@ -0,0 +1,47 @@
+package aead
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRegistrySuitesRoundTrip(t *testing.T) {
+	for _, name := range Names() {
+		suite, err := Lookup(name)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		if suite.Name() != name {
+			t.Fatalf("suite registered as %s reports %s", name, suite.Name())
+		}
+		if _, err := suite.New(make([]byte, suite.KeySize()-1)); err == nil {
+			t.Fatalf("%s: short key accepted", name)
+		}
+
+		a, err := suite.New(bytes.Repeat([]byte{0x42}, suite.KeySize()))
+		if err != nil {
+			t.Fatalf("%s: new: %v", name, err)
+		}
+		if a.NonceSize() != suite.NonceSize() {
+			t.Fatalf("%s: nonce size %d, suite reports %d", name, a.NonceSize(), suite.NonceSize())
+		}
+		nonce := make([]byte, a.NonceSize())
+		plaintext := bytes.Repeat([]byte("qsafe"), 13)
+		sealed := a.Seal(nil, nonce, plaintext, []byte("aad"))
+		opened, err := a.Open(nil, nonce, sealed, []byte("aad"))
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("%s: round trip failed: %v", name, err)
+		}
+		sealed[3] ^= 0x01
+		if _, err := a.Open(nil, nonce, sealed, []byte("aad")); err == nil {
+			t.Fatalf("%s: tampered ciphertext accepted", name)
+		}
+	}
+}
+
+func TestRegistryUnknownSuite(t *testing.T) {
+	if _, err := Lookup("aes-gcm"); !errors.Is(err, ErrUnknownSuite) {
+		t.Fatalf("expected ErrUnknownSuite, got %v", err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/cloudflare/circl/kem"
 	"github.com/cloudflare/circl/kem/kyber/kyber768"
+
+	"github.com/example/qsafe/pkg/crypto/secret"
 )
 
 // KeyPair bundles public/private keys in raw encoded form.
@@ -13,6 +15,12 @@ type KeyPair struct {
 	Private []byte
 }
 
+// Wipe zeroes the private key in place. Copies of the key pair share it, so they are
+// wiped too.
+func (k KeyPair) Wipe() {
+	clear(k.Private)
+}
+
 // Suite describes the operations all KEM providers must expose.
 type Suite interface {
 	Name() string
@@ -21,11 +29,14 @@ type Suite interface {
 	CiphertextLength() int
 	SharedKeyLength() int
 	GenerateKeyPair() (KeyPair, error)
-	Encapsulate(publicKey []byte) (ciphertext []byte, sharedSecret []byte, err error)
-	Decapsulate(privateKey, ciphertext []byte) (sharedSecret []byte, err error)
+	// Encapsulate and Decapsulate hand the shared secret to the caller, who wipes it
+	// once it has been used.
+	Encapsulate(publicKey []byte) (ciphertext []byte, sharedSecret *secret.Buffer, err error)
+	Decapsulate(privateKey, ciphertext []byte) (sharedSecret *secret.Buffer, err error)
 }
 
-// Kyber768 implements ML-KEM-768 via Cloudflare CIRCL.
+// Kyber768 implements round-3 Kyber768 via Cloudflare CIRCL. It predates FIPS 203 and
+// is not interoperable with ML-KEM-768; prefer NewMLKEM768 for new deployments.
 type Kyber768 struct {
 	scheme kem.Scheme
 }
@@ -76,7 +87,7 @@ func (k *Kyber768) GenerateKeyPair() (KeyPair, error) {
 	return KeyPair{Public: pubBytes, Private: privBytes}, nil
 }
 
-func (k *Kyber768) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+func (k *Kyber768) Encapsulate(publicKey []byte) ([]byte, *secret.Buffer, error) {
 	pub, err := k.scheme.UnmarshalBinaryPublicKey(publicKey)
 	if err != nil {
 		return nil, nil, fmt.Errorf("kyber: parse public key: %w", err)
@@ -86,10 +97,10 @@ func (k *Kyber768) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("kyber: encapsulate: %w", err)
 	}
-	return ct, ss, nil
+	return ct, secret.Take(ss), nil
 }
 
-func (k *Kyber768) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
+func (k *Kyber768) Decapsulate(privateKey, ciphertext []byte) (*secret.Buffer, error) {
 	priv, err := k.scheme.UnmarshalBinaryPrivateKey(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("kyber: parse private key: %w", err)
@@ -99,5 +110,5 @@ func (k *Kyber768) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("kyber: decapsulate: %w", err)
 	}
-	return shared, nil
+	return secret.Take(shared), nil
 }
@@ -0,0 +1,97 @@
+package kem
+
+import (
+	"fmt"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem1024"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem512"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+
+	"github.com/example/qsafe/pkg/crypto/secret"
+)
+
+// MLKEM implements FIPS 203 ML-KEM via Cloudflare CIRCL.
+type MLKEM struct {
+	scheme kem.Scheme
+}
+
+// NewMLKEM512 constructs an ML-KEM-512 suite (NIST security category 1).
+func NewMLKEM512() *MLKEM {
+	return &MLKEM{scheme: mlkem512.Scheme()}
+}
+
+// NewMLKEM768 constructs an ML-KEM-768 suite (NIST security category 3).
+func NewMLKEM768() *MLKEM {
+	return &MLKEM{scheme: mlkem768.Scheme()}
+}
+
+// NewMLKEM1024 constructs an ML-KEM-1024 suite (NIST security category 5).
+func NewMLKEM1024() *MLKEM {
+	return &MLKEM{scheme: mlkem1024.Scheme()}
+}
+
+func (m *MLKEM) Name() string {
+	return m.scheme.Name()
+}
+
+func (m *MLKEM) PublicKeyLength() int {
+	return m.scheme.PublicKeySize()
+}
+
+func (m *MLKEM) PrivateKeyLength() int {
+	return m.scheme.PrivateKeySize()
+}
+
+func (m *MLKEM) CiphertextLength() int {
+	return m.scheme.CiphertextSize()
+}
+
+func (m *MLKEM) SharedKeyLength() int {
+	return m.scheme.SharedKeySize()
+}
+
+func (m *MLKEM) GenerateKeyPair() (KeyPair, error) {
+	pub, priv, err := m.scheme.GenerateKeyPair()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mlkem: generate keypair: %w", err)
+	}
+
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mlkem: marshal public: %w", err)
+	}
+
+	privBytes, err := priv.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mlkem: marshal private: %w", err)
+	}
+
+	return KeyPair{Public: pubBytes, Private: privBytes}, nil
+}
+
+func (m *MLKEM) Encapsulate(publicKey []byte) ([]byte, *secret.Buffer, error) {
+	pub, err := m.scheme.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mlkem: parse public key: %w", err)
+	}
+
+	ct, ss, err := m.scheme.Encapsulate(pub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mlkem: encapsulate: %w", err)
+	}
+	return ct, secret.Take(ss), nil
+}
+
+func (m *MLKEM) Decapsulate(privateKey, ciphertext []byte) (*secret.Buffer, error) {
+	priv, err := m.scheme.UnmarshalBinaryPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("mlkem: parse private key: %w", err)
+	}
+
+	shared, err := m.scheme.Decapsulate(priv, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("mlkem: decapsulate: %w", err)
+	}
+	return secret.Take(shared), nil
+}
@@ -0,0 +1,61 @@
+package kem
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownSuite indicates no suite is registered under the requested name.
+var ErrUnknownSuite = errors.New("kem: unknown suite")
+
+// Factory constructs a fresh Suite instance.
+type Factory func() Suite
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"ML-KEM-512":  func() Suite { return NewMLKEM512() },
+		"ML-KEM-768":  func() Suite { return NewMLKEM768() },
+		"ML-KEM-1024": func() Suite { return NewMLKEM1024() },
+		"Kyber768":    func() Suite { return NewKyber768() },
+	}
+)
+
+// Register makes a suite available under its canonical name, replacing any previous entry.
+func Register(name string, factory Factory) error {
+	if name == "" {
+		return errors.New("kem: suite name required")
+	}
+	if factory == nil {
+		return fmt.Errorf("kem: nil factory for %s", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+	return nil
+}
+
+// Lookup returns a new instance of the suite registered under name.
+func Lookup(name string) (Suite, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSuite, name)
+	}
+	return factory(), nil
+}
+
+// Names lists every registered suite name in lexical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for name := range registry {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
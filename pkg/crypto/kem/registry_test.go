@@ -0,0 +1,54 @@
+package kem
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRegistrySuitesRoundTrip(t *testing.T) {
+	for _, name := range Names() {
+		suite, err := Lookup(name)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		if suite.Name() != name {
+			t.Fatalf("suite registered as %s reports %s", name, suite.Name())
+		}
+
+		kp, err := suite.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("%s: generate: %v", name, err)
+		}
+		if len(kp.Public) != suite.PublicKeyLength() || len(kp.Private) != suite.PrivateKeyLength() {
+			t.Fatalf("%s: unexpected key lengths", name)
+		}
+
+		ct, ss, err := suite.Encapsulate(kp.Public)
+		if err != nil {
+			t.Fatalf("%s: encapsulate: %v", name, err)
+		}
+		if len(ct) != suite.CiphertextLength() {
+			t.Fatalf("%s: ciphertext length %d", name, len(ct))
+		}
+
+		got, err := suite.Decapsulate(kp.Private, ct)
+		if err != nil {
+			t.Fatalf("%s: decapsulate: %v", name, err)
+		}
+		if !bytes.Equal(ss.Bytes(), got.Bytes()) {
+			t.Fatalf("%s: shared secret mismatch", name)
+		}
+		ss.Wipe()
+		kp.Wipe()
+		if !bytes.Equal(kp.Private, make([]byte, len(kp.Private))) {
+			t.Fatalf("%s: private key survived Wipe", name)
+		}
+	}
+}
+
+func TestRegistryUnknownSuite(t *testing.T) {
+	if _, err := Lookup("ML-KEM-2048"); !errors.Is(err, ErrUnknownSuite) {
+		t.Fatalf("expected ErrUnknownSuite, got %v", err)
+	}
+}
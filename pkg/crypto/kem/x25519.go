@@ -0,0 +1,76 @@
+package kem
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/example/qsafe/pkg/crypto/secret"
+)
+
+// X25519 adapts ephemeral-ephemeral X25519 Diffie-Hellman to the Suite interface.
+// Encapsulate generates a fresh ephemeral key against the peer share and returns the
+// ephemeral public key as the "ciphertext", so hybrid handshakes can treat the
+// classical exchange exactly like a KEM.
+type X25519 struct {
+	curve ecdh.Curve
+}
+
+// NewX25519 constructs an X25519 suite instance.
+func NewX25519() *X25519 {
+	return &X25519{curve: ecdh.X25519()}
+}
+
+func (x *X25519) Name() string { return "X25519" }
+
+func (x *X25519) PublicKeyLength() int { return 32 }
+
+func (x *X25519) PrivateKeyLength() int { return 32 }
+
+func (x *X25519) CiphertextLength() int { return 32 }
+
+func (x *X25519) SharedKeyLength() int { return 32 }
+
+func (x *X25519) GenerateKeyPair() (KeyPair, error) {
+	priv, err := x.curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("x25519: generate keypair: %w", err)
+	}
+	return KeyPair{Public: priv.PublicKey().Bytes(), Private: priv.Bytes()}, nil
+}
+
+func (x *X25519) Encapsulate(publicKey []byte) ([]byte, *secret.Buffer, error) {
+	peer, err := x.curve.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("x25519: parse public key: %w", err)
+	}
+
+	eph, err := x.curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("x25519: generate ephemeral: %w", err)
+	}
+
+	shared, err := eph.ECDH(peer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("x25519: encapsulate: %w", err)
+	}
+	return eph.PublicKey().Bytes(), secret.Take(shared), nil
+}
+
+func (x *X25519) Decapsulate(privateKey, ciphertext []byte) (*secret.Buffer, error) {
+	priv, err := x.curve.NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("x25519: parse private key: %w", err)
+	}
+
+	peer, err := x.curve.NewPublicKey(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("x25519: parse peer share: %w", err)
+	}
+
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("x25519: decapsulate: %w", err)
+	}
+	return secret.Take(shared), nil
+}
@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,8 @@ import (
 	"github.com/zeebo/blake3"
 	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/sha3"
+
+	"github.com/example/qsafe/pkg/crypto/secret"
 )
 
 // Config tunes key derivation characteristics.
@@ -21,18 +24,38 @@ type Config struct {
 	Salt             []byte
 }
 
-// Keys represents derived symmetric materials.
+// Keys represents derived symmetric materials. The secret fields are buffers that a
+// copy of Keys shares, so whoever holds the last copy calls Wipe; use Clone to hand
+// out keys with an independent lifetime.
 type Keys struct {
 	SessionID      []byte
-	ClientToServer []byte
-	ServerToClient []byte
-	ExporterSecret []byte
+	ClientToServer *secret.Buffer
+	ServerToClient *secret.Buffer
+	ExporterSecret *secret.Buffer
 	TranscriptHash []byte
-	SharedSecret   []byte
+	SharedSecret   *secret.Buffer
 	EstablishedAt  time.Time
 	NextRotation   time.Time
 }
 
+// Clone returns keys whose secrets are independent copies of k's.
+func (k Keys) Clone() Keys {
+	out := k
+	out.ClientToServer = k.ClientToServer.Clone()
+	out.ServerToClient = k.ServerToClient.Clone()
+	out.ExporterSecret = k.ExporterSecret.Clone()
+	out.SharedSecret = k.SharedSecret.Clone()
+	return out
+}
+
+// Wipe zeroes every secret in k, including those of any copy sharing its buffers.
+func (k Keys) Wipe() {
+	k.ClientToServer.Wipe()
+	k.ServerToClient.Wipe()
+	k.ExporterSecret.Wipe()
+	k.SharedSecret.Wipe()
+}
+
 // Derive uses HKDF-SHA3 to produce symmetric keys tied to the transcript hash.
 func Derive(sharedSecret, transcriptHash []byte, cfg Config) (Keys, error) {
 	var zero Keys
@@ -59,18 +82,24 @@ func Derive(sharedSecret, transcriptHash []byte, cfg Config) (Keys, error) {
 	info := buildInfo(cfg.Mode, transcriptHash)
 	kdf := hkdf.New(hash, sharedSecret, cfg.Salt, info)
 
-	clientKey := make([]byte, cfg.ClientKeySize)
-	if err := readFull(kdf, clientKey); err != nil {
+	clientKey := secret.New(cfg.ClientKeySize)
+	serverKey := secret.New(cfg.ServerKeySize)
+	exporter := secret.New(cfg.ExporterSize)
+	wipe := func() {
+		clientKey.Wipe()
+		serverKey.Wipe()
+		exporter.Wipe()
+	}
+	if err := readFull(kdf, clientKey.Bytes()); err != nil {
+		wipe()
 		return zero, fmt.Errorf("scheduler: derive client key: %w", err)
 	}
-
-	serverKey := make([]byte, cfg.ServerKeySize)
-	if err := readFull(kdf, serverKey); err != nil {
+	if err := readFull(kdf, serverKey.Bytes()); err != nil {
+		wipe()
 		return zero, fmt.Errorf("scheduler: derive server key: %w", err)
 	}
-
-	exporter := make([]byte, cfg.ExporterSize)
-	if err := readFull(kdf, exporter); err != nil {
+	if err := readFull(kdf, exporter.Bytes()); err != nil {
+		wipe()
 		return zero, fmt.Errorf("scheduler: derive exporter: %w", err)
 	}
 
@@ -83,7 +112,7 @@ func Derive(sharedSecret, transcriptHash []byte, cfg Config) (Keys, error) {
 		ServerToClient: serverKey,
 		ExporterSecret: exporter,
 		TranscriptHash: transcriptHash,
-		SharedSecret:   append([]byte(nil), sharedSecret...),
+		SharedSecret:   secret.From(sharedSecret),
 		EstablishedAt:  now,
 		NextRotation:   now.Add(cfg.RotationInterval),
 	}, nil
@@ -117,6 +146,35 @@ func deriveSessionID(transcriptHash, sharedSecret []byte) []byte {
 	return h.Sum(nil)
 }
 
+// Combine folds a post-quantum and a classical shared secret into one hybrid secret.
+// Both secrets and the public key exchange artefacts are length-prefixed into a
+// domain-separated SHA3-256 hash, so the output stays secret as long as either
+// input does.
+func Combine(pqSecret, classicalSecret []byte, publicInputs ...[]byte) (*secret.Buffer, error) {
+	if len(pqSecret) == 0 {
+		return nil, errors.New("scheduler: post-quantum secret required")
+	}
+	if len(classicalSecret) == 0 {
+		return nil, errors.New("scheduler: classical secret required")
+	}
+
+	h := sha3.New256()
+	_, _ = h.Write([]byte("qsafe-hybrid-combiner"))
+	writeLengthPrefixed(h, pqSecret)
+	writeLengthPrefixed(h, classicalSecret)
+	for _, in := range publicInputs {
+		writeLengthPrefixed(h, in)
+	}
+	return secret.Take(h.Sum(nil)), nil
+}
+
+func writeLengthPrefixed(w io.Writer, data []byte) {
+	var lenBuf [8]byte
+	binary.BigEndian.PutUint64(lenBuf[:], uint64(len(data)))
+	_, _ = w.Write(lenBuf[:])
+	_, _ = w.Write(data)
+}
+
 // Confirm computes a key-confirmation tag bound to the transcript hash.
 func Confirm(key, transcriptHash []byte) ([]byte, error) {
 	if len(key) == 0 {
@@ -132,3 +190,71 @@ func Confirm(key, transcriptHash []byte) ([]byte, error) {
 	}
 	return hasher.Sum(nil), nil
 }
+
+// ResumptionSecret derives the pre-shared secret carried in a resumption ticket from the
+// exporter secret, so resumed sessions never reuse the original traffic keys.
+func ResumptionSecret(keys Keys) ([]byte, error) {
+	if keys.ExporterSecret.Len() == 0 {
+		return nil, errors.New("scheduler: exporter secret required")
+	}
+	info := make([]byte, 0, len("qsafe-resumption")+1+len(keys.TranscriptHash))
+	info = append(info, []byte("qsafe-resumption")...)
+	info = append(info, 0)
+	info = append(info, keys.TranscriptHash...)
+	out := make([]byte, 32)
+	if err := readFull(hkdf.New(sha3.New512, keys.ExporterSecret.Bytes(), nil, info), out); err != nil {
+		return nil, fmt.Errorf("scheduler: derive resumption secret: %w", err)
+	}
+	return out, nil
+}
+
+// MaxExportLength bounds a single exporter output (the HKDF-SHA3-512 output limit).
+const MaxExportLength = 255 * 64
+
+// Export derives length bytes of keying material from the exporter secret in the manner
+// of RFC 5705. The label, context and length are all bound, so changing any of them
+// yields an independent output; as in TLS 1.3, a nil context equals an empty one.
+func Export(keys Keys, label string, context []byte, length int) ([]byte, error) {
+	if keys.ExporterSecret.Len() == 0 {
+		return nil, errors.New("scheduler: exporter secret required")
+	}
+	if label == "" {
+		return nil, errors.New("scheduler: exporter label required")
+	}
+	if length <= 0 || length > MaxExportLength {
+		return nil, fmt.Errorf("scheduler: exporter length %d out of range", length)
+	}
+	info := make([]byte, 0, len("qsafe-exporter")+len(label)+len(context)+21)
+	info = append(info, []byte("qsafe-exporter")...)
+	info = append(info, 0)
+	info = binary.BigEndian.AppendUint64(info, uint64(len(label)))
+	info = append(info, label...)
+	info = binary.BigEndian.AppendUint64(info, uint64(len(context)))
+	info = append(info, context...)
+	info = binary.BigEndian.AppendUint32(info, uint32(length))
+	out := make([]byte, length)
+	if err := readFull(hkdf.New(sha3.New512, keys.ExporterSecret.Bytes(), nil, info), out); err != nil {
+		return nil, fmt.Errorf("scheduler: export: %w", err)
+	}
+	return out, nil
+}
+
+// NextTrafficKey ratchets a directional traffic key forward to epoch, in the manner of a
+// TLS 1.3 KeyUpdate. The output is the same length as the input and the old key cannot
+// be recovered from it; each direction ratchets independently. The caller wipes current
+// once it has switched to the new key.
+func NextTrafficKey(current *secret.Buffer, epoch uint64) (*secret.Buffer, error) {
+	if current.Len() == 0 {
+		return nil, errors.New("scheduler: traffic key empty")
+	}
+	info := make([]byte, 0, len("qsafe-rekey")+9)
+	info = append(info, []byte("qsafe-rekey")...)
+	info = append(info, 0)
+	info = binary.BigEndian.AppendUint64(info, epoch)
+	next := secret.New(current.Len())
+	if err := readFull(hkdf.New(sha3.New512, current.Bytes(), nil, info), next.Bytes()); err != nil {
+		next.Wipe()
+		return nil, fmt.Errorf("scheduler: derive epoch %d key: %w", epoch, err)
+	}
+	return next, nil
+}
@@ -0,0 +1,108 @@
+// Package secret holds key material in buffers that can be wiped once they are no
+// longer needed and that never print or serialise their contents by accident.
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// ErrNotSerialisable is returned when a Buffer is passed to an encoder.
+var ErrNotSerialisable = errors.New("secret: buffer is not serialisable")
+
+const redacted = "[REDACTED]"
+
+// Buffer owns a byte slice of secret material. It is used by pointer: copying a Buffer
+// value is flagged by go vet, and Clone is the way to take an independent copy. All
+// methods accept a nil receiver, which behaves as an empty, already wiped buffer.
+type Buffer struct {
+	_     noCopy
+	b     []byte
+	wiped bool
+}
+
+// New returns a zeroed buffer of n bytes.
+func New(n int) *Buffer {
+	return &Buffer{b: make([]byte, n)}
+}
+
+// From copies b into a new buffer; the caller keeps ownership of b.
+func From(b []byte) *Buffer {
+	return &Buffer{b: append(make([]byte, 0, len(b)), b...)}
+}
+
+// Take wraps b without copying it. The buffer now owns b, and wiping the buffer zeroes
+// it, so the caller must not keep using b.
+func Take(b []byte) *Buffer {
+	return &Buffer{b: b}
+}
+
+// Bytes returns the underlying slice, not a copy, for passing to primitives. It is nil
+// once the buffer is wiped and must not be retained past the buffer's lifetime.
+func (s *Buffer) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.b
+}
+
+// Len returns the number of secret bytes held.
+func (s *Buffer) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.b)
+}
+
+// Clone returns an independent copy. Cloning a wiped or nil buffer yields nil.
+func (s *Buffer) Clone() *Buffer {
+	if s == nil || s.wiped {
+		return nil
+	}
+	return From(s.b)
+}
+
+// Wipe zeroes the secret and releases it. Wiping twice is harmless.
+func (s *Buffer) Wipe() {
+	if s == nil {
+		return
+	}
+	clear(s.b)
+	runtime.KeepAlive(s.b)
+	s.b = nil
+	s.wiped = true
+}
+
+// Wiped reports whether Wipe has run. It exists so tests can assert that an owner
+// released its secrets.
+func (s *Buffer) Wiped() bool {
+	return s == nil || s.wiped
+}
+
+// String never reveals the contents.
+func (s *Buffer) String() string {
+	return redacted
+}
+
+// Format redacts the buffer under every verb, including %x and %#v.
+func (s *Buffer) Format(f fmt.State, verb rune) {
+	_, _ = f.Write([]byte(redacted))
+}
+
+// MarshalJSON refuses to encode the buffer, so secrets cannot leak through a struct
+// that is logged or persisted as JSON.
+func (s *Buffer) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerialisable
+}
+
+// MarshalText refuses to encode the buffer, for the same reason as MarshalJSON.
+func (s *Buffer) MarshalText() ([]byte, error) {
+	return nil, ErrNotSerialisable
+}
+
+// noCopy makes go vet's copylocks check report Buffer values being copied.
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
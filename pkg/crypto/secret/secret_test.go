@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBufferWipe(t *testing.T) {
+	raw := []byte{1, 2, 3, 4}
+	s := Take(raw)
+	clone := s.Clone()
+	if s.Wiped() || s.Len() != 4 {
+		t.Fatalf("fresh buffer: wiped=%v len=%d", s.Wiped(), s.Len())
+	}
+	s.Wipe()
+	if !s.Wiped() || s.Bytes() != nil || s.Len() != 0 {
+		t.Fatal("buffer still holds material after Wipe")
+	}
+	if !bytes.Equal(raw, make([]byte, 4)) {
+		t.Fatalf("backing array not zeroed: %x", raw)
+	}
+	if !bytes.Equal(clone.Bytes(), []byte{1, 2, 3, 4}) {
+		t.Fatal("clone shared memory with the wiped buffer")
+	}
+	s.Wipe()
+	if s.Clone() != nil {
+		t.Fatal("clone of a wiped buffer should be nil")
+	}
+
+	var nilBuf *Buffer
+	nilBuf.Wipe()
+	if !nilBuf.Wiped() || nilBuf.Bytes() != nil {
+		t.Fatal("nil buffer should behave as wiped")
+	}
+}
+
+func TestBufferRedacted(t *testing.T) {
+	s := From([]byte("hunter2"))
+	for _, verb := range []string{"%v", "%s", "%x", "%#v", "%+v", "%q"} {
+		if out := fmt.Sprintf(verb, s); out != redacted {
+			t.Fatalf("%s printed %q", verb, out)
+		}
+	}
+	wrapped := struct{ Key *Buffer }{s}
+	if out := fmt.Sprintf("%+v", wrapped); bytes.Contains([]byte(out), []byte("hunter2")) {
+		t.Fatalf("struct formatting leaked the secret: %s", out)
+	}
+	if _, err := json.Marshal(wrapped); !errors.Is(err, ErrNotSerialisable) {
+		t.Fatalf("expected JSON encoding to be refused, got %v", err)
+	}
+}
@@ -1,4 +1,3 @@
-
 package sign
 
 import (
@@ -13,6 +12,12 @@ type KeyPair struct {
 	Private []byte
 }
 
+// Wipe zeroes the private key in place. Copies of the key pair share it, so they are
+// wiped too.
+func (k KeyPair) Wipe() {
+	clear(k.Private)
+}
+
 // Scheme exposes signing and verification primitives.
 type Scheme interface {
 	Name() string
@@ -24,7 +29,8 @@ type Scheme interface {
 	Verify(publicKey, message, signature []byte) error
 }
 
-// Dilithium3 implements ML-DSA (Dilithium level 3).
+// Dilithium3 implements round-3 Dilithium (mode 3). It predates FIPS 204 and is not
+// interoperable with ML-DSA-65; prefer NewMLDSA65 for new deployments.
 type Dilithium3 struct{}
 
 // NewDilithium3 constructs scheme instance.
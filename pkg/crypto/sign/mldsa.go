@@ -0,0 +1,133 @@
+package sign
+
+import (
+	"errors"
+	"fmt"
+
+	circlsign "github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa44"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa87"
+)
+
+// MaxContextLength is the largest context string FIPS 204 permits.
+const MaxContextLength = 255
+
+// ContextScheme is implemented by schemes supporting FIPS 204 context strings, which
+// domain-separate signatures made with the same key for different purposes.
+type ContextScheme interface {
+	Scheme
+	SignWithContext(privateKey, message, context []byte) ([]byte, error)
+	VerifyWithContext(publicKey, message, context, signature []byte) error
+}
+
+// MLDSA implements pure FIPS 204 ML-DSA via Cloudflare CIRCL. The pre-hash variant,
+// HashML-DSA, is not offered: CIRCL does not expose the signing of a caller-built M'.
+type MLDSA struct {
+	scheme circlsign.Scheme
+}
+
+// NewMLDSA44 constructs an ML-DSA-44 scheme (NIST security category 2).
+func NewMLDSA44() *MLDSA { return &MLDSA{scheme: mldsa44.Scheme()} }
+
+// NewMLDSA65 constructs an ML-DSA-65 scheme (NIST security category 3).
+func NewMLDSA65() *MLDSA { return &MLDSA{scheme: mldsa65.Scheme()} }
+
+// NewMLDSA87 constructs an ML-DSA-87 scheme (NIST security category 5).
+func NewMLDSA87() *MLDSA { return &MLDSA{scheme: mldsa87.Scheme()} }
+
+func (m *MLDSA) Name() string {
+	return m.scheme.Name()
+}
+
+func (m *MLDSA) PublicKeyLength() int {
+	return m.scheme.PublicKeySize()
+}
+
+func (m *MLDSA) PrivateKeyLength() int {
+	return m.scheme.PrivateKeySize()
+}
+
+func (m *MLDSA) SignatureLength() int {
+	return m.scheme.SignatureSize()
+}
+
+func (m *MLDSA) GenerateKeyPair() (KeyPair, error) {
+	pub, priv, err := m.scheme.GenerateKey()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mldsa: generate keypair: %w", err)
+	}
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mldsa: marshal public: %w", err)
+	}
+	privBytes, err := priv.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mldsa: marshal private: %w", err)
+	}
+	return KeyPair{Public: pubBytes, Private: privBytes}, nil
+}
+
+// SeedLength is the seed size accepted by DeriveKeyPair.
+func (m *MLDSA) SeedLength() int {
+	return m.scheme.SeedSize()
+}
+
+// DeriveKeyPair deterministically derives a keypair from seed (FIPS 204 ML-DSA.KeyGen_internal).
+func (m *MLDSA) DeriveKeyPair(seed []byte) (KeyPair, error) {
+	if len(seed) != m.scheme.SeedSize() {
+		return KeyPair{}, fmt.Errorf("mldsa: seed length %d, want %d", len(seed), m.scheme.SeedSize())
+	}
+	pub, priv := m.scheme.DeriveKey(seed)
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mldsa: marshal public: %w", err)
+	}
+	privBytes, err := priv.MarshalBinary()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("mldsa: marshal private: %w", err)
+	}
+	return KeyPair{Public: pubBytes, Private: privBytes}, nil
+}
+
+func (m *MLDSA) Sign(privateKey, message []byte) ([]byte, error) {
+	return m.SignWithContext(privateKey, message, nil)
+}
+
+func (m *MLDSA) Verify(publicKey, message, signature []byte) error {
+	return m.VerifyWithContext(publicKey, message, nil, signature)
+}
+
+func (m *MLDSA) SignWithContext(privateKey, message, context []byte) ([]byte, error) {
+	msg, opts, err := m.prepare(message, context)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := m.scheme.UnmarshalBinaryPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("mldsa: parse private key: %w", err)
+	}
+	return m.scheme.Sign(priv, msg, opts), nil
+}
+
+func (m *MLDSA) VerifyWithContext(publicKey, message, context, signature []byte) error {
+	msg, opts, err := m.prepare(message, context)
+	if err != nil {
+		return err
+	}
+	pub, err := m.scheme.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("mldsa: parse public key: %w", err)
+	}
+	if !m.scheme.Verify(pub, msg, signature, opts) {
+		return errors.New("mldsa: signature verification failed")
+	}
+	return nil
+}
+
+func (m *MLDSA) prepare(message, context []byte) ([]byte, *circlsign.SignatureOpts, error) {
+	if len(context) > MaxContextLength {
+		return nil, nil, fmt.Errorf("mldsa: context length %d exceeds %d", len(context), MaxContextLength)
+	}
+	return message, &circlsign.SignatureOpts{Context: string(context)}, nil
+}
@@ -0,0 +1,61 @@
+package sign
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownScheme indicates no scheme is registered under the requested name.
+var ErrUnknownScheme = errors.New("sign: unknown scheme")
+
+// Factory constructs a fresh Scheme instance.
+type Factory func() Scheme
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"ML-DSA-44":  func() Scheme { return NewMLDSA44() },
+		"ML-DSA-65":  func() Scheme { return NewMLDSA65() },
+		"ML-DSA-87":  func() Scheme { return NewMLDSA87() },
+		"Dilithium3": func() Scheme { return NewDilithium3() },
+	}
+)
+
+// Register makes a scheme available under its canonical name, replacing any previous entry.
+func Register(name string, factory Factory) error {
+	if name == "" {
+		return errors.New("sign: scheme name required")
+	}
+	if factory == nil {
+		return fmt.Errorf("sign: nil factory for %s", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+	return nil
+}
+
+// Lookup returns a new instance of the scheme registered under name.
+func Lookup(name string) (Scheme, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownScheme, name)
+	}
+	return factory(), nil
+}
+
+// Names lists every registered scheme name in lexical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for name := range registry {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,70 @@
+package sign
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistrySchemesRoundTrip(t *testing.T) {
+	msg := []byte("transcript hash")
+	for _, name := range Names() {
+		scheme, err := Lookup(name)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		if scheme.Name() != name {
+			t.Fatalf("scheme registered as %s reports %s", name, scheme.Name())
+		}
+
+		kp, err := scheme.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("%s: generate: %v", name, err)
+		}
+		sig, err := scheme.Sign(kp.Private, msg)
+		if err != nil {
+			t.Fatalf("%s: sign: %v", name, err)
+		}
+		if len(sig) != scheme.SignatureLength() {
+			t.Fatalf("%s: signature length %d", name, len(sig))
+		}
+		if err := scheme.Verify(kp.Public, msg, sig); err != nil {
+			t.Fatalf("%s: verify: %v", name, err)
+		}
+		if err := scheme.Verify(kp.Public, []byte("tampered"), sig); err == nil {
+			t.Fatalf("%s: tampered message verified", name)
+		}
+	}
+}
+
+func TestMLDSAContextSeparation(t *testing.T) {
+	scheme := NewMLDSA65()
+	kp, err := scheme.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	msg := []byte("payload")
+
+	sig, err := scheme.SignWithContext(kp.Private, msg, []byte("handshake"))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := scheme.VerifyWithContext(kp.Public, msg, []byte("handshake"), sig); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := scheme.VerifyWithContext(kp.Public, msg, []byte("attestation"), sig); err == nil {
+		t.Fatal("signature verified under a different context")
+	}
+	if err := scheme.Verify(kp.Public, msg, sig); err == nil {
+		t.Fatal("context signature verified without context")
+	}
+
+	if _, err := scheme.SignWithContext(kp.Private, msg, make([]byte, MaxContextLength+1)); err == nil {
+		t.Fatal("expected oversized context to fail")
+	}
+}
+
+func TestRegistryUnknownScheme(t *testing.T) {
+	if _, err := Lookup("ML-DSA-99"); !errors.Is(err, ErrUnknownScheme) {
+		t.Fatalf("expected ErrUnknownScheme, got %v", err)
+	}
+}
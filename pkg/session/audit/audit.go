@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/example/qsafe/pkg/session/state"
+)
+
+// FlushInterval is how often a Log opened with OpenFile writes out buffered records.
+const FlushInterval = time.Second
+
+// bufferSize bounds the records a Log holds before writing them out.
+const bufferSize = 64 << 10
+
+// Log appends handshake records to a writer as JSON lines. Its Record method has the
+// signature of the Audit hooks in state.ClientConfig and state.ServerConfig. Records
+// are buffered, so that a flood of failed handshakes does not cost a write each: they
+// reach the writer when the buffer fills, on Flush and on Close. Write failures do not
+// interrupt handshakes; the first one is kept and reported by Err.
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	buf  *bufio.Writer
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewLog writes records to w.
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w, buf: bufio.NewWriterSize(w, bufferSize)}
+}
+
+// OpenFile appends records to the file at path, creating it readable only by the owner.
+// Buffered records are also flushed every FlushInterval until Close.
+func OpenFile(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: open %s: %w", path, err)
+	}
+	l := NewLog(f)
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go l.flushEvery(FlushInterval, l.stop, l.done)
+	return l, nil
+}
+
+// Record buffers rec as a single line.
+func (l *Log) Record(rec state.HandshakeRecord) {
+	line, err := json.Marshal(rec)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		_, err = l.buf.Write(append(line, '\n'))
+	}
+	if err != nil && l.err == nil {
+		l.err = fmt.Errorf("audit: write record: %w", err)
+	}
+}
+
+// Flush writes out buffered records and returns the first error encountered so far.
+func (l *Log) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushLocked()
+	return l.err
+}
+
+func (l *Log) flushLocked() {
+	if err := l.buf.Flush(); err != nil && l.err == nil {
+		l.err = fmt.Errorf("audit: write record: %w", err)
+	}
+}
+
+func (l *Log) flushEvery(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = l.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Err returns the first error encountered while writing records.
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close flushes buffered records, closes the underlying writer if it is an io.Closer
+// and returns any earlier write error.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	stop := l.stop
+	l.stop = nil
+	l.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-l.done
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushLocked()
+	if c, ok := l.w.(io.Closer); ok {
+		if err := c.Close(); err != nil && l.err == nil {
+			l.err = fmt.Errorf("audit: close: %w", err)
+		}
+	}
+	return l.err
+}
+
+// Read parses a stream written by Log.
+func Read(r io.Reader) ([]state.HandshakeRecord, error) {
+	var out []state.HandshakeRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec state.HandshakeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("audit: line %d: %w", line, err)
+		}
+		out = append(out, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("audit: read: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/example/qsafe/pkg/session/state"
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+func TestLogRoundTrip(t *testing.T) {
+	trans := transcript.New("qsafe-handshake")
+	if err := trans.Append("client_signature", transcript.Raw("sig")); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	var buf bytes.Buffer
+	log := NewLog(&buf)
+	log.Record(state.HandshakeRecord{Role: "server", Transcript: trans.Record(), TranscriptHash: trans.Snapshot()})
+	log.Record(state.HandshakeRecord{Role: "client", Alert: &state.Alert{Code: state.AlertReplay}})
+	if buf.Len() != 0 {
+		t.Fatal("records written before flush")
+	}
+	if err := log.Flush(); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	recs, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(recs) != 2 || recs[0].Role != "server" || recs[1].Alert.Code != state.AlertReplay {
+		t.Fatalf("unexpected records: %+v", recs)
+	}
+	if hash, err := recs[0].Transcript.Recompute(); err != nil || !bytes.Equal(hash, recs[0].TranscriptHash) {
+		t.Fatalf("record did not round-trip: %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestLogKeepsFirstError(t *testing.T) {
+	log := NewLog(failingWriter{})
+	log.Record(state.HandshakeRecord{Role: "server"})
+	if err := log.Flush(); err == nil {
+		t.Fatal("expected write error to be reported")
+	}
+	log.Record(state.HandshakeRecord{Role: "server"})
+	if err := log.Err(); err == nil {
+		t.Fatal("expected write error to be kept")
+	}
+	if _, err := Read(bytes.NewBufferString("{\"role\":\"server\"}\nnot json\n")); err == nil {
+		t.Fatal("expected malformed line to be rejected")
+	}
+}
+
+func TestOpenFileFlushes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	log.Record(state.HandshakeRecord{Role: "server"})
+	deadline := time.Now().Add(5 * FlushInterval)
+	for {
+		data, _ := os.ReadFile(path)
+		if len(data) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("record never flushed")
+		}
+		time.Sleep(FlushInterval / 10)
+	}
+	log.Record(state.HandshakeRecord{Role: "client"})
+	if err := log.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	if recs, err := Read(f); err != nil || len(recs) != 2 {
+		t.Fatalf("expected both records on disk, got %d, %v", len(recs), err)
+	}
+}
@@ -0,0 +1,124 @@
+package cookie
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+var (
+	// ErrInvalid indicates a cookie that is malformed, forged, bound to another client, or
+	// minted under a retired secret.
+	ErrInvalid = errors.New("cookie: invalid")
+	// ErrExpired indicates a cookie older than the configured lifetime.
+	ErrExpired = errors.New("cookie: expired")
+)
+
+const (
+	timestampSize = 8
+	macSize       = 32
+	// Size is the length of every cookie.
+	Size = timestampSize + macSize
+)
+
+// Config controls cookie lifetime.
+type Config struct {
+	// Lifetime bounds how long a cookie may be returned after issue (default 30s). The
+	// MAC secret rotates at the same interval and the previous secret is kept, so a
+	// cookie stays valid for at most one full lifetime.
+	Lifetime time.Duration
+}
+
+// Issuer mints and checks stateless retry cookies. A cookie is a timestamp and a keyed
+// BLAKE3 MAC over it and a client binding; nothing is stored per client, so issuing a
+// cookie costs a hash and no memory.
+type Issuer struct {
+	mu       sync.Mutex
+	cfg      Config
+	current  []byte
+	previous []byte
+	rotated  time.Time
+	now      func() time.Time
+}
+
+// NewIssuer creates an issuer with a freshly generated secret.
+func NewIssuer(cfg Config) (*Issuer, error) {
+	if cfg.Lifetime <= 0 {
+		cfg.Lifetime = 30 * time.Second
+	}
+	i := &Issuer{cfg: cfg, now: time.Now}
+	if err := i.rotateLocked(i.now()); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Issue returns a cookie bound to binding, which should identify the client attempt
+// (for example its address and nonce).
+func (i *Issuer) Issue(binding []byte) ([]byte, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	if now.Sub(i.rotated) >= i.cfg.Lifetime {
+		if err := i.rotateLocked(now); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]byte, timestampSize, Size)
+	binary.BigEndian.PutUint64(out, uint64(now.Unix()))
+	return append(out, mac(i.current, out, binding)...), nil
+}
+
+// Verify checks that c was issued by this issuer for binding and has not expired.
+func (i *Issuer) Verify(c, binding []byte) error {
+	if len(c) != Size {
+		return ErrInvalid
+	}
+	i.mu.Lock()
+	current, previous := i.current, i.previous
+	now := i.now()
+	i.mu.Unlock()
+
+	ok := subtle.ConstantTimeCompare(mac(current, c[:timestampSize], binding), c[timestampSize:]) == 1
+	if !ok && previous != nil {
+		ok = subtle.ConstantTimeCompare(mac(previous, c[:timestampSize], binding), c[timestampSize:]) == 1
+	}
+	if !ok {
+		return ErrInvalid
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(c[:timestampSize])), 0)
+	if now.Sub(issued) > i.cfg.Lifetime || issued.After(now.Add(time.Second)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (i *Issuer) rotateLocked(now time.Time) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("cookie: generate secret: %w", err)
+	}
+	i.previous, i.current, i.rotated = i.current, secret, now
+	return nil
+}
+
+func mac(secret, timestamp, binding []byte) []byte {
+	h, err := blake3.NewKeyed(secret)
+	if err != nil {
+		panic("blake3: invalid cookie key length")
+	}
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(binding)))
+	_, _ = h.Write([]byte("qsafe-retry-cookie"))
+	_, _ = h.Write(timestamp)
+	_, _ = h.Write(length[:])
+	_, _ = h.Write(binding)
+	return h.Sum(nil)
+}
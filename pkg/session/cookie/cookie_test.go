@@ -0,0 +1,75 @@
+package cookie
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssuerVerify(t *testing.T) {
+	i, err := NewIssuer(Config{Lifetime: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("new issuer: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	i.now = func() time.Time { return now }
+
+	c, err := i.Issue([]byte("10.0.0.1|nonce-a"))
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if len(c) != Size {
+		t.Fatalf("cookie length %d", len(c))
+	}
+	if err := i.Verify(c, []byte("10.0.0.1|nonce-a")); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := i.Verify(c, []byte("10.0.0.2|nonce-a")); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected cookie bound to another client to be invalid, got %v", err)
+	}
+	tampered := append([]byte(nil), c...)
+	tampered[0] ^= 0x01
+	if err := i.Verify(tampered, []byte("10.0.0.1|nonce-a")); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected tampered timestamp to be invalid, got %v", err)
+	}
+	if err := i.Verify(c[:Size-1], []byte("10.0.0.1|nonce-a")); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected truncated cookie to be invalid, got %v", err)
+	}
+
+	now = now.Add(31 * time.Second)
+	if err := i.Verify(c, []byte("10.0.0.1|nonce-a")); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired cookie, got %v", err)
+	}
+}
+
+func TestIssuerRotation(t *testing.T) {
+	i, err := NewIssuer(Config{Lifetime: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("new issuer: %v", err)
+	}
+	start := time.Unix(1_700_000_000, 0)
+	now := start.Add(10 * time.Second)
+	i.now = func() time.Time { return now }
+	i.rotated = start
+
+	old, err := i.Issue([]byte("client"))
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	// Issuing a lifetime after the last rotation rotates the secret; cookies under the
+	// previous secret still verify until they expire.
+	now = start.Add(30 * time.Second)
+	if _, err := i.Issue([]byte("other")); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if err := i.Verify(old, []byte("client")); err != nil {
+		t.Fatalf("verify under previous secret: %v", err)
+	}
+	now = start.Add(60 * time.Second)
+	if _, err := i.Issue([]byte("other")); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if err := i.Verify(old, []byte("client")); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected retired secret to be rejected, got %v", err)
+	}
+}
@@ -11,6 +11,13 @@ type Config struct {
 	AllowedAEAD  []string
 	MinRotation  time.Duration
 	MaxRotation  time.Duration
+	// AllowStrictResumption permits ticket-based resumption in strict mode. Resumed
+	// sessions skip the KEM, so they lack fresh post-quantum key exchange and are refused
+	// in strict mode unless explicitly allowed.
+	AllowStrictResumption bool
+	// DisableEarlyData refuses 0-RTT early data on resumed sessions. Early data is
+	// replayable by design, so deployments that cannot tolerate replays should set it.
+	DisableEarlyData bool
 }
 
 // Parameters describes a negotiated session.
@@ -66,3 +73,24 @@ func (e *Enforcer) Validate(params Parameters) error {
 	}
 	return nil
 }
+
+// ValidateResumption reports whether ticket-based resumption is permitted in mode.
+func (e *Enforcer) ValidateResumption(mode string) error {
+	if len(e.modes) > 0 {
+		if _, ok := e.modes[mode]; !ok {
+			return fmt.Errorf("policy: mode %q not permitted", mode)
+		}
+	}
+	if mode == "strict" && !e.cfg.AllowStrictResumption {
+		return fmt.Errorf("policy: resumption not permitted in strict mode")
+	}
+	return nil
+}
+
+// ValidateEarlyData reports whether 0-RTT early data may be accepted in mode.
+func (e *Enforcer) ValidateEarlyData(mode string) error {
+	if e.cfg.DisableEarlyData {
+		return fmt.Errorf("policy: early data disabled")
+	}
+	return e.ValidateResumption(mode)
+}
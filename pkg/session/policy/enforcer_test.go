@@ -45,3 +45,28 @@ func TestEnforcer(t *testing.T) {
 		t.Fatal("expected rotation min failure")
 	}
 }
+
+func TestValidateResumption(t *testing.T) {
+	enforcer := New(Config{AllowedModes: []string{"strict", "hybrid"}})
+	if err := enforcer.ValidateResumption("hybrid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enforcer.ValidateResumption("strict"); err == nil {
+		t.Fatal("expected strict resumption to be refused by default")
+	}
+	if err := New(Config{AllowStrictResumption: true}).ValidateResumption("strict"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateEarlyData(t *testing.T) {
+	if err := New(Config{}).ValidateEarlyData("hybrid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := New(Config{DisableEarlyData: true}).ValidateEarlyData("hybrid"); err == nil {
+		t.Fatal("expected early data to be disabled")
+	}
+	if err := New(Config{}).ValidateEarlyData("strict"); err == nil {
+		t.Fatal("expected early data to follow strict resumption policy")
+	}
+}
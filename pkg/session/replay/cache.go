@@ -0,0 +1,105 @@
+package replay
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCacheFull indicates a RejectWhenFull cache has no room for another unexpired key.
+var ErrCacheFull = errors.New("replay: cache full")
+
+// CacheConfig controls the handshake nonce cache.
+type CacheConfig struct {
+	// Capacity bounds the number of remembered keys; the oldest entry is evicted first.
+	Capacity int
+	// TTL is how long a key is remembered. It should cover the full freshness window
+	// of the values being tracked so that expired entries are also stale.
+	TTL time.Duration
+	// RejectWhenFull makes Insert fail with ErrCacheFull instead of evicting unexpired
+	// keys, for callers that must never forget a key within its TTL.
+	RejectWhenFull bool
+}
+
+// Cache remembers recently seen handshake values (nonces, ciphertext hashes) with
+// bounded memory and rejects duplicates within the TTL.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	strict   bool
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewCache creates a cache with the provided bounds.
+func NewCache(cfg CacheConfig) *Cache {
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = 65536
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = 2 * time.Minute
+	}
+	return &Cache{
+		capacity: capacity,
+		ttl:      ttl,
+		strict:   cfg.RejectWhenFull,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element, capacity),
+	}
+}
+
+// Insert records every key atomically. If any key is already present and unexpired,
+// nothing is recorded and ErrDuplicate is returned.
+func (c *Cache) Insert(now time.Time, keys ...[]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	for _, k := range keys {
+		if _, ok := c.entries[string(k)]; ok {
+			return ErrDuplicate
+		}
+	}
+	if c.strict && c.order.Len()+len(keys) > c.capacity {
+		return ErrCacheFull
+	}
+	expires := now.Add(c.ttl)
+	for _, k := range keys {
+		if c.order.Len() >= c.capacity {
+			c.evict(c.order.Front())
+		}
+		c.entries[string(k)] = c.order.PushBack(&cacheEntry{key: string(k), expires: expires})
+	}
+	return nil
+}
+
+// Len reports the number of keys currently remembered.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// expire drops entries from the front of the list; insertion order matches expiry order.
+func (c *Cache) expire(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		if now.Before(e.Value.(*cacheEntry).expires) {
+			return
+		}
+		c.evict(e)
+	}
+}
+
+func (c *Cache) evict(e *list.Element) {
+	delete(c.entries, e.Value.(*cacheEntry).key)
+	c.order.Remove(e)
+}
@@ -0,0 +1,53 @@
+package replay
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheInsert(t *testing.T) {
+	c := NewCache(CacheConfig{Capacity: 3, TTL: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+
+	if err := c.Insert(now, []byte("n1"), []byte("c1")); err != nil {
+		t.Fatalf("expected accept: %v", err)
+	}
+	if err := c.Insert(now, []byte("n2"), []byte("c1")); err != ErrDuplicate {
+		t.Fatalf("expected duplicate ciphertext, got %v", err)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("rejected insert must not record keys, have %d", c.Len())
+	}
+	if err := c.Insert(now.Add(2*time.Minute), []byte("n1"), []byte("c1")); err != nil {
+		t.Fatalf("expected accept after ttl: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := c.Insert(now.Add(2*time.Minute), []byte{byte(i)}); err != nil {
+			t.Fatalf("insert %d: %v", i, err)
+		}
+	}
+	if c.Len() != 3 {
+		t.Fatalf("expected capacity bound of 3, have %d", c.Len())
+	}
+}
+
+func TestCacheRejectWhenFull(t *testing.T) {
+	c := NewCache(CacheConfig{Capacity: 2, TTL: time.Minute, RejectWhenFull: true})
+	now := time.Unix(1_700_000_000, 0)
+
+	for _, k := range []string{"a", "b"} {
+		if err := c.Insert(now, []byte(k)); err != nil {
+			t.Fatalf("insert %s: %v", k, err)
+		}
+	}
+	if err := c.Insert(now, []byte("c")); err != ErrCacheFull {
+		t.Fatalf("expected full cache, got %v", err)
+	}
+	if err := c.Insert(now, []byte("a")); err != ErrDuplicate {
+		t.Fatalf("expected duplicate to be remembered, got %v", err)
+	}
+	if err := c.Insert(now.Add(time.Minute), []byte("c")); err != nil {
+		t.Fatalf("expected room after expiry: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileCompactEvery is how many records the log may accumulate beyond its live keys
+// before FileStore checkpoints it.
+const fileCompactEvery = 4096
+
+// FileStore keeps marks in a local append-only log of JSON lines, synced to disk before
+// Advance returns. Once enough superseded records pile up, the log is checkpointed:
+// rewritten with one record per live key and atomically renamed into place. A record
+// torn by a crash is ignored on recovery; its Advance never returned, so no sequence
+// relied on it.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	marks   map[string]uint64
+	records int
+}
+
+type fileRecord struct {
+	Key     string `json:"key"`
+	Mark    uint64 `json:"mark,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// OpenFileStore recovers the marks logged at path, creating the file readable only by
+// the owner if it does not exist.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, marks: make(map[string]uint64)}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("replay: read %s: %w", path, err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var rec fileRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if i == len(lines)-1 {
+				break // torn final write
+			}
+			return nil, fmt.Errorf("replay: %s line %d: %w", path, i+1, err)
+		}
+		s.apply(rec)
+	}
+	// Start from a clean checkpoint, which also drops any torn tail.
+	if err := s.checkpointLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load implements Store.
+func (s *FileStore) Load(ctx context.Context, key string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.marks[key], nil
+}
+
+// Advance implements Store.
+func (s *FileStore) Advance(ctx context.Context, key string, from, to uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.marks[key] != from || to <= from {
+		return ErrConflict
+	}
+	return s.appendLocked(fileRecord{Key: key, Mark: to})
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.marks[key]; !ok {
+		return nil
+	}
+	return s.appendLocked(fileRecord{Key: key, Deleted: true})
+}
+
+// Close checkpoints the log and closes the file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.checkpointLocked()
+	if cerr := s.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("replay: close %s: %w", s.path, cerr)
+	}
+	s.f = nil
+	return err
+}
+
+func (s *FileStore) apply(rec fileRecord) {
+	if rec.Deleted {
+		delete(s.marks, rec.Key)
+	} else if rec.Mark > s.marks[rec.Key] {
+		s.marks[rec.Key] = rec.Mark
+	}
+}
+
+func (s *FileStore) appendLocked(rec fileRecord) error {
+	if s.f == nil {
+		return errors.New("replay: file store closed")
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("replay: append %s: %w", s.path, err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("replay: sync %s: %w", s.path, err)
+	}
+	s.apply(rec)
+	s.records++
+	if s.records > len(s.marks)+fileCompactEvery {
+		return s.checkpointLocked()
+	}
+	return nil
+}
+
+// checkpointLocked rewrites the log with the live marks and reopens it for appending.
+func (s *FileStore) checkpointLocked() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("replay: checkpoint %s: %w", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for key, mark := range s.marks {
+		if err := enc.Encode(fileRecord{Key: key, Mark: mark}); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("replay: checkpoint %s: %w", s.path, err)
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("replay: checkpoint %s: %w", s.path, err)
+	}
+	// Make the rename itself durable.
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("replay: open %s: %w", s.path, err)
+	}
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+	s.f, s.records = f, len(s.marks)
+	return nil
+}
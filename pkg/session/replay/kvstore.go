@@ -0,0 +1,148 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KVConfig points a KVStore at a key-value service.
+type KVConfig struct {
+	// URL is the base under which each key is a resource, e.g.
+	// "https://kv.internal/v1/replay". Keys are path-escaped and appended.
+	URL string
+	// Client defaults to an http.Client with a 5 second timeout.
+	Client *http.Client
+}
+
+// KVStore keeps marks in a networked key-value service shared by gateway replicas. It
+// speaks plain HTTP: GET returns a key's decimal mark and its ETag (404 if absent), PUT
+// stores one conditionally with If-Match or If-None-Match: * (412 on a lost race), and
+// DELETE removes it. Object stores and KV gateways with conditional writes fit this
+// shape. Advance only writes over the ETag of the mark it expects, so replicas sharing a
+// key cannot both reserve the same sequences.
+type KVStore struct {
+	base   string
+	client *http.Client
+}
+
+// NewKVStore returns a store for the service at cfg.URL.
+func NewKVStore(cfg KVConfig) (*KVStore, error) {
+	if _, err := url.Parse(cfg.URL); err != nil || cfg.URL == "" {
+		return nil, fmt.Errorf("replay: invalid store URL %q", cfg.URL)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &KVStore{base: strings.TrimSuffix(cfg.URL, "/"), client: cfg.Client}, nil
+}
+
+// Load implements Store.
+func (s *KVStore) Load(ctx context.Context, key string) (uint64, error) {
+	mark, _, err := s.get(ctx, key)
+	return mark, err
+}
+
+// Advance implements Store.
+func (s *KVStore) Advance(ctx context.Context, key string, from, to uint64) error {
+	current, etag, err := s.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if current != from || to <= from {
+		return fmt.Errorf("%w: %s holds %d, expected %d", ErrConflict, key, current, from)
+	}
+	req, err := s.request(ctx, http.MethodPut, key, strings.NewReader(strconv.FormatUint(to, 10)))
+	if err != nil {
+		return err
+	}
+	if etag == "" {
+		req.Header.Set("If-None-Match", "*")
+	} else {
+		req.Header.Set("If-Match", etag)
+	}
+	status, err := s.do(req)
+	switch {
+	case err != nil:
+		return err
+	case status == http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s changed during advance", ErrConflict, key)
+	case status/100 != 2:
+		return fmt.Errorf("replay: store put %s: status %d", key, status)
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (s *KVStore) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	status, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	if status/100 != 2 && status != http.StatusNotFound {
+		return fmt.Errorf("replay: store delete %s: status %d", key, status)
+	}
+	return nil
+}
+
+// get returns key's mark and ETag, or zero values if the key does not exist.
+func (s *KVStore) get(ctx context.Context, key string) (uint64, string, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("replay: store get %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, "", nil
+	default:
+		return 0, "", fmt.Errorf("replay: store get %s: status %d", key, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return 0, "", fmt.Errorf("replay: store get %s: %w", key, err)
+	}
+	mark, err := strconv.ParseUint(string(bytes.TrimSpace(body)), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("replay: store get %s: malformed mark: %w", key, err)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return 0, "", fmt.Errorf("replay: store get %s: no ETag for conditional update", key)
+	}
+	return mark, etag, nil
+}
+
+func (s *KVStore) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.base+"/"+url.PathEscape(key), body)
+	if err != nil {
+		return nil, fmt.Errorf("replay: store %s %s: %w", method, key, err)
+	}
+	return req, nil
+}
+
+// do sends req and returns the response status.
+func (s *KVStore) do(req *http.Request) (int, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("replay: store %s: %w", req.Method, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrConflict is returned by Store.Advance when the key no longer holds the mark the
+// caller last saw: another window, on this replica or another, has advanced it.
+var ErrConflict = errors.New("replay: store conflict")
+
+// Store persists the high-water marks of replay windows, so a window reopened after a
+// restart, or on another replica, refuses envelopes its predecessor accepted. Keys name
+// one window each, and Advance is a compare-and-swap, so only one window at a time can
+// hold a key: a second one to reserve from the same mark fails with ErrConflict.
+type Store interface {
+	// Load returns the mark saved for key, or 0 if there is none.
+	Load(ctx context.Context, key string) (uint64, error)
+	// Advance raises key's mark from from (0 if it has none) to to, failing with
+	// ErrConflict if key holds any other mark. It must be durable before it returns: the
+	// window accepts sequences up to to on the strength of it.
+	Advance(ctx context.Context, key string, from, to uint64) error
+	// Delete forgets key.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryStore keeps marks in process memory. It survives a Session being rebuilt within
+// one process but not a restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	marks map[string]uint64
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{marks: make(map[string]uint64)}
+}
+
+// Load implements Store.
+func (m *MemoryStore) Load(ctx context.Context, key string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.marks[key], nil
+}
+
+// Advance implements Store.
+func (m *MemoryStore) Advance(ctx context.Context, key string, from, to uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.marks[key] != from || to <= from {
+		return ErrConflict
+	}
+	m.marks[key] = to
+	return nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.marks, key)
+	return nil
+}
+
+// Len returns the number of windows with a saved mark.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.marks)
+}
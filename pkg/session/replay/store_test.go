@@ -0,0 +1,342 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := OpenFileStore(filepath.Join(t.TempDir(), "replay.log"))
+	if err != nil {
+		t.Fatalf("open file store: %v", err)
+	}
+	defer fileStore.Close()
+	kv := httptest.NewServer(newKVStandIn())
+	defer kv.Close()
+	kvStore, err := NewKVStore(KVConfig{URL: kv.URL + "/v1/replay"})
+	if err != nil {
+		t.Fatalf("new kv store: %v", err)
+	}
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "file": fileStore, "kv": kvStore} {
+		if mark, err := store.Load(ctx, "s/server/1"); err != nil || mark != 0 {
+			t.Fatalf("%s: load of unknown key: %d, %v", name, mark, err)
+		}
+		if err := store.Advance(ctx, "s/server/1", 0, 10); err != nil {
+			t.Fatalf("%s: advance: %v", name, err)
+		}
+		if err := store.Advance(ctx, "s/server/1", 10, 20); err != nil {
+			t.Fatalf("%s: advance: %v", name, err)
+		}
+		// Advancing from a mark the key no longer holds, or backwards, is a conflict.
+		for _, step := range [][2]uint64{{10, 30}, {0, 30}, {20, 5}} {
+			if err := store.Advance(ctx, "s/server/1", step[0], step[1]); !errors.Is(err, ErrConflict) {
+				t.Fatalf("%s: advance %d->%d: expected conflict, got %v", name, step[0], step[1], err)
+			}
+		}
+		if mark, err := store.Load(ctx, "s/server/1"); err != nil || mark != 20 {
+			t.Fatalf("%s: unexpected mark %d, %v", name, mark, err)
+		}
+		if err := store.Delete(ctx, "s/server/1"); err != nil {
+			t.Fatalf("%s: delete: %v", name, err)
+		}
+		if mark, _ := store.Load(ctx, "s/server/1"); mark != 0 {
+			t.Fatalf("%s: deleted key still has mark %d", name, mark)
+		}
+	}
+}
+
+func TestWindowRecoversFromStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	cfg := Config{Depth: 64, Store: store, Checkpoint: 16}
+
+	w, err := Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for seq := uint64(1); seq <= 20; seq++ {
+		if err := w.Accept(seq); err != nil {
+			t.Fatalf("accept %d: %v", seq, err)
+		}
+	}
+	// 1 reserved up to 17, 18 up to 34.
+	if mark, _ := store.Load(ctx, "k"); mark != 34 {
+		t.Fatalf("unexpected mark %d", mark)
+	}
+
+	// A restarted window refuses everything up to the mark, including sequences the old
+	// window never saw, and takes anything above it.
+	w, err = Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	for _, seq := range []uint64{5, 20, 21, 34} {
+		if err := w.Accept(seq); err != ErrDuplicate {
+			t.Fatalf("recovered window accepted %d: %v", seq, err)
+		}
+	}
+	if err := w.Accept(35); err != nil {
+		t.Fatalf("accept above mark: %v", err)
+	}
+
+	if err := w.Forget(ctx); err != nil || store.Len() != 0 {
+		t.Fatalf("forget: %v, %d keys left", err, store.Len())
+	}
+}
+
+func TestWindowStoreConflict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	cfg := Config{Depth: 64, Store: store, Checkpoint: 16}
+
+	// Two replicas recover the same key; only the first to reserve may accept.
+	a, err := Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	b, err := Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := a.Accept(1); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if err := b.Accept(1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected second replica to conflict, got %v", err)
+	}
+	if err := b.Accept(30); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected second replica to keep conflicting, got %v", err)
+	}
+	if err := b.Check(1); err != nil || b.Highest() != 0 {
+		t.Fatalf("conflicting accept recorded a sequence: %v, highest %d", err, b.Highest())
+	}
+	if err := a.Accept(30); err != nil {
+		t.Fatalf("owner accept: %v", err)
+	}
+}
+
+func TestWindowRestoreWithStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	cfg := Config{Depth: 64, Store: store, Checkpoint: 16}
+
+	w, err := Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, seq := range []uint64{1, 2, 4} {
+		if err := w.Accept(seq); err != nil {
+			t.Fatalf("accept %d: %v", seq, err)
+		}
+	}
+	snap := w.Snapshot()
+
+	// The mark is still the snapshot's reservation: restore exactly.
+	restored, err := Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	restored.Restore(snap)
+	if err := restored.Check(2); err != ErrDuplicate {
+		t.Fatalf("restored window forgot 2: %v", err)
+	}
+	for _, seq := range []uint64{3, 5, 20} {
+		if err := restored.Accept(seq); err != nil {
+			t.Fatalf("accept %d after restore: %v", seq, err)
+		}
+	}
+
+	// Another window has reserved since: the snapshot is stale and the mark wins.
+	w, err = Open(ctx, cfg, "k")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	w.Restore(snap)
+	if err := w.Check(6); err != ErrDuplicate {
+		t.Fatalf("stale snapshot reopened 6: %v", err)
+	}
+}
+
+func TestWindowAcceptContextBoundsStore(t *testing.T) {
+	kv := httptest.NewServer(newKVStandIn())
+	defer kv.Close()
+	store, err := NewKVStore(KVConfig{URL: kv.URL})
+	if err != nil {
+		t.Fatalf("new kv store: %v", err)
+	}
+	w, err := Open(context.Background(), Config{Store: store}, "k")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.AcceptContext(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the reservation to honour ctx, got %v", err)
+	}
+	if err := w.AcceptContext(context.Background(), 1); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+}
+
+func TestWindowCheckDoesNotRecord(t *testing.T) {
+	w := New(Config{Depth: 8})
+	if err := w.Check(1000); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if w.Highest() != 0 {
+		t.Fatal("check moved the window")
+	}
+	if err := w.Accept(1); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if err := w.Check(1); err != ErrDuplicate {
+		t.Fatalf("expected duplicate from check, got %v", err)
+	}
+}
+
+func TestFileStoreRecovery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "replay.log")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := range uint64(fileCompactEvery + 10) {
+		if err := store.Advance(ctx, "a", i, i+1); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+	}
+	if err := store.Advance(ctx, "b", 0, 7); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := store.Advance(ctx, "c", 0, 3); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	// Simulate a crash: no Close, and a torn record at the end of the log.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	_, _ = f.WriteString(`{"key":"c","ma`)
+	_ = f.Close()
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines > fileCompactEvery {
+		t.Fatalf("log was never checkpointed: %d lines", lines)
+	}
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	for key, want := range map[string]uint64{"a": fileCompactEvery + 10, "b": 0, "c": 3} {
+		if mark, _ := store.Load(ctx, key); mark != want {
+			t.Fatalf("key %s: mark %d, want %d", key, mark, want)
+		}
+	}
+}
+
+func TestKVStoreConcurrentAdvance(t *testing.T) {
+	ctx := context.Background()
+	kv := httptest.NewServer(newKVStandIn())
+	defer kv.Close()
+	store, err := NewKVStore(KVConfig{URL: kv.URL})
+	if err != nil {
+		t.Fatalf("new kv store: %v", err)
+	}
+
+	// Replicas racing to reserve from the same mark: exactly one may win.
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		winner uint64
+		wins   int
+	)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mark := uint64(10 * (i + 1))
+			err := store.Advance(ctx, "k", 0, mark)
+			switch {
+			case err == nil:
+				mu.Lock()
+				winner, wins = mark, wins+1
+				mu.Unlock()
+			case !errors.Is(err, ErrConflict):
+				t.Errorf("advance: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Fatalf("%d replicas reserved from the same mark", wins)
+	}
+	if mark, err := store.Load(ctx, "k"); err != nil || mark != winner {
+		t.Fatalf("expected the winning mark %d, got %d, %v", winner, mark, err)
+	}
+}
+
+// kvStandIn is a minimal local stand-in for the service KVStore talks to: decimal values
+// with version ETags and conditional PUTs.
+type kvStandIn struct {
+	mu      sync.Mutex
+	values  map[string]string
+	version map[string]int
+}
+
+func newKVStandIn() *kvStandIn {
+	return &kvStandIn{values: make(map[string]string), version: make(map[string]int)}
+}
+
+func (kv *kvStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	key := r.URL.EscapedPath()
+	etag := fmt.Sprintf(`"%d"`, kv.version[key])
+	_, exists := kv.values[key]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = io.WriteString(w, kv.values[key])
+	case http.MethodPut:
+		if (r.Header.Get("If-None-Match") == "*" && exists) || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if _, err := strconv.ParseUint(string(body), 10, 64); err != nil {
+			http.Error(w, "bad value", http.StatusBadRequest)
+			return
+		}
+		kv.values[key] = string(body)
+		kv.version[key]++
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(kv.values, key)
+		kv.version[key]++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
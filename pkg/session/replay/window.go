@@ -1,21 +1,75 @@
 package replay
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math/bits"
 	"sync"
 )
 
-// Window provides monotonic sequence enforcement with bounded memory.
+// MaxDepth bounds Config.Depth; larger depths are reduced to it. At this depth a window's
+// bitmap takes 2 MiB.
+const MaxDepth = 1 << 24
+
+// blockBits is the number of sequences tracked by one bitmap word.
+const blockBits = 64
+
+// Window provides monotonic sequence enforcement with bounded memory. It is the sliding
+// bitmap of RFC 6479: a ring of 64-bit blocks covering at least depth sequences below the
+// highest seen, plus one spare block so that advancing only ever clears whole blocks.
+// Accept costs O(1) regardless of depth; a jump forward clears at most one ring's worth of
+// blocks.
+//
+// A window opened with a Store survives restarts and moves between processes: before
+// accepting a sequence above its reservation it records a new high-water mark Checkpoint
+// sequences ahead. A window recovered from a mark treats every sequence up to it as
+// already seen, skipping ahead past anything that may have been accepted after the
+// last checkpoint at the cost of refusing at most Checkpoint unused sequences. Each
+// reservation is made from the mark the window last saw, so once another window takes
+// over the key this one stops accepting new reservations.
 type Window struct {
 	mu      sync.Mutex
 	depth   uint64
 	highest uint64
-	seen    map[uint64]struct{}
+	bitmap  []uint64
+	mask    uint64
+	stats   Stats
+
+	store      Store
+	key        string
+	checkpoint uint64
+	reserved   uint64
 }
 
 // Config controls the replay protection behaviour.
 type Config struct {
+	// Depth is how far below the highest sequence a late arrival is still accepted. It
+	// defaults to 2048 and is capped at MaxDepth.
 	Depth uint64
+	// Store, if set, persists windows created with Open. Checkpoint is how many
+	// sequences each recorded mark reserves; it defaults to 1024.
+	Store      Store
+	Checkpoint uint64
+}
+
+// Stats counts what a Window has accepted and rejected.
+type Stats struct {
+	Accepted   uint64
+	Duplicates uint64
+	Stale      uint64
+	// Reordered buckets accepted sequences that arrived below the highest seen by their
+	// distance d from it: Reordered[i] counts 2^i <= d < 2^(i+1).
+	Reordered [64]uint64
+}
+
+// Snapshot is the state of a Window, for carrying it across a restart.
+type Snapshot struct {
+	Highest uint64
+	// Blocks are the bitmap words from the one holding Highest downwards.
+	Blocks []uint64
+	// Reserved is the store mark the window held, or 0 without a store.
+	Reserved uint64
 }
 
 // ErrDuplicate indicates the sequence was already accepted.
@@ -24,20 +78,70 @@ var ErrDuplicate = errors.New("replay: duplicate sequence")
 // ErrStale indicates the sequence is older than the acceptable window.
 var ErrStale = errors.New("replay: stale sequence")
 
-// New creates a replay window with the provided depth.
+// New creates an in-memory replay window with the provided depth; it ignores cfg.Store.
 func New(cfg Config) *Window {
 	depth := cfg.Depth
 	if depth == 0 {
 		depth = 2048
 	}
+	if depth > MaxDepth {
+		depth = MaxDepth
+	}
+	blocks := uint64(1) << bits.Len64((depth+blockBits-1)/blockBits)
 	return &Window{
-		depth: depth,
-		seen:  make(map[uint64]struct{}, int(depth)),
+		depth:  depth,
+		bitmap: make([]uint64, blocks),
+		mask:   blocks - 1,
+	}
+}
+
+// Open creates a window persisted in cfg.Store under key, recovering from the mark
+// already saved there. Without a Store it is the same as New.
+func Open(ctx context.Context, cfg Config, key string) (*Window, error) {
+	w := New(cfg)
+	if cfg.Store == nil {
+		return w, nil
+	}
+	mark, err := cfg.Store.Load(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("replay: load %s: %w", key, err)
+	}
+	w.store, w.key = cfg.Store, key
+	w.checkpoint = cfg.Checkpoint
+	if w.checkpoint == 0 {
+		w.checkpoint = 1024
+	}
+	if mark > 0 {
+		w.highest, w.reserved = mark, mark
+		for i := range w.bitmap {
+			w.bitmap[i] = ^uint64(0)
+		}
 	}
+	return w, nil
+}
+
+// Check reports whether Accept would currently take seq, without recording it. Callers
+// check before authenticating a message and accept after, so forged messages cannot move
+// the window.
+func (w *Window) Check(seq uint64) error {
+	if seq == 0 {
+		return errors.New("replay: sequence must start at 1")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.checkLocked(seq)
+	return err
 }
 
 // Accept validates and records the provided sequence number.
 func (w *Window) Accept(seq uint64) error {
+	return w.AcceptContext(context.Background(), seq)
+}
+
+// AcceptContext is Accept with a context bounding the Store write a new reservation
+// needs. If another window has advanced the store since this one last reserved, it
+// fails with ErrConflict and records nothing.
+func (w *Window) AcceptContext(ctx context.Context, seq uint64) error {
 	if seq == 0 {
 		return errors.New("replay: sequence must start at 1")
 	}
@@ -45,48 +149,112 @@ func (w *Window) Accept(seq uint64) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if w.highest == 0 {
-		w.highest = seq
-		w.seen[seq] = struct{}{}
-		return nil
+	late, err := w.checkLocked(seq)
+	if err != nil {
+		return err
+	}
+	if w.store != nil && seq > w.reserved {
+		mark := seq + w.checkpoint
+		if err := w.store.Advance(ctx, w.key, w.reserved, mark); err != nil {
+			return fmt.Errorf("replay: checkpoint %s: %w", w.key, err)
+		}
+		w.reserved = mark
 	}
 
+	block := seq / blockBits
 	if seq > w.highest {
+		// Clear the blocks the window slides over; past a full ring they are all stale.
+		current := w.highest / blockBits
+		advance := min(block-current, uint64(len(w.bitmap)))
+		for i := uint64(1); i <= advance; i++ {
+			w.bitmap[(current+i)&w.mask] = 0
+		}
 		w.highest = seq
-		w.seen[seq] = struct{}{}
-		w.prune()
-		return nil
 	}
+	w.bitmap[block&w.mask] |= uint64(1) << (seq % blockBits)
+	w.stats.Accepted++
+	if late > 0 {
+		w.stats.Reordered[bits.Len64(late)-1]++
+	}
+	return nil
+}
 
-	if w.highest-seq >= w.depth {
-		return ErrStale
+// checkLocked returns how far seq trails the highest sequence, or why it is refused.
+func (w *Window) checkLocked(seq uint64) (uint64, error) {
+	if seq > w.highest {
+		return 0, nil
 	}
-	if _, exists := w.seen[seq]; exists {
-		return ErrDuplicate
+	late := w.highest - seq
+	if late >= w.depth {
+		w.stats.Stale++
+		return 0, ErrStale
 	}
-
-	w.seen[seq] = struct{}{}
-	return nil
+	if w.bitmap[(seq/blockBits)&w.mask]&(uint64(1)<<(seq%blockBits)) != 0 {
+		w.stats.Duplicates++
+		return 0, ErrDuplicate
+	}
+	return late, nil
 }
 
-// Highest returns the highest sequence observed so far.
-func (w *Window) Highest() uint64 {
+// Snapshot returns the sequences the window has seen, independent of its depth.
+func (w *Window) Snapshot() Snapshot {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.highest
+	top := w.highest / blockBits
+	n := min(uint64(len(w.bitmap)), top+1)
+	snap := Snapshot{Highest: w.highest, Blocks: make([]uint64, n), Reserved: w.reserved}
+	for i := range n {
+		snap.Blocks[i] = w.bitmap[(top-i)&w.mask]
+	}
+	return snap
 }
 
-func (w *Window) prune() {
-	if w.depth == 0 {
+// Restore marks every sequence recorded in snap as seen. Sequences below the snapshot's
+// blocks are unknown and treated as seen too, so a deeper window never re-accepts what a
+// shallower one forgot. It is meant for a window just created or opened, and the window
+// the snapshot came from must accept nothing afterwards.
+//
+// If the store still holds the mark the snapshot was taken under, no other window has
+// reserved since, and the exact snapshot replaces the skip-ahead recovery: sequences
+// between the snapshot and the mark stay acceptable. Otherwise a snapshot behind the
+// recovered mark is ignored, since the mark already refuses everything it could.
+func (w *Window) Restore(snap Snapshot) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	exact := w.store != nil && snap.Reserved != 0 && snap.Reserved == w.reserved
+	if !exact && snap.Highest <= w.highest {
 		return
 	}
-	var threshold uint64
-	if w.highest > w.depth {
-		threshold = w.highest - w.depth
-	}
-	for seq := range w.seen {
-		if seq <= threshold {
-			delete(w.seen, seq)
+	w.highest = snap.Highest
+	top := w.highest / blockBits
+	for i := range uint64(len(w.bitmap)) {
+		block := ^uint64(0)
+		if i < uint64(len(snap.Blocks)) {
+			block = snap.Blocks[i]
 		}
+		w.bitmap[(top-i)&w.mask] = block
 	}
 }
+
+// Forget deletes the window's mark from its Store once the window will not be used
+// again. It is a no-op for in-memory windows.
+func (w *Window) Forget(ctx context.Context) error {
+	if w.store == nil {
+		return nil
+	}
+	return w.store.Delete(ctx, w.key)
+}
+
+// Highest returns the highest sequence observed so far.
+func (w *Window) Highest() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.highest
+}
+
+// Stats returns the window's counters so far.
+func (w *Window) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
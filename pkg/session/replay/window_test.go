@@ -1,6 +1,10 @@
 package replay
 
-import "testing"
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
 
 func TestWindowAccept(t *testing.T) {
 	w := New(Config{Depth: 4})
@@ -21,3 +25,158 @@ func TestWindowAccept(t *testing.T) {
 		t.Fatalf("expected stale error, got %v", err)
 	}
 }
+
+func TestWindowMatchesReference(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, depth := range []uint64{1, 4, 63, 64, 65, 1000, 4096} {
+		w, ref := New(Config{Depth: depth}), newMapWindow(depth)
+		next := uint64(1)
+		for i := 0; i < 20000; i++ {
+			// Mostly in order, with late arrivals, replays and occasional large jumps.
+			var seq uint64
+			switch r := rng.IntN(100); {
+			case r < 60:
+				seq = next
+				next++
+			case r < 95:
+				seq = max(1, next-rng.Uint64N(2*depth+2))
+			default:
+				next += rng.Uint64N(8 * depth)
+				seq = next
+			}
+			if got, want := w.Accept(seq), ref.accept(seq); got != want {
+				t.Fatalf("depth %d step %d seq %d (highest %d): got %v, want %v", depth, i, seq, ref.highest, got, want)
+			}
+		}
+	}
+}
+
+func TestWindowStats(t *testing.T) {
+	w := New(Config{Depth: 16})
+	for _, seq := range []uint64{1, 10, 9, 9, 6, 2, 1} {
+		_ = w.Accept(seq)
+	}
+	stats := w.Stats()
+	if stats.Accepted != 5 || stats.Duplicates != 2 || stats.Stale != 0 {
+		t.Fatalf("unexpected counters %+v", stats)
+	}
+	// 9 is 1 behind (bucket 0), 6 is 4 behind (bucket 2), 2 is 8 behind (bucket 3).
+	if stats.Reordered[0] != 1 || stats.Reordered[2] != 1 || stats.Reordered[3] != 1 {
+		t.Fatalf("unexpected distance histogram %v", stats.Reordered[:4])
+	}
+	_ = w.Accept(100)
+	if err := w.Accept(50); err != ErrStale || w.Stats().Stale != 1 {
+		t.Fatalf("expected stale sequence to be counted, got %v", err)
+	}
+}
+
+func TestWindowDepthBounds(t *testing.T) {
+	w := New(Config{Depth: 1 << 40})
+	if w.depth != MaxDepth {
+		t.Fatalf("depth not capped: %d", w.depth)
+	}
+	if err := w.Accept(MaxDepth + 10); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if err := w.Accept(11); err != nil {
+		t.Fatalf("expected sequence at the far edge of a large window: %v", err)
+	}
+	if err := w.Accept(10); err != ErrStale {
+		t.Fatalf("expected stale just past the window, got %v", err)
+	}
+}
+
+func TestWindowSnapshotRestore(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, depths := range [][2]uint64{{64, 64}, {100, 4096}, {4096, 64}} {
+		w := New(Config{Depth: depths[0]})
+		accepted := make(map[uint64]bool)
+		for i := 0; i < 2000; i++ {
+			seq := 1 + rng.Uint64N(3000)
+			if w.Accept(seq) == nil {
+				accepted[seq] = true
+			}
+		}
+
+		restored := New(Config{Depth: depths[1]})
+		restored.Restore(w.Snapshot())
+		for seq := uint64(1); seq <= w.Highest()+10; seq++ {
+			err := restored.Check(seq)
+			if accepted[seq] && err == nil {
+				t.Fatalf("depths %v: restored window accepts seen sequence %d", depths, seq)
+			}
+			if depths[1] >= depths[0] && w.Check(seq) == nil && err != nil {
+				t.Fatalf("depths %v: restored window refuses fresh sequence %d: %v", depths, seq, err)
+			}
+		}
+	}
+}
+
+func BenchmarkWindowAccept(b *testing.B) {
+	for _, depth := range []uint64{64, 4096, 1 << 20} {
+		b.Run(fmt.Sprintf("bitmap/depth=%d", depth), func(b *testing.B) {
+			w := New(Config{Depth: depth})
+			seq := uint64(0)
+			for b.Loop() {
+				seq++
+				_ = w.Accept(seq)
+			}
+		})
+		if depth > 4096 {
+			continue // the map window takes minutes per run at this depth
+		}
+		b.Run(fmt.Sprintf("map/depth=%d", depth), func(b *testing.B) {
+			w := newMapWindow(depth)
+			seq := uint64(0)
+			for b.Loop() {
+				seq++
+				_ = w.accept(seq)
+			}
+		})
+	}
+}
+
+func BenchmarkWindowAcceptReordered(b *testing.B) {
+	const depth = 4096
+	w := New(Config{Depth: depth})
+	seq := uint64(0)
+	for b.Loop() {
+		// Pairs arrive swapped: 2, 1, 4, 3, ...
+		seq += 2
+		_ = w.Accept(seq)
+		_ = w.Accept(seq - 1)
+	}
+}
+
+// mapWindow is the map-based window Window replaced, kept as a reference for the
+// differential test and benchmarks.
+type mapWindow struct {
+	depth   uint64
+	highest uint64
+	seen    map[uint64]struct{}
+}
+
+func newMapWindow(depth uint64) *mapWindow {
+	return &mapWindow{depth: depth, seen: make(map[uint64]struct{}, int(depth))}
+}
+
+func (w *mapWindow) accept(seq uint64) error {
+	if seq > w.highest {
+		w.highest = seq
+		w.seen[seq] = struct{}{}
+		for s := range w.seen {
+			if w.highest >= w.depth && s <= w.highest-w.depth {
+				delete(w.seen, s)
+			}
+		}
+		return nil
+	}
+	if w.highest-seq >= w.depth {
+		return ErrStale
+	}
+	if _, ok := w.seen[seq]; ok {
+		return ErrDuplicate
+	}
+	w.seen[seq] = struct{}{}
+	return nil
+}
@@ -9,7 +9,16 @@ import (
 type Config struct {
 	Interval   time.Duration
 	MaxPackets uint64
-	Skew       time.Duration
+	// HardLimit is the packet count after which the sender must rekey before sealing
+	// anything else. It defaults to twice MaxPackets; with neither set there is no limit.
+	HardLimit uint64
+	Skew      time.Duration
+	// Grace is how long a receiver keeps the previous epoch's keys after a rekey, so
+	// messages already in flight still open. It defaults to 30 seconds.
+	Grace time.Duration
+	// Rehandshake is how long a session may run on keys from one KEM exchange before a
+	// fresh exchange is due. Zero disables the timer.
+	Rehandshake time.Duration
 }
 
 // Manager tracks packet counts and elapsed time to signal rotation events.
@@ -19,6 +28,7 @@ type Manager struct {
 	start   time.Time
 	packets uint64
 	epoch   uint64
+	kemAt   time.Time
 }
 
 // New creates a rotation manager starting at the provided time and epoch.
@@ -29,13 +39,42 @@ func New(cfg Config, start time.Time, epoch uint64) *Manager {
 	if cfg.Skew <= 0 {
 		cfg.Skew = 5 * time.Second
 	}
+	if cfg.HardLimit == 0 {
+		cfg.HardLimit = 2 * cfg.MaxPackets
+	}
+	if cfg.Grace <= 0 {
+		cfg.Grace = 30 * time.Second
+	}
 	return &Manager{
 		cfg:   cfg,
 		start: start,
 		epoch: epoch,
+		kemAt: start,
 	}
 }
 
+// State is a Manager's progress through its epoch, for carrying it across a restart.
+type State struct {
+	Start   time.Time
+	KEMAt   time.Time
+	Packets uint64
+	Epoch   uint64
+}
+
+// State returns the manager's current progress.
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return State{Start: m.start, KEMAt: m.kemAt, Packets: m.packets, Epoch: m.epoch}
+}
+
+// Restore replaces the manager's progress with st, keeping its configuration.
+func (m *Manager) Restore(st State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start, m.kemAt, m.packets, m.epoch = st.Start, st.KEMAt, st.Packets, st.Epoch
+}
+
 // Record increments packet counts and returns whether rotation should occur.
 func (m *Manager) Record(now time.Time) bool {
 	m.mu.Lock()
@@ -51,6 +90,23 @@ func (m *Manager) ShouldRotate(now time.Time) bool {
 	return m.shouldRotateLocked(now)
 }
 
+// Exhausted reports whether the hard packet limit for the current epoch has been reached.
+func (m *Manager) Exhausted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.HardLimit > 0 && m.packets >= m.cfg.HardLimit
+}
+
+// Interval returns the configured rotation interval.
+func (m *Manager) Interval() time.Duration {
+	return m.cfg.Interval
+}
+
+// Grace returns how long the previous epoch stays usable for receiving after a rekey.
+func (m *Manager) Grace() time.Duration {
+	return m.cfg.Grace
+}
+
 // NextEpoch returns the current epoch identifier.
 func (m *Manager) NextEpoch() uint64 {
 	m.mu.Lock()
@@ -67,6 +123,26 @@ func (m *Manager) Reset(now time.Time) {
 	m.epoch++
 }
 
+// Advance records a fresh key exchange: it resets counters, moves to epoch, and restarts
+// the re-handshake timer. Epochs never move backwards.
+func (m *Manager) Advance(now time.Time, epoch uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start = now
+	m.kemAt = now
+	m.packets = 0
+	if epoch > m.epoch {
+		m.epoch = epoch
+	}
+}
+
+// RehandshakeDue reports whether the keys have outlived Config.Rehandshake.
+func (m *Manager) RehandshakeDue(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.Rehandshake > 0 && !now.Before(m.kemAt.Add(m.cfg.Rehandshake))
+}
+
 func (m *Manager) shouldRotateLocked(now time.Time) bool {
 	if m.cfg.MaxPackets > 0 && m.packets >= m.cfg.MaxPackets {
 		return true
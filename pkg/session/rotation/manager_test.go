@@ -32,3 +32,59 @@ func TestManagerRotationByTime(t *testing.T) {
 		t.Fatal("expected rotation after interval")
 	}
 }
+
+func TestManagerHardLimit(t *testing.T) {
+	now := time.Now()
+	m := New(Config{Interval: time.Hour, MaxPackets: 2}, now, 1)
+
+	for i := 0; i < 4; i++ {
+		if m.Exhausted() {
+			t.Fatalf("exhausted after %d packets", i)
+		}
+		m.Record(now)
+	}
+	if !m.Exhausted() {
+		t.Fatal("expected hard limit at twice MaxPackets")
+	}
+
+	m.Reset(now)
+	if m.Exhausted() || m.NextEpoch() != 2 {
+		t.Fatalf("reset did not start a fresh epoch: epoch %d", m.NextEpoch())
+	}
+}
+
+func TestManagerRehandshakeTimer(t *testing.T) {
+	start := time.Now()
+	m := New(Config{Interval: time.Minute, Rehandshake: time.Hour}, start, 1)
+
+	m.Reset(start.Add(50 * time.Minute))
+	if m.RehandshakeDue(start.Add(59 * time.Minute)) {
+		t.Fatal("rekeying must not restart the re-handshake timer")
+	}
+	if !m.RehandshakeDue(start.Add(time.Hour)) {
+		t.Fatal("expected re-handshake to be due")
+	}
+
+	m.Advance(start.Add(time.Hour), 5)
+	if m.RehandshakeDue(start.Add(time.Hour+time.Minute)) || m.NextEpoch() != 5 {
+		t.Fatalf("advance did not record the exchange: epoch %d", m.NextEpoch())
+	}
+}
+
+func TestManagerRestore(t *testing.T) {
+	start := time.Now()
+	cfg := Config{Interval: time.Hour, MaxPackets: 2, Rehandshake: time.Hour}
+	m := New(cfg, start, 1)
+	m.Reset(start.Add(time.Minute))
+	m.Record(start.Add(time.Minute))
+	m.Record(start.Add(time.Minute))
+
+	restored := New(cfg, time.Now(), 1)
+	restored.Restore(m.State())
+	if restored.State() != m.State() || restored.NextEpoch() != 2 {
+		t.Fatalf("restored %+v, want %+v", restored.State(), m.State())
+	}
+	if !restored.ShouldRotate(start.Add(time.Minute)) || !restored.RehandshakeDue(start.Add(time.Hour)) {
+		t.Fatal("restored manager lost its progress")
+	}
+}
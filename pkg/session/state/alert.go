@@ -0,0 +1,172 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/example/qsafe/pkg/attestation"
+	"github.com/example/qsafe/pkg/session/replay"
+)
+
+var (
+	// ErrDecode indicates a handshake message that is malformed or missing required fields.
+	ErrDecode = errors.New("handshake: malformed message")
+	// ErrModeMismatch indicates the peers run different security modes.
+	ErrModeMismatch = errors.New("handshake: mode mismatch")
+	// ErrBadSignature indicates a transcript or client init signature that does not verify.
+	ErrBadSignature = errors.New("handshake: signature verification failed")
+	// ErrIntegrity indicates a transcript hash, key confirmation or early data tag mismatch.
+	ErrIntegrity = errors.New("handshake: integrity check failed")
+	// ErrPolicyDenied indicates negotiated parameters that local policy does not permit.
+	ErrPolicyDenied = errors.New("handshake: denied by policy")
+)
+
+// AlertSeverity mirrors Alert.Severity in proto/api/v1/handshake.proto.
+type AlertSeverity uint8
+
+const (
+	SeverityUnspecified AlertSeverity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityNames = [...]string{"SEVERITY_UNSPECIFIED", "INFO", "WARNING", "CRITICAL"}
+
+func (s AlertSeverity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("AlertSeverity(%d)", s)
+}
+
+// MarshalText encodes the severity by its proto enum name.
+func (s AlertSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a proto enum name.
+func (s *AlertSeverity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if name == string(text) {
+			*s = AlertSeverity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("handshake: unknown alert severity %q", text)
+}
+
+// AlertCode identifies the class of a handshake failure (Alert.code on the wire).
+type AlertCode string
+
+const (
+	AlertDecodeError          AlertCode = "decode_error"
+	AlertUnexpectedMessage    AlertCode = "unexpected_message"
+	AlertModeMismatch         AlertCode = "mode_mismatch"
+	AlertUnsupportedAlgorithm AlertCode = "unsupported_algorithm"
+	AlertDowngrade            AlertCode = "downgrade"
+	AlertBadSignature         AlertCode = "bad_signature"
+	AlertIntegrity            AlertCode = "integrity_failure"
+	AlertStale                AlertCode = "stale"
+	AlertReplay               AlertCode = "replay"
+	AlertUnauthorized         AlertCode = "unauthorized"
+	AlertAttestation          AlertCode = "attestation_failed"
+	AlertPolicyDenied         AlertCode = "policy_denied"
+	AlertResumptionRefused    AlertCode = "resumption_refused"
+	AlertInternal             AlertCode = "internal_error"
+)
+
+// Alert is the structured failure report sent to a peer in place of raw error text, for
+// handshake steps and for session messages alike. Its fields mirror the Alert message in
+// handshake.proto; Reason is a fixed description of the code and never includes details
+// of the underlying error.
+type Alert struct {
+	Severity        AlertSeverity `json:"severity"`
+	Code            AlertCode     `json:"code"`
+	Reason          string        `json:"reason"`
+	RemediationHint string        `json:"remediation_hint,omitempty"`
+}
+
+// Error lets a received Alert be returned and matched as an error.
+func (a Alert) Error() string {
+	return fmt.Sprintf("handshake alert %s: %s", a.Code, a.Reason)
+}
+
+var alerts = map[AlertCode]Alert{
+	AlertDecodeError:          {SeverityWarning, AlertDecodeError, "message could not be decoded", "check that agent and gateway run compatible protocol versions"},
+	AlertUnexpectedMessage:    {SeverityWarning, AlertUnexpectedMessage, "message not valid in the current handshake or session state", "restart the handshake from the beginning"},
+	AlertModeMismatch:         {SeverityWarning, AlertModeMismatch, "peers are configured for different security modes", "use the mode published at /handshake/config"},
+	AlertUnsupportedAlgorithm: {SeverityWarning, AlertUnsupportedAlgorithm, "no mutually supported algorithm", "align the KEM, signature and AEAD offers with the gateway capabilities"},
+	AlertDowngrade:            {SeverityCritical, AlertDowngrade, "capability negotiation was altered in transit", "do not retry over the same network path; investigate for interception"},
+	AlertBadSignature:         {SeverityCritical, AlertBadSignature, "handshake signature did not verify", "check the pinned signing keys on both sides"},
+	AlertIntegrity:            {SeverityCritical, AlertIntegrity, "transcript, key confirmation or message authentication did not match", "retry the handshake; repeated failures indicate tampering"},
+	AlertStale:                {SeverityWarning, AlertStale, "handshake timestamp outside the accepted window", "synchronise the agent clock with NTP"},
+	AlertReplay:               {SeverityCritical, AlertReplay, "message was already used", "start a fresh handshake; repeated replays indicate an attacker"},
+	AlertUnauthorized:         {SeverityWarning, AlertUnauthorized, "client identity missing or not authorised", "configure an agent identity and register its fingerprint with the gateway"},
+	AlertAttestation:          {SeverityCritical, AlertAttestation, "platform attestation was rejected", "check the agent measurements against the gateway attestation policy"},
+	AlertPolicyDenied:         {SeverityWarning, AlertPolicyDenied, "negotiated parameters are not permitted by policy", "adjust mode, AEAD or rotation settings to the gateway policy"},
+	AlertResumptionRefused:    {SeverityInfo, AlertResumptionRefused, "session ticket could not be used", "discard the ticket and perform a full handshake"},
+	AlertInternal:             {SeverityCritical, AlertInternal, "handshake failed", "retry later; details are in the gateway log"},
+}
+
+// AlertFor classifies a handshake or session error. Errors that match no known class,
+// including failures of local primitives and storage, map to AlertInternal. A received
+// Alert maps to itself.
+func AlertFor(err error) Alert {
+	var received Alert
+	if errors.As(err, &received) {
+		return received
+	}
+	return alerts[classify(err)]
+}
+
+func classify(err error) AlertCode {
+	switch {
+	case errors.Is(err, ErrUnexpectedMessage), errors.Is(err, ErrUnknownEpoch):
+		return AlertUnexpectedMessage
+	case errors.Is(err, ErrDecode), errors.Is(err, ErrStreamChunkTooLarge):
+		return AlertDecodeError
+	case errors.Is(err, ErrDowngrade):
+		return AlertDowngrade
+	case errors.Is(err, ErrReplayedInit), errors.Is(err, replay.ErrDuplicate), errors.Is(err, replay.ErrStale):
+		return AlertReplay
+	case errors.Is(err, ErrStaleInit):
+		return AlertStale
+	case errors.Is(err, ErrIntegrity), errors.Is(err, ErrFinishedMismatch), errors.Is(err, ErrDecrypt),
+		errors.Is(err, ErrStreamTruncated), errors.Is(err, ErrStreamOrder), errors.Is(err, ErrStreamExtended):
+		return AlertIntegrity
+	case errors.Is(err, ErrBadSignature):
+		return AlertBadSignature
+	case errors.Is(err, ErrResumptionRefused), errors.Is(err, ErrResumptionDisabled):
+		return AlertResumptionRefused
+	case isAttestationFailure(err):
+		return AlertAttestation
+	case errors.Is(err, ErrClientAuthRequired), errors.Is(err, ErrClientNotAuthorized):
+		return AlertUnauthorized
+	case errors.Is(err, ErrNoCommonAlgorithm), errors.Is(err, ErrUnexpectedSelection):
+		return AlertUnsupportedAlgorithm
+	case errors.Is(err, ErrModeMismatch):
+		return AlertModeMismatch
+	case errors.Is(err, ErrPolicyDenied):
+		return AlertPolicyDenied
+	default:
+		return AlertInternal
+	}
+}
+
+func isAttestationFailure(err error) bool {
+	for _, target := range []error{
+		attestation.ErrMissingEvidence,
+		attestation.ErrNonceMismatch,
+		attestation.ErrStaleEvidence,
+		attestation.ErrUntrustedChain,
+		attestation.ErrBadSignature,
+		attestation.ErrPolicyVersion,
+		attestation.ErrMeasurementMismatch,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/example/qsafe/pkg/attestation"
+	"github.com/example/qsafe/pkg/session/replay"
+	"github.com/example/qsafe/pkg/session/ticket"
+)
+
+func TestAlertFor(t *testing.T) {
+	cases := []struct {
+		err      error
+		code     AlertCode
+		severity AlertSeverity
+	}{
+		{fmt.Errorf("%w: bad json", ErrDecode), AlertDecodeError, SeverityWarning},
+		{fmt.Errorf("%w: expected strict got hybrid", ErrModeMismatch), AlertModeMismatch, SeverityWarning},
+		{fmt.Errorf("%w: aead offer", ErrNoCommonAlgorithm), AlertUnsupportedAlgorithm, SeverityWarning},
+		{fmt.Errorf("%w: selected", ErrDowngrade), AlertDowngrade, SeverityCritical},
+		{fmt.Errorf("%w: invalid", ErrBadSignature), AlertBadSignature, SeverityCritical},
+		{fmt.Errorf("%w: transcript hash", ErrIntegrity), AlertIntegrity, SeverityCritical},
+		{ErrFinishedMismatch, AlertIntegrity, SeverityCritical},
+		{fmt.Errorf("%w: timestamp", ErrStaleInit), AlertStale, SeverityWarning},
+		{ErrReplayedInit, AlertReplay, SeverityCritical},
+		{ErrClientAuthRequired, AlertUnauthorized, SeverityWarning},
+		{fmt.Errorf("handshake: %w", attestation.ErrMeasurementMismatch), AlertAttestation, SeverityCritical},
+		{fmt.Errorf("%w: %w", ErrPolicyDenied, errors.New("policy: mode")), AlertPolicyDenied, SeverityWarning},
+		{fmt.Errorf("%w: %w", ErrResumptionRefused, ticket.ErrReused), AlertResumptionRefused, SeverityInfo},
+		{fmt.Errorf("%w: confirming while idle", ErrUnexpectedMessage), AlertUnexpectedMessage, SeverityWarning},
+		{fmt.Errorf("session: stream chunk 3: %w", replay.ErrDuplicate), AlertReplay, SeverityCritical},
+		{fmt.Errorf("%w: 7 (current 9)", ErrUnknownEpoch), AlertUnexpectedMessage, SeverityWarning},
+		{fmt.Errorf("%w after 2 chunks", ErrStreamTruncated), AlertIntegrity, SeverityCritical},
+		{fmt.Errorf("%w: message authentication failed", ErrDecrypt), AlertIntegrity, SeverityCritical},
+		{fmt.Errorf("%w: chunk 0 seals 9000 bytes", ErrStreamChunkTooLarge), AlertDecodeError, SeverityWarning},
+		{errors.New("handshake: random: entropy exhausted"), AlertInternal, SeverityCritical},
+	}
+	for _, tc := range cases {
+		alert := AlertFor(tc.err)
+		if alert.Code != tc.code || alert.Severity != tc.severity {
+			t.Errorf("%v: got %s/%s, want %s/%s", tc.err, alert.Code, alert.Severity, tc.code, tc.severity)
+		}
+		if alert.Reason == "" || alert.RemediationHint == "" {
+			t.Errorf("%v: alert lacks reason or hint: %+v", tc.err, alert)
+		}
+		if strings.Contains(alert.Reason, tc.err.Error()) {
+			t.Errorf("%v: alert reason leaks error text", tc.err)
+		}
+	}
+}
+
+func TestAlertWireFormat(t *testing.T) {
+	encoded, err := json.Marshal(AlertFor(ErrReplayedInit))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"severity":"CRITICAL"`) || !strings.Contains(string(encoded), `"code":"replay"`) {
+		t.Fatalf("unexpected encoding %s", encoded)
+	}
+	var decoded Alert
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// A received alert keeps its classification when passed through AlertFor again.
+	wrapped := fmt.Errorf("handshake exchange: %w", decoded)
+	if got := AlertFor(wrapped); got != decoded {
+		t.Fatalf("round trip changed alert: %+v != %+v", got, decoded)
+	}
+}
@@ -0,0 +1,48 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/example/qsafe/pkg/attestation"
+)
+
+// attestationChallenge binds evidence to this handshake: the client nonce and the KEM
+// ciphertext are both fresh, so a quote cannot be replayed into another session.
+func attestationChallenge(nonce, ciphertext []byte) []byte {
+	h := blake3.New()
+	_, _ = h.Write([]byte("qsafe-attestation"))
+	_, _ = h.Write(nonce)
+	_, _ = h.Write(hashBytes(ciphertext))
+	return h.Sum(nil)
+}
+
+// attest collects evidence from the configured attester for the given init.
+func (c *Client) attest(ctx context.Context, init *ClientInit) error {
+	if c.cfg.Attester == nil {
+		return nil
+	}
+	bundle, err := c.cfg.Attester.Attest(ctx, attestationChallenge(init.Nonce, init.Ciphertext))
+	if err != nil {
+		return fmt.Errorf("handshake: attestation: %w", err)
+	}
+	init.Attestation = &bundle
+	return nil
+}
+
+// verifyAttestation refuses the handshake unless the client's evidence satisfies the
+// configured verifier. It runs before decapsulation so no keys exist for failed peers.
+func (s *Server) verifyAttestation(ctx context.Context, init ClientInit) error {
+	if s.cfg.Attestation == nil {
+		return nil
+	}
+	if init.Attestation == nil {
+		return fmt.Errorf("handshake: %w", attestation.ErrMissingEvidence)
+	}
+	if _, err := s.cfg.Attestation.Verify(ctx, *init.Attestation, attestationChallenge(init.Nonce, init.Ciphertext)); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/attestation"
+)
+
+func TestHandshakeAttestation(t *testing.T) {
+	ctx := context.Background()
+
+	sim, err := attestation.NewSimulator([]byte("state-test"))
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	verifier, err := attestation.NewVerifier(sim.Policy())
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+
+	server, _ := newHandshakePair(t, withServer(func(cfg *ServerConfig) { cfg.Attestation = verifier }))
+	newClient := func(attester attestation.Attester) *Client {
+		return newHandshakeClient(t, server, func(cfg *ClientConfig) { cfg.Attester = attester })
+	}
+
+	init, pending, err := newClient(sim).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, serverSide, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	clientSide, err := pending.Finish(ctx, resp)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if !bytes.Equal(clientSide.ClientToServer.Bytes(), serverSide.ClientToServer.Bytes()) {
+		t.Fatal("client->server keys differ")
+	}
+
+	// Evidence is bound to the ciphertext, so it cannot be lifted into another handshake.
+	other, _, err := newClient(nil).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *other); !errors.Is(err, attestation.ErrMissingEvidence) {
+		t.Fatalf("expected missing evidence, got %v", err)
+	}
+	lifted, _, err := newClient(nil).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	lifted.Attestation = init.Attestation
+	if _, _, err := server.Accept(ctx, *lifted); !errors.Is(err, attestation.ErrNonceMismatch) {
+		t.Fatalf("expected nonce mismatch, got %v", err)
+	}
+
+	tampered, err := attestation.NewSimulator([]byte("state-test"))
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	tampered.SetMeasurement(7, []byte("unexpected"))
+	bad, _, err := newClient(tampered).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *bad); !errors.Is(err, attestation.ErrMeasurementMismatch) {
+		t.Fatalf("expected measurement mismatch, got %v", err)
+	}
+}
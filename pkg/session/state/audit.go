@@ -0,0 +1,133 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+// ErrRecordUnverified is returned by VerifyRecord for a record that is internally
+// consistent but carries no transcript hash or no server signature, such as a record
+// of an init refused before it was answered or of a resumption. Nothing in it can be
+// checked against the server's key.
+var ErrRecordUnverified = errors.New("handshake: record cannot be verified")
+
+// HandshakeRecord captures what one side hashed and verified during a handshake or
+// resumption, so a failure can be re-examined offline with VerifyRecord. It holds no
+// secrets: transcript entries bind ciphertexts and tickets by hash only.
+type HandshakeRecord struct {
+	Role       string            `json:"role"`
+	Time       time.Time         `json:"time"`
+	Transcript transcript.Record `json:"transcript"`
+	// TranscriptHash is the commitment the server signed (or, for resumption,
+	// confirmed). On the client it is the value received, which may differ from the
+	// recomputed transcript when the handshake failed.
+	TranscriptHash []byte `json:"transcript_hash,omitempty"`
+	// Signature and Server are the server's signature over TranscriptHash and the key it
+	// should verify under. Resumption records carry neither.
+	Signature         []byte        `json:"signature,omitempty"`
+	Server            *PeerIdentity `json:"server,omitempty"`
+	ServerFingerprint string        `json:"server_fingerprint,omitempty"`
+	// Client is the identity the client presented, if any; its signature is the
+	// client_signature transcript entry.
+	Client            *PeerIdentity `json:"client,omitempty"`
+	ClientFingerprint string        `json:"client_fingerprint,omitempty"`
+	// Alert is set when the handshake failed on this side.
+	Alert *Alert `json:"alert,omitempty"`
+}
+
+// newRecord assembles a record from a transcript and, if err is non-nil, its alert.
+func newRecord(role Role, trans *transcript.Accumulator, hash, signature []byte, server, client *PeerIdentity, err error) HandshakeRecord {
+	rec := HandshakeRecord{
+		Role:           role.String(),
+		Time:           time.Now().UTC(),
+		Transcript:     trans.Record(),
+		TranscriptHash: hash,
+		Signature:      signature,
+		Server:         server,
+		Client:         client,
+	}
+	if server != nil {
+		rec.ServerFingerprint = server.Fingerprint()
+	}
+	if client != nil {
+		rec.ClientFingerprint = client.Fingerprint()
+	}
+	if err != nil {
+		alert := AlertFor(err)
+		rec.Alert = &alert
+	}
+	return rec
+}
+
+// VerifyRecord independently re-checks a HandshakeRecord: it recomputes the transcript
+// from the recorded encodings, compares the result with TranscriptHash, and verifies
+// the client signature (if present) and the server signature under the recorded public
+// keys. Fingerprints are recomputed rather than trusted. A record that passes every
+// check but has no transcript hash or server signature yields ErrRecordUnverified; only
+// a nil error means the transcript was signed by the recorded server key.
+func VerifyRecord(rec HandshakeRecord) error {
+	computed, err := rec.Transcript.Recompute()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIntegrity, err)
+	}
+	if rec.TranscriptHash != nil && !constantTimeEqual(computed, rec.TranscriptHash) {
+		return fmt.Errorf("%w: recorded transcript hash differs from recomputed transcript", ErrIntegrity)
+	}
+	if err := checkFingerprint("server", rec.Server, rec.ServerFingerprint); err != nil {
+		return err
+	}
+	if err := checkFingerprint("client", rec.Client, rec.ClientFingerprint); err != nil {
+		return err
+	}
+
+	for i, e := range rec.Transcript.Entries {
+		if e.Label != "client_signature" {
+			continue
+		}
+		if rec.Client == nil || i == 0 {
+			return fmt.Errorf("%w: client signature without a client identity", ErrDecode)
+		}
+		signature, err := transcript.ParseRaw(e.Encoding)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDecode, err)
+		}
+		if err := verifyRecordSignature(*rec.Client, rec.Transcript.Entries[i-1].Hash, signature, clientSignatureContext); err != nil {
+			return fmt.Errorf("%w: client signature: %v", ErrBadSignature, err)
+		}
+	}
+
+	if rec.Signature != nil {
+		if rec.Server == nil {
+			return fmt.Errorf("%w: server signature without a server key", ErrDecode)
+		}
+		if err := verifyRecordSignature(*rec.Server, computed, rec.Signature, handshakeSignatureContext); err != nil {
+			return fmt.Errorf("%w: server signature: %v", ErrBadSignature, err)
+		}
+	}
+	switch {
+	case rec.TranscriptHash == nil:
+		return fmt.Errorf("%w: no transcript hash", ErrRecordUnverified)
+	case rec.Signature == nil:
+		return fmt.Errorf("%w: no server signature", ErrRecordUnverified)
+	}
+	return nil
+}
+
+func verifyRecordSignature(id PeerIdentity, hash, signature []byte, context string) error {
+	scheme, err := sign.Lookup(id.Scheme)
+	if err != nil {
+		return err
+	}
+	return verifyTranscript(scheme, id.PublicKey, hash, signature, context)
+}
+
+func checkFingerprint(role string, id *PeerIdentity, fingerprint string) error {
+	if id == nil || fingerprint == "" || id.Fingerprint() == fingerprint {
+		return nil
+	}
+	return fmt.Errorf("%w: %s fingerprint does not match its public key", ErrIntegrity, role)
+}
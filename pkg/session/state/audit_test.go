@@ -0,0 +1,120 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+func TestHandshakeRecordVerifies(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+	sigSuite := sign.NewMLDSA65()
+	clientKeys, err := sigSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate client identity: %v", err)
+	}
+	client.cfg.Identity = &ClientIdentity{Scheme: sigSuite, KeyPair: clientKeys}
+
+	var serverRecs, clientRecs []HandshakeRecord
+	server.cfg.Audit = func(rec HandshakeRecord) { serverRecs = append(serverRecs, rec) }
+	client.cfg.Audit = func(rec HandshakeRecord) { clientRecs = append(clientRecs, rec) }
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, _, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if len(serverRecs) != 1 || len(clientRecs) != 1 {
+		t.Fatalf("expected one record per side, got %d and %d", len(serverRecs), len(clientRecs))
+	}
+
+	for _, rec := range []HandshakeRecord{serverRecs[0], clientRecs[0]} {
+		// Records must survive the audit sink's serialisation.
+		raw, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatalf("marshal record: %v", err)
+		}
+		var decoded HandshakeRecord
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			t.Fatalf("unmarshal record: %v", err)
+		}
+		if decoded.Alert != nil || len(decoded.Transcript.Entries) != 3 {
+			t.Fatalf("%s record: unexpected contents %+v", decoded.Role, decoded)
+		}
+		if err := VerifyRecord(decoded); err != nil {
+			t.Fatalf("%s record: %v", decoded.Role, err)
+		}
+		if decoded.ClientFingerprint != client.cfg.Identity.Public().Fingerprint() {
+			t.Fatalf("%s record: client fingerprint %s", decoded.Role, decoded.ClientFingerprint)
+		}
+	}
+
+	rec := serverRecs[0]
+	forged := rec
+	forged.Signature = append([]byte(nil), rec.Signature...)
+	forged.Signature[0] ^= 0xff
+	if err := VerifyRecord(forged); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected forged signature to fail, got %v", err)
+	}
+	edited := rec
+	edited.Transcript.Entries = append(rec.Transcript.Entries[:0:0], rec.Transcript.Entries...)
+	edited.Transcript.Entries[2].Encoding = append([]byte(nil), rec.Transcript.Entries[2].Encoding...)
+	edited.Transcript.Entries[2].Encoding[10] ^= 0x01
+	if err := VerifyRecord(edited); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected edited entry to fail, got %v", err)
+	}
+	mislabelled := rec
+	mislabelled.ServerFingerprint = rec.ClientFingerprint
+	if err := VerifyRecord(mislabelled); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected mismatched fingerprint to fail, got %v", err)
+	}
+	// A consistent record that nothing signed is not reported as verified.
+	unsigned := rec
+	unsigned.Signature = nil
+	if err := VerifyRecord(unsigned); !errors.Is(err, ErrRecordUnverified) {
+		t.Fatalf("expected unsigned record to be unverified, got %v", err)
+	}
+	hashless := unsigned
+	hashless.TranscriptHash = nil
+	if err := VerifyRecord(hashless); !errors.Is(err, ErrRecordUnverified) {
+		t.Fatalf("expected record without a hash to be unverified, got %v", err)
+	}
+}
+
+func TestHandshakeRecordOnFailure(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+	var recs []HandshakeRecord
+	client.cfg.Audit = func(rec HandshakeRecord) { recs = append(recs, rec) }
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, _, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	resp.Payload.RotationSecs++
+	if _, err := pending.Finish(ctx, resp); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected tampered payload to fail, got %v", err)
+	}
+	if len(recs) != 1 || recs[0].Alert == nil || recs[0].Alert.Code != AlertIntegrity {
+		t.Fatalf("expected a record with an integrity alert, got %+v", recs)
+	}
+	// The record shows what the client hashed, which no longer matches what the server
+	// signed.
+	if err := VerifyRecord(recs[0]); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected verifier to report the mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+)
+
+// ErrEarlyDataNotPermitted indicates the ticket was issued without early data permission.
+var ErrEarlyDataNotPermitted = errors.New("handshake: ticket does not permit early data")
+
+// defaultMaxEarlyData bounds the early data ciphertext a server will attempt to open.
+const defaultMaxEarlyData = 16 << 10
+
+// EarlyData is 0-RTT application data received with a ResumeInit. It is authenticated by
+// the ticket secret only, before the client has proven liveness, so an attacker who
+// captured the ResumeInit may deliver it again: Replayable is always true and the
+// application must only act on it if the operation is idempotent.
+type EarlyData struct {
+	Plaintext  []byte
+	Metadata   map[string]string
+	Replayable bool
+}
+
+// earlyDataKeys derives 0-RTT keys from the ticket secret and the transcript after
+// resume_init, which already commits to the client nonce and ticket.
+func earlyDataKeys(secret, initHash []byte, cfg scheduler.Config) (scheduler.Keys, error) {
+	h := blake3.New()
+	_, _ = h.Write([]byte("qsafe-early-data"))
+	_, _ = h.Write(initHash)
+	keys, err := scheduler.Derive(secret, h.Sum(nil), cfg)
+	if err != nil {
+		return scheduler.Keys{}, fmt.Errorf("handshake: derive early data keys: %w", err)
+	}
+	return keys, nil
+}
+
+// sealEarlyData encrypts the single early data envelope (sequence 1, epoch 0).
+func sealEarlyData(aead string, keys scheduler.Keys, plaintext []byte, metadata map[string]string) (Envelope, error) {
+	cipher, err := newCipher(aead, keys.ClientToServer.Bytes())
+	if err != nil {
+		return Envelope{}, err
+	}
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+	metaCopy := copyMap(metadata)
+	nonce := computeNonce(keys.SessionID, 1, RoleClient, cipher.NonceSize())
+	return Envelope{
+		Ciphertext: cipher.Seal(nil, nonce, plaintext, metadataAAD(metaCopy)),
+		Nonce:      nonce,
+		Sequence:   1,
+		Metadata:   metaCopy,
+	}, nil
+}
+
+func openEarlyData(aead string, keys scheduler.Keys, env Envelope) (*EarlyData, error) {
+	if env.Sequence != 1 || env.Epoch != 0 {
+		return nil, fmt.Errorf("%w: early data must be a single envelope", ErrDecode)
+	}
+	cipher, err := newCipher(aead, keys.ClientToServer.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := computeNonce(keys.SessionID, 1, RoleClient, cipher.NonceSize())
+	plaintext, err := cipher.Open(nil, nonce, env.Ciphertext, metadataAAD(env.Metadata))
+	if err != nil {
+		return nil, fmt.Errorf("%w: early data: %v", ErrIntegrity, err)
+	}
+	return &EarlyData{Plaintext: plaintext, Metadata: copyMap(env.Metadata), Replayable: true}, nil
+}
+
+// earlyDataPermitted decides whether early data on a redeemed ticket may be opened. The
+// early data cache refuses rather than evicts when full, so a ticket is never forgotten
+// while it could still be replayed.
+func (s *Server) earlyDataPermitted(st ticketState, ticket []byte, env *Envelope) bool {
+	if env == nil || !st.EarlyData || len(env.Ciphertext) > s.cfg.MaxEarlyData {
+		return false
+	}
+	if s.cfg.Policy != nil && s.cfg.Policy.ValidateEarlyData(s.cfg.Mode) != nil {
+		return false
+	}
+	return s.cfg.EarlyDataReplay.Insert(s.now(), hashBytes(ticket)) == nil
+}
@@ -0,0 +1,138 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/qsafe/pkg/session/policy"
+)
+
+func TestResumeEarlyData(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"), withResumption(policy.Config{AllowedModes: []string{"hybrid"}}))
+
+	stored := issueClientTicket(t, ctx, server, client)
+	if !stored.EarlyData {
+		t.Fatal("expected ticket to permit early data")
+	}
+	init, pending, err := client.ResumeWithEarlyData(ctx, stored, []byte("GET /status"), map[string]string{"path": "/status"})
+	if err != nil {
+		t.Fatalf("resume with early data: %v", err)
+	}
+	resp, resumed, err := server.Resume(ctx, *init)
+	if err != nil {
+		t.Fatalf("server resume: %v", err)
+	}
+	if resumed.EarlyData == nil || !bytes.Equal(resumed.EarlyData.Plaintext, []byte("GET /status")) {
+		t.Fatalf("early data not delivered: %+v", resumed.EarlyData)
+	}
+	if !resumed.EarlyData.Replayable || resumed.EarlyData.Metadata["path"] != "/status" {
+		t.Fatalf("unexpected early data attributes: %+v", resumed.EarlyData)
+	}
+	clientKeys, err := pending.Finish(ctx, resp)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if !pending.EarlyDataAccepted() {
+		t.Fatal("client did not observe early data acceptance")
+	}
+	if !bytes.Equal(clientKeys.ClientToServer.Bytes(), resumed.Keys.ClientToServer.Bytes()) {
+		t.Fatal("resumed keys differ")
+	}
+
+	// A tampered envelope aborts the handshake rather than being silently dropped.
+	stored = issueClientTicket(t, ctx, server, client)
+	init, _, err = client.ResumeWithEarlyData(ctx, stored, []byte("again"), nil)
+	if err != nil {
+		t.Fatalf("resume with early data: %v", err)
+	}
+	init.EarlyData.Ciphertext[0] ^= 0xff
+	if _, _, err := server.Resume(ctx, *init); err == nil {
+		t.Fatal("expected tampered early data to fail")
+	}
+}
+
+func TestResumeEarlyDataRefusedOnReplayedTicket(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"), withResumption(policy.Config{AllowedModes: []string{"hybrid"}}))
+	stored := issueClientTicket(t, ctx, server, client)
+
+	// Record the ticket as having carried early data, as if an earlier ResumeInit had
+	// been accepted and the keyring had since forgotten the redemption.
+	if err := server.cfg.EarlyDataReplay.Insert(time.Now(), hashBytes(stored.Ticket)); err != nil {
+		t.Fatalf("seed early data cache: %v", err)
+	}
+	init, pending, err := client.ResumeWithEarlyData(ctx, stored, []byte("transfer"), nil)
+	if err != nil {
+		t.Fatalf("resume with early data: %v", err)
+	}
+	resp, resumed, err := server.Resume(ctx, *init)
+	if err != nil {
+		t.Fatalf("server resume: %v", err)
+	}
+	if resumed.EarlyData != nil {
+		t.Fatal("early data accepted twice for one ticket")
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if pending.EarlyDataAccepted() {
+		t.Fatal("client believes refused early data was accepted")
+	}
+}
+
+func TestResumeEarlyDataDisabledByPolicy(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"), withResumption(policy.Config{AllowedModes: []string{"hybrid"}, DisableEarlyData: true}))
+	stored := issueClientTicket(t, ctx, server, client)
+	if stored.EarlyData {
+		t.Fatal("ticket permits early data despite policy")
+	}
+	if _, _, err := client.ResumeWithEarlyData(ctx, stored, []byte("x"), nil); !errors.Is(err, ErrEarlyDataNotPermitted) {
+		t.Fatalf("expected ErrEarlyDataNotPermitted, got %v", err)
+	}
+
+	// A client ignoring the ticket flag still cannot get its data opened.
+	stored.EarlyData = true
+	init, _, err := client.ResumeWithEarlyData(ctx, stored, []byte("x"), nil)
+	if err != nil {
+		t.Fatalf("resume with early data: %v", err)
+	}
+	_, resumed, err := server.Resume(ctx, *init)
+	if err != nil {
+		t.Fatalf("server resume: %v", err)
+	}
+	if resumed.EarlyData != nil {
+		t.Fatal("early data accepted despite policy")
+	}
+}
+
+func issueClientTicket(t *testing.T, ctx context.Context, server *Server, client *Client) ClientTicket {
+	t.Helper()
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, keys, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if _, err := pending.Finished(); err != nil {
+		t.Fatalf("client finished: %v", err)
+	}
+	nst, err := server.IssueTicket(keys, resp.Payload.Selected, nil)
+	if err != nil {
+		t.Fatalf("issue ticket: %v", err)
+	}
+	stored, err := pending.StoreTicket(nst)
+	if err != nil {
+		t.Fatalf("store ticket: %v", err)
+	}
+	return stored
+}
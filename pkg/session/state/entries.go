@@ -0,0 +1,103 @@
+package state
+
+import (
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+// Transcript entries. Each type fixes the tags of its fields; the tag assignments are
+// part of the protocol and are specified, with test vectors, in
+// docs/transcript_encoding.md. Tags are never reused: a removed field retires its tag.
+
+// clientInitEntry is ClientInit as it enters the transcript. The ciphertext is bound by
+// hash, and the cookie and identity signature are left out because they are attached
+// after the transcript is taken.
+type clientInitEntry ClientInit
+
+func (c clientInitEntry) MarshalTranscript(e *transcript.Encoder) {
+	e.Uint(1, uint64(c.Version))
+	e.String(2, c.Mode)
+	e.Time(3, c.Timestamp)
+	e.Bytes(4, c.Nonce)
+	e.String(5, c.KEM)
+	e.Nested(6, c.Capabilities.MarshalTranscript)
+	e.Bytes(7, hashBytes(c.Ciphertext))
+	if len(c.ClassicalShare) > 0 {
+		e.Bytes(8, c.ClassicalShare)
+	}
+	if c.Identity != nil {
+		e.Nested(9, func(n *transcript.Encoder) {
+			n.String(1, c.Identity.Scheme)
+			n.Bytes(2, c.Identity.PublicKey)
+		})
+	}
+	if c.Attestation != nil {
+		e.Nested(10, func(n *transcript.Encoder) {
+			n.Bytes(1, c.Attestation.Evidence)
+			n.Bytes(2, c.Attestation.Signature)
+			n.Bytes(3, c.Attestation.CertificateChain)
+			n.String(4, c.Attestation.PolicyVersion)
+			n.Bytes(5, c.Attestation.Nonce)
+		})
+	}
+}
+
+// MarshalTranscript implements transcript.Marshaler.
+func (c CapabilitySet) MarshalTranscript(e *transcript.Encoder) {
+	e.Strings(1, c.PQKEMs)
+	e.Strings(2, c.PQSigs)
+	e.Strings(3, c.AEADs)
+	e.Strings(4, c.Transports)
+}
+
+// MarshalTranscript implements transcript.Marshaler.
+func (s Selection) MarshalTranscript(e *transcript.Encoder) {
+	e.String(1, s.PQKEM)
+	e.String(2, s.PQSig)
+	e.String(3, s.AEAD)
+}
+
+// MarshalTranscript implements transcript.Marshaler.
+func (p ServerPayload) MarshalTranscript(e *transcript.Encoder) {
+	e.Uint(1, uint64(p.Version))
+	e.String(2, p.Mode)
+	e.Time(3, p.Timestamp)
+	e.Bytes(4, p.Nonce)
+	e.Uint(5, uint64(p.RotationSecs))
+	e.Nested(6, p.Capabilities.MarshalTranscript)
+	e.Nested(7, p.Selected.MarshalTranscript)
+	e.Nested(8, p.ClientOffer.MarshalTranscript)
+	if len(p.ClassicalShare) > 0 {
+		e.Bytes(9, p.ClassicalShare)
+	}
+}
+
+// resumeInitEntry is ResumeInit as it enters the transcript: the ticket is bound by hash
+// and early data is appended as its own entry.
+type resumeInitEntry ResumeInit
+
+func (r resumeInitEntry) MarshalTranscript(e *transcript.Encoder) {
+	e.Uint(1, uint64(r.Version))
+	e.String(2, r.Mode)
+	e.Time(3, r.Timestamp)
+	e.Bytes(4, r.Nonce)
+	e.Bytes(5, hashBytes(r.Ticket))
+}
+
+// earlyDataEntry binds the 0-RTT envelope by ciphertext hash and metadata.
+type earlyDataEntry Envelope
+
+func (d earlyDataEntry) MarshalTranscript(e *transcript.Encoder) {
+	e.Bytes(1, hashBytes(d.Ciphertext))
+	e.Map(2, d.Metadata)
+}
+
+// MarshalTranscript implements transcript.Marshaler.
+func (p ResumePayload) MarshalTranscript(e *transcript.Encoder) {
+	e.Uint(1, uint64(p.Version))
+	e.String(2, p.Mode)
+	e.Time(3, p.Timestamp)
+	e.Bytes(4, p.Nonce)
+	e.Uint(5, uint64(p.RotationSecs))
+	e.Nested(6, p.Selected.MarshalTranscript)
+	e.Bool(7, p.EarlyDataAccepted)
+}
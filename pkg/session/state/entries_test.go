@@ -0,0 +1,295 @@
+package state
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/example/qsafe/pkg/attestation"
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+var updateVectors = flag.Bool("update", false, "regenerate testdata/transcript_vectors.json")
+
+const vectorsPath = "testdata/transcript_vectors.json"
+
+// transcriptVectors is the published test vector file. Entries pair a message in its
+// wire JSON form with the canonical encoding of the corresponding transcript entry;
+// transcripts list entries by name with the snapshot after each one.
+type transcriptVectors struct {
+	Version     int                `json:"version"`
+	Entries     []entryVector      `json:"entries"`
+	Transcripts []transcriptVector `json:"transcripts"`
+}
+
+type entryVector struct {
+	Name     string          `json:"name"`
+	Label    string          `json:"label"`
+	Message  json.RawMessage `json:"message"`
+	Encoding string          `json:"encoding"`
+}
+
+type transcriptVector struct {
+	Name      string   `json:"name"`
+	Domain    string   `json:"domain"`
+	Entries   []string `json:"entries"`
+	Snapshots []string `json:"snapshots"`
+}
+
+func TestTranscriptVectors(t *testing.T) {
+	if *updateVectors {
+		writeVectors(t)
+	}
+	raw, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatalf("read vectors: %v", err)
+	}
+	var vectors transcriptVectors
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatalf("decode vectors: %v", err)
+	}
+	if vectors.Version != transcript.Version {
+		t.Fatalf("vectors are for encoding v%d, package implements v%d", vectors.Version, transcript.Version)
+	}
+
+	entries := make(map[string]entryVector, len(vectors.Entries))
+	for _, v := range vectors.Entries {
+		m, err := decodeEntry(v.Label, v.Message)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		if got := hex.EncodeToString(transcript.Encode(m)); got != v.Encoding {
+			t.Errorf("%s: encoding\n got %s\nwant %s", v.Name, got, v.Encoding)
+		}
+		entries[v.Name] = v
+	}
+	for _, tv := range vectors.Transcripts {
+		if len(tv.Entries) != len(tv.Snapshots) {
+			t.Fatalf("%s: %d entries but %d snapshots", tv.Name, len(tv.Entries), len(tv.Snapshots))
+		}
+		acc := transcript.New(tv.Domain)
+		for i, name := range tv.Entries {
+			v, ok := entries[name]
+			if !ok {
+				t.Fatalf("%s: unknown entry %q", tv.Name, name)
+			}
+			m, _ := decodeEntry(v.Label, v.Message)
+			if err := acc.Append(v.Label, m); err != nil {
+				t.Fatalf("%s: append %s: %v", tv.Name, name, err)
+			}
+			if got := hex.EncodeToString(acc.Snapshot()); got != tv.Snapshots[i] {
+				t.Errorf("%s: snapshot after %s\n got %s\nwant %s", tv.Name, name, got, tv.Snapshots[i])
+			}
+		}
+	}
+}
+
+// TestClientInitEntryIgnoresDetachedFields checks that fields attached after the
+// transcript is taken do not change the encoding.
+func TestClientInitEntryIgnoresDetachedFields(t *testing.T) {
+	init := vectorClientInit(true)
+	base := transcript.Encode(clientInitEntry(init))
+	init.Cookie = []byte("cookie")
+	init.IdentitySignature = []byte("signature")
+	if !bytes.Equal(base, transcript.Encode(clientInitEntry(init))) {
+		t.Fatal("cookie or identity signature leaked into client_init")
+	}
+	init.Ciphertext[0] ^= 0xff
+	if bytes.Equal(base, transcript.Encode(clientInitEntry(init))) {
+		t.Fatal("ciphertext not bound into client_init")
+	}
+}
+
+func decodeEntry(label string, msg json.RawMessage) (transcript.Marshaler, error) {
+	var (
+		target any
+		wrap   func() transcript.Marshaler
+	)
+	switch label {
+	case "client_init":
+		var v ClientInit
+		target, wrap = &v, func() transcript.Marshaler { return clientInitEntry(v) }
+	case "client_signature", "previous", "initiator_signature":
+		var v []byte
+		target, wrap = &v, func() transcript.Marshaler { return transcript.Raw(v) }
+	case "server_payload":
+		var v ServerPayload
+		target, wrap = &v, func() transcript.Marshaler { return v }
+	case "resume_init":
+		var v ResumeInit
+		target, wrap = &v, func() transcript.Marshaler { return resumeInitEntry(v) }
+	case "early_data":
+		var v Envelope
+		target, wrap = &v, func() transcript.Marshaler { return earlyDataEntry(v) }
+	case "resume_payload":
+		var v ResumePayload
+		target, wrap = &v, func() transcript.Marshaler { return v }
+	case "rehandshake_init":
+		var v RehandshakeInit
+		target, wrap = &v, func() transcript.Marshaler { return v }
+	case "rehandshake_response":
+		var v RehandshakeResponse
+		target, wrap = &v, func() transcript.Marshaler { return v }
+	default:
+		return nil, fmt.Errorf("unknown label %q", label)
+	}
+	if err := json.Unmarshal(msg, target); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", label, err)
+	}
+	return wrap(), nil
+}
+
+func writeVectors(t *testing.T) {
+	t.Helper()
+	var vectors transcriptVectors
+	vectors.Version = transcript.Version
+	add := func(name, label string, msg any) {
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", name, err)
+		}
+		m, err := decodeEntry(label, raw)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		vectors.Entries = append(vectors.Entries, entryVector{
+			Name:     name,
+			Label:    label,
+			Message:  raw,
+			Encoding: hex.EncodeToString(transcript.Encode(m)),
+		})
+	}
+	add("client_init/strict", "client_init", vectorClientInit(false))
+	add("client_init/hybrid", "client_init", vectorClientInit(true))
+	add("client_signature", "client_signature", bytes.Repeat([]byte{0x5a}, 16))
+	add("server_payload/strict", "server_payload", vectorServerPayload(false))
+	add("server_payload/hybrid", "server_payload", vectorServerPayload(true))
+	add("resume_init", "resume_init", ResumeInit{
+		Version:   1,
+		Mode:      "hybrid",
+		Timestamp: vectorTime.Add(time.Hour),
+		Nonce:     bytes.Repeat([]byte{0x33}, 32),
+		Ticket:    bytes.Repeat([]byte{0x44}, 48),
+	})
+	add("early_data", "early_data", Envelope{
+		Ciphertext: []byte("sealed early data"),
+		Nonce:      bytes.Repeat([]byte{0x55}, 12),
+		Sequence:   1,
+		Metadata:   map[string]string{"path": "/status", "method": "GET"},
+	})
+	add("resume_payload", "resume_payload", ResumePayload{
+		Version:           1,
+		Mode:              "hybrid",
+		Timestamp:         vectorTime.Add(time.Hour + time.Second),
+		Nonce:             bytes.Repeat([]byte{0x66}, 32),
+		RotationSecs:      600,
+		Selected:          Selection{PQKEM: "ML-KEM-768", PQSig: "ML-DSA-65", AEAD: "xchacha20poly1305"},
+		EarlyDataAccepted: true,
+	})
+	add("previous", "previous", bytes.Repeat([]byte{0x77}, 32))
+	add("rehandshake_init", "rehandshake_init", RehandshakeInit{
+		Epoch:     3,
+		KEM:       "ML-KEM-768",
+		PublicKey: bytes.Repeat([]byte{0x88}, 32),
+		Nonce:     bytes.Repeat([]byte{0x99}, 32),
+		Binder:    bytes.Repeat([]byte{0xaa}, 32),
+	})
+	add("initiator_signature", "initiator_signature", bytes.Repeat([]byte{0xbb}, 16))
+	add("rehandshake_response", "rehandshake_response", RehandshakeResponse{
+		Ciphertext:   bytes.Repeat([]byte{0xcc}, 48),
+		Nonce:        bytes.Repeat([]byte{0xdd}, 32),
+		Confirmation: bytes.Repeat([]byte{0xee}, 32),
+	})
+
+	entries := make(map[string]entryVector, len(vectors.Entries))
+	for _, v := range vectors.Entries {
+		entries[v.Name] = v
+	}
+	addTranscript := func(name, domain string, names ...string) {
+		acc := transcript.New(domain)
+		tv := transcriptVector{Name: name, Domain: domain, Entries: names}
+		for _, n := range names {
+			m, _ := decodeEntry(entries[n].Label, entries[n].Message)
+			if err := acc.Append(entries[n].Label, m); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			tv.Snapshots = append(tv.Snapshots, hex.EncodeToString(acc.Snapshot()))
+		}
+		vectors.Transcripts = append(vectors.Transcripts, tv)
+	}
+	addTranscript("handshake/strict", "qsafe-handshake", "client_init/strict", "server_payload/strict")
+	addTranscript("handshake/hybrid-authenticated", "qsafe-handshake", "client_init/hybrid", "client_signature", "server_payload/hybrid")
+	addTranscript("resumption/early-data", "qsafe-resumption", "resume_init", "early_data", "resume_payload")
+	addTranscript("rehandshake/signed", "qsafe-rehandshake", "previous", "rehandshake_init", "initiator_signature", "rehandshake_response")
+
+	out, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal vectors: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(vectorsPath), 0o755); err != nil {
+		t.Fatalf("create testdata: %v", err)
+	}
+	if err := os.WriteFile(vectorsPath, append(out, '\n'), 0o644); err != nil {
+		t.Fatalf("write vectors: %v", err)
+	}
+}
+
+var vectorTime = time.Date(2025, 1, 2, 3, 4, 5, 678000000, time.UTC)
+
+func vectorCapabilities() CapabilitySet {
+	return CapabilitySet{
+		PQKEMs:     []string{"ML-KEM-768"},
+		PQSigs:     []string{"ML-DSA-65"},
+		AEADs:      []string{"xchacha20poly1305"},
+		Transports: []string{"https"},
+	}
+}
+
+func vectorClientInit(hybrid bool) ClientInit {
+	init := ClientInit{
+		Version:      1,
+		Mode:         "strict",
+		Timestamp:    vectorTime,
+		Nonce:        bytes.Repeat([]byte{0x11}, 32),
+		KEM:          "ML-KEM-768",
+		Ciphertext:   bytes.Repeat([]byte{0x22}, 64),
+		Capabilities: vectorCapabilities(),
+	}
+	if hybrid {
+		init.Mode = "hybrid"
+		init.ClassicalShare = bytes.Repeat([]byte{0x77}, 32)
+		init.Identity = &PeerIdentity{Scheme: "ML-DSA-65", PublicKey: bytes.Repeat([]byte{0x88}, 32)}
+		init.Attestation = &attestation.Bundle{
+			Evidence:         []byte(`{"platform":"sim"}`),
+			Signature:        bytes.Repeat([]byte{0x99}, 16),
+			CertificateChain: []byte("chain"),
+			PolicyVersion:    "sim-v1",
+			Nonce:            bytes.Repeat([]byte{0x11}, 32),
+		}
+	}
+	return init
+}
+
+func vectorServerPayload(hybrid bool) ServerPayload {
+	payload := ServerPayload{
+		Version:      1,
+		Mode:         "strict",
+		Timestamp:    vectorTime.Add(time.Second),
+		Nonce:        bytes.Repeat([]byte{0xaa}, 32),
+		RotationSecs: 600,
+		Capabilities: vectorCapabilities(),
+		Selected:     Selection{PQKEM: "ML-KEM-768", PQSig: "ML-DSA-65", AEAD: "xchacha20poly1305"},
+		ClientOffer:  vectorCapabilities(),
+	}
+	if hybrid {
+		payload.Mode = "hybrid"
+		payload.ClassicalShare = bytes.Repeat([]byte{0xbb}, 32)
+	}
+	return payload
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+)
+
+// ErrExporterLabel indicates an exporter label that is neither registered nor
+// experimental, or a registration under a reserved prefix.
+var ErrExporterLabel = errors.New("session: exporter label not permitted")
+
+const (
+	// ExporterLabelChannelBinding yields a value unique to the session and identical on
+	// both peers, for binding application-layer authentication to the channel.
+	ExporterLabelChannelBinding = "qsafe-channel-binding"
+	// ExperimentalExporterPrefix marks labels usable without registration, for
+	// development and private experiments.
+	ExperimentalExporterPrefix = "EXPERIMENTAL-"
+)
+
+// reservedExporterPrefixes are kept for labels defined by the protocol itself, such as
+// ExporterLabelChannelBinding and the resumption secret ("qsafe-resumption").
+var reservedExporterPrefixes = []string{"qsafe-"}
+
+var (
+	exporterLabelsMu sync.RWMutex
+	exporterLabels   = map[string]struct{}{
+		ExporterLabelChannelBinding: {},
+	}
+)
+
+// RegisterExporterLabel permits label for ExportKeyingMaterial. Services should register
+// their labels at start-up so that two uses cannot silently share keying material by
+// picking the same name. Registering a label twice is harmless.
+func RegisterExporterLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("%w: empty label", ErrExporterLabel)
+	}
+	for _, prefix := range reservedExporterPrefixes {
+		if strings.HasPrefix(label, prefix) {
+			return fmt.Errorf("%w: prefix %q is reserved", ErrExporterLabel, prefix)
+		}
+	}
+	exporterLabelsMu.Lock()
+	defer exporterLabelsMu.Unlock()
+	exporterLabels[label] = struct{}{}
+	return nil
+}
+
+func exporterLabelAllowed(label string) bool {
+	if strings.HasPrefix(label, ExperimentalExporterPrefix) && len(label) > len(ExperimentalExporterPrefix) {
+		return true
+	}
+	exporterLabelsMu.RLock()
+	defer exporterLabelsMu.RUnlock()
+	_, ok := exporterLabels[label]
+	return ok
+}
+
+// ExportKeyingMaterial derives length bytes (at most scheduler.MaxExportLength) from the
+// session's exporter secret, in the manner of RFC 5705. Both peers of a session obtain
+// the same output for the same label and context, and the output is independent of the
+// traffic keys. label must be registered with RegisterExporterLabel or carry
+// ExperimentalExporterPrefix.
+func (s *Session) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	if !exporterLabelAllowed(label) {
+		return nil, fmt.Errorf("%w: %q is not registered", ErrExporterLabel, label)
+	}
+	s.chainMu.Lock()
+	exporter := s.exporter.Clone()
+	s.chainMu.Unlock()
+	if exporter == nil {
+		return nil, ErrSessionClosed
+	}
+	defer exporter.Wipe()
+	return scheduler.Export(scheduler.Keys{ExporterSecret: exporter}, label, context, length)
+}
+
+// ChannelBinding returns the 32-byte ExporterLabelChannelBinding value for the session.
+func (s *Session) ChannelBinding() ([]byte, error) {
+	return s.ExportKeyingMaterial(ExporterLabelChannelBinding, nil, 32)
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+)
+
+func TestExportKeyingMaterial(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, serverKeys, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	clientKeys, err := pending.Finish(ctx, resp)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	serverSession, err := NewSession(SessionConfig{Role: RoleServer, Mode: "hybrid", Keys: serverKeys})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+	clientSession, err := NewSession(SessionConfig{Role: RoleClient, Mode: "hybrid", Keys: clientKeys})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+
+	serverBinding, err := serverSession.ChannelBinding()
+	if err != nil {
+		t.Fatalf("server channel binding: %v", err)
+	}
+	clientBinding, err := clientSession.ChannelBinding()
+	if err != nil {
+		t.Fatalf("client channel binding: %v", err)
+	}
+	if len(serverBinding) != 32 || !bytes.Equal(serverBinding, clientBinding) {
+		t.Fatal("peers disagree on channel binding")
+	}
+	if bytes.Equal(serverBinding, clientKeys.ClientToServer.Bytes()) || bytes.Equal(serverBinding, clientKeys.ExporterSecret.Bytes()) {
+		t.Fatal("channel binding exposes key material")
+	}
+
+	if err := RegisterExporterLabel("storage-key"); err != nil {
+		t.Fatalf("register label: %v", err)
+	}
+	a, err := clientSession.ExportKeyingMaterial("storage-key", []byte("tenant-a"), 32)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	variants := []struct {
+		name    string
+		label   string
+		context []byte
+		length  int
+	}{
+		{"context", "storage-key", []byte("tenant-b"), 32},
+		{"label", "EXPERIMENTAL-storage", []byte("tenant-a"), 32},
+		{"length", "storage-key", []byte("tenant-a"), 33},
+	}
+	for _, v := range variants {
+		b, err := clientSession.ExportKeyingMaterial(v.label, v.context, v.length)
+		if err != nil {
+			t.Fatalf("%s: export: %v", v.name, err)
+		}
+		if bytes.Equal(a, b[:32]) {
+			t.Fatalf("changing the %s did not change the output", v.name)
+		}
+	}
+	b, err := serverSession.ExportKeyingMaterial("storage-key", []byte("tenant-a"), 32)
+	if err != nil || !bytes.Equal(a, b) {
+		t.Fatalf("server export differs: %v", err)
+	}
+}
+
+func TestExporterLabelRules(t *testing.T) {
+	session, err := NewSession(SessionConfig{Role: RoleClient, Keys: testKeys(t)})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if _, err := session.ExportKeyingMaterial("never-registered", nil, 32); !errors.Is(err, ErrExporterLabel) {
+		t.Fatalf("expected unregistered label to be refused, got %v", err)
+	}
+	if _, err := session.ExportKeyingMaterial(ExperimentalExporterPrefix, nil, 32); !errors.Is(err, ErrExporterLabel) {
+		t.Fatalf("expected bare experimental prefix to be refused, got %v", err)
+	}
+	if err := RegisterExporterLabel("qsafe-resumption"); !errors.Is(err, ErrExporterLabel) {
+		t.Fatalf("expected reserved prefix to be refused, got %v", err)
+	}
+	if _, err := session.ExportKeyingMaterial(ExporterLabelChannelBinding, nil, 0); err == nil {
+		t.Fatal("expected zero length to be refused")
+	}
+}
+
+// testKeys derives a fixed key set without running a handshake.
+func testKeys(t testing.TB) scheduler.Keys {
+	t.Helper()
+	keys, err := scheduler.Derive(bytes.Repeat([]byte{0x42}, 32), bytes.Repeat([]byte{0x17}, 32), scheduler.Config{Mode: "strict"})
+	if err != nil {
+		t.Fatalf("derive keys: %v", err)
+	}
+	return keys
+}
@@ -0,0 +1,102 @@
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+)
+
+// ErrFinishedMismatch indicates the client Finished MAC did not verify.
+var ErrFinishedMismatch = errors.New("handshake: client finished mismatch")
+
+// InitialEpoch is the rotation epoch both sides start a freshly handshaken session at.
+const InitialEpoch uint64 = 1
+
+// HandshakeFinished mirrors HandshakeFinished in proto/api/v1/handshake.proto. The
+// client sends it after Finish so the server learns the client derived the same keys.
+type HandshakeFinished struct {
+	TranscriptHash []byte `json:"transcript_hash"`
+	FinishedMAC    []byte `json:"finished_mac"`
+	RotationEpoch  uint64 `json:"rotation_epoch"`
+}
+
+// completion records the outcome of a successful client-side Finish. It keeps its own
+// copy of the keys, for Finished and StoreTicket, until the pending handshake is closed.
+type completion struct {
+	keys           *scheduler.Keys
+	transcriptHash []byte
+	mode           string
+	selected       Selection
+}
+
+func newCompletion(keys scheduler.Keys, transcriptHash []byte, mode string, selected Selection) completion {
+	own := keys.Clone()
+	return completion{keys: &own, transcriptHash: transcriptHash, mode: mode, selected: selected}
+}
+
+func (c completion) wipe() {
+	if c.keys != nil {
+		c.keys.Wipe()
+	}
+}
+
+// Finished builds the client Finished message and marks the handshake established. It
+// is only available, once, after Finish succeeds.
+func (p *PendingClient) Finished() (HandshakeFinished, error) {
+	return p.done.finished(&p.hs)
+}
+
+func (c completion) finished(hs *Handshake) (fin HandshakeFinished, err error) {
+	err = hs.step(StateEstablished, func() (err error) {
+		fin, err = c.build()
+		return err
+	})
+	return fin, err
+}
+
+func (c completion) build() (HandshakeFinished, error) {
+	mac, err := finishedMAC(c.keys.ClientToServer.Bytes(), c.transcriptHash, InitialEpoch)
+	if err != nil {
+		return HandshakeFinished{}, err
+	}
+	return HandshakeFinished{
+		TranscriptHash: append([]byte(nil), c.transcriptHash...),
+		FinishedMAC:    mac,
+		RotationEpoch:  InitialEpoch,
+	}, nil
+}
+
+// VerifyFinished checks a client Finished message against the keys and transcript hash
+// returned by Accept. Servers should not treat a session as established until it passes.
+func VerifyFinished(keys scheduler.Keys, transcriptHash []byte, fin HandshakeFinished) error {
+	if !constantTimeEqual(fin.TranscriptHash, transcriptHash) {
+		return fmt.Errorf("%w: transcript hash", ErrFinishedMismatch)
+	}
+	if fin.RotationEpoch != InitialEpoch {
+		return fmt.Errorf("%w: epoch %d", ErrFinishedMismatch, fin.RotationEpoch)
+	}
+	expected, err := finishedMAC(keys.ClientToServer.Bytes(), transcriptHash, fin.RotationEpoch)
+	if err != nil {
+		return err
+	}
+	if !constantTimeEqual(expected, fin.FinishedMAC) {
+		return ErrFinishedMismatch
+	}
+	return nil
+}
+
+// finishedMAC confirms the client->server key over a label-separated transcript hash so
+// it can never collide with the server's Confirmation.
+func finishedMAC(key, transcriptHash []byte, epoch uint64) ([]byte, error) {
+	h := blake3.New()
+	_, _ = h.Write([]byte("qsafe-client-finished"))
+	_, _ = h.Write(transcriptHash)
+	var e [8]byte
+	binary.BigEndian.PutUint64(e[:], epoch)
+	_, _ = h.Write(e[:])
+	return scheduler.Confirm(key, h.Sum(nil))
+}
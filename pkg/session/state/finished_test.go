@@ -0,0 +1,48 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClientFinished(t *testing.T) {
+	ctx := context.Background()
+
+	server, client := newHandshakePair(t)
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if _, err := pending.Finished(); err == nil {
+		t.Fatal("expected finished to require a completed handshake")
+	}
+	resp, serverKeys, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	fin, err := pending.Finished()
+	if err != nil {
+		t.Fatalf("client finished: %v", err)
+	}
+	if err := VerifyFinished(serverKeys, resp.TranscriptHash, fin); err != nil {
+		t.Fatalf("verify finished: %v", err)
+	}
+
+	// The server's own confirmation must not pass as a client Finished.
+	reflected := fin
+	reflected.FinishedMAC = resp.Confirmation
+	if err := VerifyFinished(serverKeys, resp.TranscriptHash, reflected); !errors.Is(err, ErrFinishedMismatch) {
+		t.Fatalf("expected reflected confirmation to fail, got %v", err)
+	}
+	tampered := fin
+	tampered.FinishedMAC = append([]byte(nil), fin.FinishedMAC...)
+	tampered.FinishedMAC[0] ^= 0x01
+	if err := VerifyFinished(serverKeys, resp.TranscriptHash, tampered); !errors.Is(err, ErrFinishedMismatch) {
+		t.Fatalf("expected tampered mac to fail, got %v", err)
+	}
+}
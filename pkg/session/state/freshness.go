@@ -0,0 +1,57 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example/qsafe/pkg/session/replay"
+)
+
+// ErrStaleInit indicates a ClientInit timestamp outside the permitted clock skew.
+var ErrStaleInit = errors.New("handshake: client init outside freshness window")
+
+// ErrReplayedInit indicates a ClientInit whose nonce or ciphertext was already seen.
+var ErrReplayedInit = errors.New("handshake: client init replayed")
+
+// ErrReplayCacheFull indicates a ClientInit refused because the replay cache holds as
+// many unexpired entries as it may. Evicting one instead would let a burst of fresh
+// inits push a captured one out and open it to replay.
+var ErrReplayCacheFull = errors.New("handshake: replay cache full")
+
+// defaultMaxClockSkew bounds how far a ClientInit timestamp may drift from server time.
+const defaultMaxClockSkew = 30 * time.Second
+
+// minClientNonce is the shortest client nonce accepted for replay tracking.
+const minClientNonce = 16
+
+// checkFreshness rejects inits that are too old, from the future, or already seen.
+// binding, if non-nil, is a value that must also never repeat (the KEM ciphertext). It runs
+// before any asymmetric work so replays cost the gateway a hash lookup only.
+func (s *Server) checkFreshness(timestamp time.Time, nonce, binding []byte) error {
+	now := s.now()
+	skew := now.Sub(timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > s.cfg.MaxClockSkew {
+		return fmt.Errorf("%w: timestamp %s differs from server clock by %s", ErrStaleInit, timestamp.UTC().Format(time.RFC3339), skew.Round(time.Second))
+	}
+	if len(nonce) < minClientNonce {
+		return fmt.Errorf("%w: client nonce must be at least %d bytes", ErrDecode, minClientNonce)
+	}
+	keys := [][]byte{append([]byte("nonce:"), nonce...)}
+	if binding != nil {
+		keys = append(keys, append([]byte("ct:"), hashBytes(binding)...))
+	}
+	if err := s.cfg.ReplayCache.Insert(now, keys...); err != nil {
+		if errors.Is(err, replay.ErrDuplicate) {
+			return ErrReplayedInit
+		}
+		if errors.Is(err, replay.ErrCacheFull) {
+			return ErrReplayCacheFull
+		}
+		return err
+	}
+	return nil
+}
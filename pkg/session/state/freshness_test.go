@@ -0,0 +1,84 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/qsafe/pkg/session/replay"
+)
+
+func TestAcceptRejectsStaleAndReplayedInit(t *testing.T) {
+	ctx := context.Background()
+
+	server, client := newHandshakePair(t, withServer(func(cfg *ServerConfig) { cfg.MaxClockSkew = 10 * time.Second }))
+
+	init, _, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *init); err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *init); !errors.Is(err, ErrReplayedInit) {
+		t.Fatalf("expected replay rejection, got %v", err)
+	}
+
+	// A fresh nonce does not launder a reused ciphertext.
+	reused := *init
+	reused.Nonce, _ = randomBytes(32)
+	if _, _, err := server.Accept(ctx, reused); !errors.Is(err, ErrReplayedInit) {
+		t.Fatalf("expected ciphertext replay rejection, got %v", err)
+	}
+
+	stale, _, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	server.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if _, _, err := server.Accept(ctx, *stale); !errors.Is(err, ErrStaleInit) {
+		t.Fatalf("expected stale rejection, got %v", err)
+	}
+	server.now = func() time.Time { return time.Now().Add(-time.Minute) }
+	if _, _, err := server.Accept(ctx, *stale); !errors.Is(err, ErrStaleInit) {
+		t.Fatalf("expected future-dated rejection, got %v", err)
+	}
+}
+
+func TestAcceptReplayCacheFullRefusesInit(t *testing.T) {
+	ctx := context.Background()
+
+	// Each init records its nonce and ciphertext, so this cache holds two inits.
+	server, client := newHandshakePair(t, withServer(func(cfg *ServerConfig) {
+		cfg.MaxClockSkew = 10 * time.Second
+		cfg.ReplayCache = replay.NewCache(replay.CacheConfig{Capacity: 4, TTL: 20 * time.Second, RejectWhenFull: true})
+	}))
+
+	captured, _, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *captured); err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+
+	// A burst of fresh inits fills the cache and is then refused, rather than pushing
+	// the captured init out.
+	for i := range 3 {
+		init, _, err := client.Initiate(ctx)
+		if err != nil {
+			t.Fatalf("client initiate: %v", err)
+		}
+		_, _, err = server.Accept(ctx, *init)
+		if i == 0 && err != nil {
+			t.Fatalf("server accept: %v", err)
+		}
+		if i > 0 && !errors.Is(err, ErrReplayCacheFull) {
+			t.Fatalf("init %d: expected full cache to refuse, got %v", i, err)
+		}
+	}
+	if _, _, err := server.Accept(ctx, *captured); !errors.Is(err, ErrReplayedInit) {
+		t.Fatalf("expected captured init to stay a replay, got %v", err)
+	}
+}
@@ -9,17 +9,23 @@ import (
 
 	"github.com/zeebo/blake3"
 
+	"github.com/example/qsafe/pkg/attestation"
 	"github.com/example/qsafe/pkg/crypto/kem"
 	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
 	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/policy"
+	"github.com/example/qsafe/pkg/session/replay"
+	"github.com/example/qsafe/pkg/session/ticket"
 	"github.com/example/qsafe/pkg/session/transcript"
 )
 
 // CapabilitySet enumerates algorithm preferences advertised during handshake.
+// Each list is ordered from most to least preferred.
 type CapabilitySet struct {
-	PQKEM      string   `json:"pq_kem"`
-	PQSigs     string   `json:"pq_sigs"`
-	AEAD       string   `json:"aead"`
+	PQKEMs     []string `json:"pq_kems"`
+	PQSigs     []string `json:"pq_sigs"`
+	AEADs      []string `json:"aeads"`
 	Transports []string `json:"transports"`
 }
 
@@ -29,8 +35,19 @@ type ClientInit struct {
 	Mode         string        `json:"mode"`
 	Timestamp    time.Time     `json:"timestamp"`
 	Nonce        []byte        `json:"nonce"`
+	KEM          string        `json:"kem"`
 	Ciphertext   []byte        `json:"ciphertext"`
 	Capabilities CapabilitySet `json:"capabilities"`
+	// ClassicalShare carries the client's ephemeral X25519 public key in hybrid mode.
+	ClassicalShare []byte `json:"classical_kex,omitempty"`
+	// Identity and IdentitySignature authenticate the client when it holds a credential.
+	Identity          *PeerIdentity `json:"identity,omitempty"`
+	IdentitySignature []byte        `json:"identity_signature,omitempty"`
+	// Attestation carries platform evidence bound to the nonce and ciphertext.
+	Attestation *attestation.Bundle `json:"attestation,omitempty"`
+	// Cookie echoes a HelloRetryRequest. It is not part of the transcript, so the init
+	// can be resent unchanged apart from this field.
+	Cookie []byte `json:"cookie,omitempty"`
 }
 
 // ServerPayload carries the fields covered by the transcript hash and signature.
@@ -41,6 +58,12 @@ type ServerPayload struct {
 	Nonce        []byte        `json:"nonce"`
 	RotationSecs uint32        `json:"rotation_secs"`
 	Capabilities CapabilitySet `json:"capabilities"`
+	Selected     Selection     `json:"selected"`
+	// ClientOffer echoes the capabilities the server received so the signed transcript
+	// binds both complete offers alongside the selection.
+	ClientOffer CapabilitySet `json:"client_offer"`
+	// ClassicalShare carries the server's ephemeral X25519 public key in hybrid mode.
+	ClassicalShare []byte `json:"classical_kex,omitempty"`
 }
 
 // ServerResponse is the complete gateway reply.
@@ -60,6 +83,17 @@ type ClientConfig struct {
 	SignatureScheme    sign.Scheme
 	ServerSignatureKey []byte
 	Capabilities       CapabilitySet
+	// AdditionalVerifiers lists further server signature schemes the client accepts.
+	AdditionalVerifiers []SignatureVerifier
+	// Identity, when set, signs the client init so the server can authenticate the agent.
+	Identity *ClientIdentity
+	// ClassicalSuite runs alongside the PQ KEM in hybrid mode (defaults to X25519).
+	ClassicalSuite kem.Suite
+	// Attester, when set, attaches platform evidence to every ClientInit.
+	Attester attestation.Attester
+	// Audit, when set, receives a HandshakeRecord each time Finish processes a server
+	// response, whether or not it succeeds. It is called synchronously.
+	Audit func(HandshakeRecord)
 }
 
 // ServerConfig supplies required gateway primitives.
@@ -71,16 +105,53 @@ type ServerConfig struct {
 	SignatureKeyPair sign.KeyPair
 	Capabilities     CapabilitySet
 	Scheduler        scheduler.Config
+	// AdditionalKEMs and AdditionalSignatures extend the primary credentials above;
+	// Capabilities decides which of them are offered and in what order.
+	AdditionalKEMs       []KEMCredential
+	AdditionalSignatures []SignatureCredential
+	// RequireClientAuth rejects clients without a signing identity. ClientSignatureSchemes
+	// limits the schemes clients may sign with (defaults to Capabilities.PQSigs) and
+	// AuthorizeClient, if set, decides whether a verified identity may proceed.
+	RequireClientAuth      bool
+	ClientSignatureSchemes []string
+	AuthorizeClient        func(PeerIdentity) error
+	// ClassicalSuite runs alongside the PQ KEM in hybrid mode (defaults to X25519).
+	ClassicalSuite kem.Suite
+	// Attestation, when set, must accept the client's evidence before keys are derived.
+	Attestation attestation.Verifier
+	// MaxClockSkew bounds the age (or future drift) of ClientInit timestamps; defaults
+	// to 30s. ReplayCache remembers accepted nonces and ciphertexts and defaults to a
+	// cache whose TTL spans the whole skew window. It must be built with RejectWhenFull,
+	// so that inits are refused rather than replay protection lapsing when it fills.
+	MaxClockSkew time.Duration
+	ReplayCache  *replay.Cache
+	// Tickets enables session resumption: after a confirmed handshake IssueTicket seals
+	// a resumption secret under the keyring, and Resume redeems it. Policy, if set,
+	// decides whether resumption is allowed in the configured mode.
+	Tickets *ticket.Keyring
+	Policy  *policy.Enforcer
+	// MaxEarlyData bounds accepted 0-RTT ciphertext (default 16KiB). EarlyDataReplay
+	// records tickets whose early data was accepted; it defaults to a cache spanning the
+	// ticket lifetime that refuses early data rather than evicting when full.
+	MaxEarlyData    int
+	EarlyDataReplay *replay.Cache
+	// Audit, when set, receives a HandshakeRecord for every Accept and Resume, whether
+	// or not it succeeds. It is called synchronously on the handshake path.
+	Audit func(HandshakeRecord)
 }
 
 // Client handles handshake initiation on the agent side.
 type Client struct {
-	cfg ClientConfig
+	cfg       ClientConfig
+	verifiers map[string]SignatureVerifier
 }
 
 // Server handles handshake acceptance on the gateway side.
 type Server struct {
-	cfg ServerConfig
+	cfg  ServerConfig
+	kems map[string]KEMCredential
+	sigs map[string]SignatureCredential
+	now  func() time.Time
 }
 
 // Config exposes the server configuration (read-only copy).
@@ -88,12 +159,48 @@ func (s *Server) Config() ServerConfig {
 	return s.cfg
 }
 
+// KEMPublicKeys returns the static KEM public key for every offered suite.
+func (s *Server) KEMPublicKeys() map[string][]byte {
+	out := make(map[string][]byte, len(s.cfg.Capabilities.PQKEMs))
+	for _, name := range s.cfg.Capabilities.PQKEMs {
+		out[name] = s.kems[name].KeyPair.Public
+	}
+	return out
+}
+
+// Close wipes the server's static KEM and signing private keys. The server must not
+// accept or resume handshakes afterwards, and sessions that sign rekey notices with
+// one of its credentials can no longer do so; the caller closes them first.
+func (s *Server) Close() {
+	for _, c := range s.kems {
+		c.KeyPair.Wipe()
+	}
+	for _, c := range s.sigs {
+		c.KeyPair.Wipe()
+	}
+}
+
+// SignaturePublicKeys returns the signing public key for every offered scheme.
+func (s *Server) SignaturePublicKeys() map[string][]byte {
+	out := make(map[string][]byte, len(s.cfg.Capabilities.PQSigs))
+	for _, name := range s.cfg.Capabilities.PQSigs {
+		out[name] = s.sigs[name].KeyPair.Public
+	}
+	return out
+}
+
 // PendingClient captures state between Initiate and Finish.
 type PendingClient struct {
-	transcript   *transcript.Accumulator
-	sharedSecret []byte
-	cfg          ClientConfig
-	clientNonce  []byte
+	transcript       *transcript.Accumulator
+	sharedSecret     *secret.Buffer
+	cfg              ClientConfig
+	verifiers        map[string]SignatureVerifier
+	clientNonce      []byte
+	ciphertext       []byte
+	classicalShare   []byte
+	classicalPrivate *secret.Buffer
+	hs               Handshake
+	done             completion
 }
 
 // NewClient constructs a handshake client.
@@ -113,7 +220,49 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 	if cfg.Mode == "" {
 		cfg.Mode = "strict"
 	}
-	return &Client{cfg: cfg}, nil
+	if err := validateMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+	if cfg.Mode == "hybrid" && cfg.ClassicalSuite == nil {
+		cfg.ClassicalSuite = kem.NewX25519()
+	}
+
+	if len(cfg.Capabilities.PQKEMs) == 0 {
+		cfg.Capabilities.PQKEMs = []string{cfg.KEMSuite.Name()}
+	}
+	if !contains(cfg.Capabilities.PQKEMs, cfg.KEMSuite.Name()) {
+		return nil, fmt.Errorf("handshake: kem suite %q missing from client offer", cfg.KEMSuite.Name())
+	}
+
+	verifiers := map[string]SignatureVerifier{
+		cfg.SignatureScheme.Name(): {Scheme: cfg.SignatureScheme, PublicKey: cfg.ServerSignatureKey},
+	}
+	order := []string{cfg.SignatureScheme.Name()}
+	for _, v := range cfg.AdditionalVerifiers {
+		if v.Scheme == nil || len(v.PublicKey) == 0 {
+			return nil, errors.New("handshake: additional verifier requires scheme and public key")
+		}
+		if _, dup := verifiers[v.Scheme.Name()]; !dup {
+			order = append(order, v.Scheme.Name())
+		}
+		verifiers[v.Scheme.Name()] = v
+	}
+	if len(cfg.Capabilities.PQSigs) == 0 {
+		cfg.Capabilities.PQSigs = order
+	}
+	for _, name := range cfg.Capabilities.PQSigs {
+		if _, ok := verifiers[name]; !ok {
+			return nil, fmt.Errorf("handshake: signature scheme %q offered without server key", name)
+		}
+	}
+
+	if err := defaultAEADs(&cfg.Capabilities); err != nil {
+		return nil, err
+	}
+	if cfg.Identity != nil && (cfg.Identity.Scheme == nil || len(cfg.Identity.KeyPair.Private) == 0) {
+		return nil, errors.New("handshake: client identity requires scheme and keypair")
+	}
+	return &Client{cfg: cfg, verifiers: verifiers}, nil
 }
 
 // NewServer constructs a handshake server.
@@ -133,7 +282,76 @@ func NewServer(cfg ServerConfig) (*Server, error) {
 	if cfg.Mode == "" {
 		cfg.Mode = "strict"
 	}
-	return &Server{cfg: cfg}, nil
+	if err := validateMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+	if cfg.Mode == "hybrid" && cfg.ClassicalSuite == nil {
+		cfg.ClassicalSuite = kem.NewX25519()
+	}
+
+	kems := map[string]KEMCredential{
+		cfg.KEMSuite.Name(): {Suite: cfg.KEMSuite, KeyPair: cfg.KEMKeyPair},
+	}
+	kemOrder := []string{cfg.KEMSuite.Name()}
+	for _, c := range cfg.AdditionalKEMs {
+		if c.Suite == nil || len(c.KeyPair.Public) == 0 || len(c.KeyPair.Private) == 0 {
+			return nil, errors.New("handshake: additional kem requires suite and keypair")
+		}
+		if _, dup := kems[c.Suite.Name()]; !dup {
+			kemOrder = append(kemOrder, c.Suite.Name())
+		}
+		kems[c.Suite.Name()] = c
+	}
+	if len(cfg.Capabilities.PQKEMs) == 0 {
+		cfg.Capabilities.PQKEMs = kemOrder
+	}
+	for _, name := range cfg.Capabilities.PQKEMs {
+		if _, ok := kems[name]; !ok {
+			return nil, fmt.Errorf("handshake: kem %q advertised without keypair", name)
+		}
+	}
+
+	sigs := map[string]SignatureCredential{
+		cfg.SignatureScheme.Name(): {Scheme: cfg.SignatureScheme, KeyPair: cfg.SignatureKeyPair},
+	}
+	sigOrder := []string{cfg.SignatureScheme.Name()}
+	for _, c := range cfg.AdditionalSignatures {
+		if c.Scheme == nil || len(c.KeyPair.Public) == 0 || len(c.KeyPair.Private) == 0 {
+			return nil, errors.New("handshake: additional signature requires scheme and keypair")
+		}
+		if _, dup := sigs[c.Scheme.Name()]; !dup {
+			sigOrder = append(sigOrder, c.Scheme.Name())
+		}
+		sigs[c.Scheme.Name()] = c
+	}
+	if len(cfg.Capabilities.PQSigs) == 0 {
+		cfg.Capabilities.PQSigs = sigOrder
+	}
+	for _, name := range cfg.Capabilities.PQSigs {
+		if _, ok := sigs[name]; !ok {
+			return nil, fmt.Errorf("handshake: signature scheme %q advertised without keypair", name)
+		}
+	}
+
+	if err := defaultAEADs(&cfg.Capabilities); err != nil {
+		return nil, err
+	}
+	if len(cfg.ClientSignatureSchemes) == 0 {
+		cfg.ClientSignatureSchemes = cfg.Capabilities.PQSigs
+	}
+	if cfg.MaxClockSkew <= 0 {
+		cfg.MaxClockSkew = defaultMaxClockSkew
+	}
+	if cfg.ReplayCache == nil {
+		cfg.ReplayCache = replay.NewCache(replay.CacheConfig{TTL: 2 * cfg.MaxClockSkew, RejectWhenFull: true})
+	}
+	if cfg.MaxEarlyData <= 0 {
+		cfg.MaxEarlyData = defaultMaxEarlyData
+	}
+	if cfg.Tickets != nil && cfg.EarlyDataReplay == nil {
+		cfg.EarlyDataReplay = replay.NewCache(replay.CacheConfig{TTL: cfg.Tickets.Lifetime(), RejectWhenFull: true})
+	}
+	return &Server{cfg: cfg, kems: kems, sigs: sigs, now: time.Now}, nil
 }
 
 // Initiate produces ClientInit and retains state for finalisation.
@@ -150,31 +368,116 @@ func (c *Client) Initiate(ctx context.Context) (*ClientInit, *PendingClient, err
 		return nil, nil, fmt.Errorf("handshake: encapsulate: %w", err)
 	}
 
+	// The ephemeral secrets are wiped unless the pending handshake takes them over.
+	var classical kem.KeyPair
+	var pending *PendingClient
+	defer func() {
+		if pending == nil {
+			shared.Wipe()
+			classical.Wipe()
+		}
+	}()
+	if c.cfg.Mode == "hybrid" {
+		classical, err = c.cfg.ClassicalSuite.GenerateKeyPair()
+		if err != nil {
+			return nil, nil, fmt.Errorf("handshake: classical keypair: %w", err)
+		}
+	}
+
 	init := &ClientInit{
-		Version:      1,
-		Mode:         c.cfg.Mode,
-		Timestamp:    time.Now().UTC(),
-		Nonce:        clientNonce,
-		Ciphertext:   ciphertext,
-		Capabilities: c.cfg.Capabilities,
-	}
-	if err := trans.Append("client_init", initWithoutCiphertext(*init)); err != nil {
+		Version:        1,
+		Mode:           c.cfg.Mode,
+		Timestamp:      time.Now().UTC(),
+		Nonce:          clientNonce,
+		KEM:            c.cfg.KEMSuite.Name(),
+		Ciphertext:     ciphertext,
+		Capabilities:   c.cfg.Capabilities,
+		ClassicalShare: classical.Public,
+	}
+	if c.cfg.Identity != nil {
+		identity := c.cfg.Identity.Public()
+		init.Identity = &identity
+	}
+	if err := c.attest(ctx, init); err != nil {
+		return nil, nil, err
+	}
+	if err := trans.Append("client_init", clientInitEntry(*init)); err != nil {
 		return nil, nil, err
 	}
+	if c.cfg.Identity != nil {
+		init.IdentitySignature, err = signClientInit(trans, c.cfg.Identity)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	pending := &PendingClient{
-		transcript:   trans,
-		sharedSecret: shared,
-		cfg:          c.cfg,
-		clientNonce:  clientNonce,
+	pending = &PendingClient{
+		transcript:       trans,
+		sharedSecret:     shared,
+		cfg:              c.cfg,
+		verifiers:        c.verifiers,
+		clientNonce:      clientNonce,
+		ciphertext:       ciphertext,
+		classicalShare:   classical.Public,
+		classicalPrivate: secret.Take(classical.Private),
+		hs:               Handshake{state: StateNegotiating},
 	}
 	return init, pending, nil
 }
 
-// Finish validates the server response and derives symmetric keys.
+// State reports how far the handshake has progressed.
+func (p *PendingClient) State() HandshakeState {
+	return p.hs.State()
+}
+
+// Finish validates the server response and derives symmetric keys. Callers should then
+// send Finished so the server can confirm the client holds the same keys. Finish may
+// only be called once; after a failure the handshake must be restarted. The returned
+// keys belong to the caller, who wipes them once the session is built; the ephemeral
+// KEM secrets are wiped whether or not Finish succeeds.
 func (p *PendingClient) Finish(ctx context.Context, resp ServerResponse) (scheduler.Keys, error) {
+	var keys scheduler.Keys
+	err := p.hs.step(StateConfirming, func() (err error) {
+		defer p.wipeEphemeral()
+		keys, err = p.finish(resp)
+		p.audit(resp, err)
+		return err
+	})
+	return keys, err
+}
+
+// Close abandons the handshake and wipes every secret it holds, including the keys kept
+// for Finished and StoreTicket; both fail afterwards. Keys already returned by Finish are
+// unaffected.
+func (p *PendingClient) Close() {
+	p.hs.abandon()
+	p.wipeEphemeral()
+	p.done.wipe()
+}
+
+func (p *PendingClient) wipeEphemeral() {
+	p.sharedSecret.Wipe()
+	p.classicalPrivate.Wipe()
+}
+
+func (p *PendingClient) audit(resp ServerResponse, err error) {
+	if p.cfg.Audit == nil {
+		return
+	}
+	var server, client *PeerIdentity
+	if v, ok := p.verifiers[resp.Payload.Selected.PQSig]; ok {
+		server = &PeerIdentity{Scheme: v.Scheme.Name(), PublicKey: v.PublicKey}
+	}
+	if p.cfg.Identity != nil {
+		id := p.cfg.Identity.Public()
+		client = &id
+	}
+	p.cfg.Audit(newRecord(RoleClient, p.transcript, resp.TranscriptHash, resp.Signature, server, client, err))
+}
+
+func (p *PendingClient) finish(resp ServerResponse) (scheduler.Keys, error) {
 	if resp.Payload.Mode != p.cfg.Mode {
-		return scheduler.Keys{}, fmt.Errorf("handshake: mode mismatch (expected %s got %s)", p.cfg.Mode, resp.Payload.Mode)
+		return scheduler.Keys{}, fmt.Errorf("%w: expected %s got %s", ErrModeMismatch, p.cfg.Mode, resp.Payload.Mode)
 	}
 	if err := p.transcript.Append("server_payload", resp.Payload); err != nil {
 		return scheduler.Keys{}, err
@@ -182,42 +485,130 @@ func (p *PendingClient) Finish(ctx context.Context, resp ServerResponse) (schedu
 
 	calculated := p.transcript.Snapshot()
 	if !constantTimeEqual(calculated, resp.TranscriptHash) {
-		return scheduler.Keys{}, errors.New("handshake: transcript hash mismatch")
+		// The payload is unauthenticated at this point; the echo only classifies the failure.
+		if !sameOffer(resp.Payload.ClientOffer, p.cfg.Capabilities) {
+			return scheduler.Keys{}, fmt.Errorf("%w: server received a different client offer", ErrDowngrade)
+		}
+		return scheduler.Keys{}, fmt.Errorf("%w: transcript hash", ErrIntegrity)
 	}
 
-	if err := p.cfg.SignatureScheme.Verify(p.cfg.ServerSignatureKey, resp.TranscriptHash, resp.Signature); err != nil {
-		return scheduler.Keys{}, fmt.Errorf("handshake: signature verify: %w", err)
+	if err := checkSelection(p.cfg.Capabilities, p.cfg.KEMSuite.Name(), resp.Payload.Selected); err != nil {
+		return scheduler.Keys{}, err
+	}
+	verifier := p.verifiers[resp.Payload.Selected.PQSig]
+	if err := verifyTranscript(verifier.Scheme, verifier.PublicKey, resp.TranscriptHash, resp.Signature, handshakeSignatureContext); err != nil {
+		return scheduler.Keys{}, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if err := checkDowngrade(p.cfg.Capabilities, resp.Payload.Capabilities, resp.Payload.Selected); err != nil {
+		return scheduler.Keys{}, err
 	}
 
-	keys, err := scheduler.Derive(p.sharedSecret, resp.TranscriptHash, p.cfg.Scheduler)
+	shared := p.sharedSecret
+	if p.cfg.Mode == "hybrid" {
+		if len(resp.Payload.ClassicalShare) == 0 {
+			return scheduler.Keys{}, fmt.Errorf("%w: hybrid mode requires server classical key share", ErrDecode)
+		}
+		classicalSecret, err := p.cfg.ClassicalSuite.Decapsulate(p.classicalPrivate.Bytes(), resp.Payload.ClassicalShare)
+		if err != nil {
+			return scheduler.Keys{}, fmt.Errorf("%w: classical key exchange: %v", ErrDecode, err)
+		}
+		shared, err = scheduler.Combine(p.sharedSecret.Bytes(), classicalSecret.Bytes(), p.ciphertext, p.classicalShare, resp.Payload.ClassicalShare)
+		classicalSecret.Wipe()
+		if err != nil {
+			return scheduler.Keys{}, fmt.Errorf("handshake: combine secrets: %w", err)
+		}
+		defer shared.Wipe()
+	}
+
+	keys, err := scheduler.Derive(shared.Bytes(), resp.TranscriptHash, p.cfg.Scheduler)
 	if err != nil {
 		return scheduler.Keys{}, fmt.Errorf("handshake: derive keys: %w", err)
 	}
 
-	confirm, err := scheduler.Confirm(keys.ServerToClient, resp.TranscriptHash)
+	confirm, err := scheduler.Confirm(keys.ServerToClient.Bytes(), resp.TranscriptHash)
 	if err != nil {
+		keys.Wipe()
 		return scheduler.Keys{}, err
 	}
 	if !constantTimeEqual(confirm, resp.Confirmation) {
-		return scheduler.Keys{}, errors.New("handshake: confirmation mismatch")
+		keys.Wipe()
+		return scheduler.Keys{}, fmt.Errorf("%w: confirmation", ErrIntegrity)
 	}
+	p.done = newCompletion(keys, resp.TranscriptHash, p.cfg.Mode, resp.Payload.Selected)
 	return keys, nil
 }
 
 // Accept processes the client init and returns the server response + symmetric keys.
+// When init carries an Identity, Accept only succeeds if its signature verifies and the
+// identity passes AuthorizeClient, so callers may then rely on init.Identity. With an
+// Attestation verifier configured, keys are only derived once the evidence checks out.
 func (s *Server) Accept(ctx context.Context, init ClientInit) (ServerResponse, scheduler.Keys, error) {
 	trans := transcript.New("qsafe-handshake")
-	if err := trans.Append("client_init", initWithoutCiphertext(init)); err != nil {
+	resp, keys, err := s.accept(ctx, init, trans)
+	if s.cfg.Audit != nil {
+		var server *PeerIdentity
+		if err == nil {
+			selected := resp.Payload.Selected.PQSig
+			server = &PeerIdentity{Scheme: selected, PublicKey: s.sigs[selected].KeyPair.Public}
+		}
+		s.cfg.Audit(newRecord(RoleServer, trans, resp.TranscriptHash, resp.Signature, server, init.Identity, err))
+	}
+	return resp, keys, err
+}
+
+func (s *Server) accept(ctx context.Context, init ClientInit, trans *transcript.Accumulator) (ServerResponse, scheduler.Keys, error) {
+	if err := trans.Append("client_init", clientInitEntry(init)); err != nil {
 		return ServerResponse{}, scheduler.Keys{}, err
 	}
 
 	if init.Mode != s.cfg.Mode {
-		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("handshake: mode mismatch (expected %s got %s)", s.cfg.Mode, init.Mode)
+		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("%w: expected %s got %s", ErrModeMismatch, s.cfg.Mode, init.Mode)
+	}
+	if err := s.checkFreshness(init.Timestamp, init.Nonce, init.Ciphertext); err != nil {
+		return ServerResponse{}, scheduler.Keys{}, err
 	}
 
-	shared, err := s.cfg.KEMSuite.Decapsulate(s.cfg.KEMKeyPair.Private, init.Ciphertext)
+	if init.Mode == "hybrid" && len(init.ClassicalShare) == 0 {
+		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("%w: hybrid mode requires client classical key share", ErrDecode)
+	}
+	if init.Mode != "hybrid" && len(init.ClassicalShare) > 0 {
+		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("%w: classical key share not permitted in %s mode", ErrDecode, init.Mode)
+	}
+
+	selection, err := negotiate(init.Capabilities, s.cfg.Capabilities, init.KEM)
+	if err != nil {
+		return ServerResponse{}, scheduler.Keys{}, err
+	}
+	kemCred := s.kems[selection.PQKEM]
+	sigCred := s.sigs[selection.PQSig]
+
+	if err := s.authenticateClient(trans, init); err != nil {
+		return ServerResponse{}, scheduler.Keys{}, err
+	}
+	if err := s.verifyAttestation(ctx, init); err != nil {
+		return ServerResponse{}, scheduler.Keys{}, err
+	}
+
+	shared, err := kemCred.Suite.Decapsulate(kemCred.KeyPair.Private, init.Ciphertext)
 	if err != nil {
-		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("handshake: decapsulate: %w", err)
+		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("%w: decapsulate: %v", ErrDecode, err)
+	}
+	defer func() { shared.Wipe() }()
+
+	var serverShare []byte
+	if s.cfg.Mode == "hybrid" {
+		var classicalSecret *secret.Buffer
+		serverShare, classicalSecret, err = s.cfg.ClassicalSuite.Encapsulate(init.ClassicalShare)
+		if err != nil {
+			return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("%w: classical key exchange: %v", ErrDecode, err)
+		}
+		combined, err := scheduler.Combine(shared.Bytes(), classicalSecret.Bytes(), init.Ciphertext, init.ClassicalShare, serverShare)
+		classicalSecret.Wipe()
+		if err != nil {
+			return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("handshake: combine secrets: %w", err)
+		}
+		shared.Wipe()
+		shared = combined
 	}
 
 	serverNonce, err := randomBytes(32)
@@ -226,12 +617,15 @@ func (s *Server) Accept(ctx context.Context, init ClientInit) (ServerResponse, s
 	}
 
 	payload := ServerPayload{
-		Version:      1,
-		Mode:         s.cfg.Mode,
-		Timestamp:    time.Now().UTC(),
-		Nonce:        serverNonce,
-		RotationSecs: uint32(s.cfg.Scheduler.RotationInterval.Seconds()),
-		Capabilities: s.cfg.Capabilities,
+		Version:        1,
+		Mode:           s.cfg.Mode,
+		Timestamp:      time.Now().UTC(),
+		Nonce:          serverNonce,
+		RotationSecs:   uint32(s.cfg.Scheduler.RotationInterval.Seconds()),
+		Capabilities:   s.cfg.Capabilities,
+		Selected:       selection,
+		ClientOffer:    init.Capabilities,
+		ClassicalShare: serverShare,
 	}
 
 	if err := trans.Append("server_payload", payload); err != nil {
@@ -240,18 +634,20 @@ func (s *Server) Accept(ctx context.Context, init ClientInit) (ServerResponse, s
 
 	transHash := trans.Snapshot()
 
-	keys, err := scheduler.Derive(shared, transHash, s.cfg.Scheduler)
+	keys, err := scheduler.Derive(shared.Bytes(), transHash, s.cfg.Scheduler)
 	if err != nil {
 		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("handshake: derive keys: %w", err)
 	}
 
-	signature, err := s.cfg.SignatureScheme.Sign(s.cfg.SignatureKeyPair.Private, transHash)
+	signature, err := signTranscript(sigCred.Scheme, sigCred.KeyPair.Private, transHash, handshakeSignatureContext)
 	if err != nil {
+		keys.Wipe()
 		return ServerResponse{}, scheduler.Keys{}, fmt.Errorf("handshake: sign transcript: %w", err)
 	}
 
-	confirm, err := scheduler.Confirm(keys.ServerToClient, transHash)
+	confirm, err := scheduler.Confirm(keys.ServerToClient.Bytes(), transHash)
 	if err != nil {
+		keys.Wipe()
 		return ServerResponse{}, scheduler.Keys{}, err
 	}
 
@@ -264,15 +660,43 @@ func (s *Server) Accept(ctx context.Context, init ClientInit) (ServerResponse, s
 	return response, keys, nil
 }
 
-func initWithoutCiphertext(init ClientInit) map[string]any {
-	return map[string]any{
-		"version":         init.Version,
-		"mode":            init.Mode,
-		"timestamp":       init.Timestamp.UTC(),
-		"nonce":           init.Nonce,
-		"capabilities":    init.Capabilities,
-		"ciphertext_hash": hashBytes(init.Ciphertext),
+func defaultAEADs(caps *CapabilitySet) error {
+	if len(caps.AEADs) == 0 {
+		caps.AEADs = SupportedAEADs()
+	}
+	for _, name := range caps.AEADs {
+		if !contains(SupportedAEADs(), name) {
+			return fmt.Errorf("handshake: unsupported AEAD %q", name)
+		}
+	}
+	return nil
+}
+
+func validateMode(mode string) error {
+	switch mode {
+	case "strict", "hybrid":
+		return nil
+	default:
+		return fmt.Errorf("handshake: unsupported mode %q", mode)
+	}
+}
+
+// handshakeSignatureContext domain-separates transcript signatures from any other use
+// of the same signing key on schemes that support FIPS 204 context strings.
+const handshakeSignatureContext = "qsafe-handshake-transcript-v1"
+
+func signTranscript(scheme sign.Scheme, privateKey, transcriptHash []byte, context string) ([]byte, error) {
+	if cs, ok := scheme.(sign.ContextScheme); ok {
+		return cs.SignWithContext(privateKey, transcriptHash, []byte(context))
+	}
+	return scheme.Sign(privateKey, transcriptHash)
+}
+
+func verifyTranscript(scheme sign.Scheme, publicKey, transcriptHash, signature []byte, context string) error {
+	if cs, ok := scheme.(sign.ContextScheme); ok {
+		return cs.VerifyWithContext(publicKey, transcriptHash, []byte(context), signature)
 	}
+	return scheme.Verify(publicKey, transcriptHash, signature)
 }
 
 func randomBytes(size int) ([]byte, error) {
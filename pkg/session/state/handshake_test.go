@@ -2,12 +2,16 @@ package state
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/example/qsafe/pkg/crypto/kem"
 	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
 	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/policy"
+	"github.com/example/qsafe/pkg/session/ticket"
 )
 
 func TestHandshakeSuccess(t *testing.T) {
@@ -37,9 +41,9 @@ func TestHandshakeSuccess(t *testing.T) {
 		SignatureScheme:  sigSuite,
 		SignatureKeyPair: sigKeys,
 		Capabilities: CapabilitySet{
-			PQKEM:      kemSuite.Name(),
-			PQSigs:     sigSuite.Name(),
-			AEAD:       "xchacha20poly1305",
+			PQKEMs:     []string{kemSuite.Name()},
+			PQSigs:     []string{sigSuite.Name()},
+			AEADs:      []string{"xchacha20poly1305"},
 			Transports: []string{"grpc"},
 		},
 		Scheduler: schedCfg,
@@ -56,9 +60,9 @@ func TestHandshakeSuccess(t *testing.T) {
 		SignatureScheme:    sigSuite,
 		ServerSignatureKey: sigKeys.Public,
 		Capabilities: CapabilitySet{
-			PQKEM:      kemSuite.Name(),
-			PQSigs:     sigSuite.Name(),
-			AEAD:       "xchacha20poly1305",
+			PQKEMs:     []string{kemSuite.Name()},
+			PQSigs:     []string{sigSuite.Name()},
+			AEADs:      []string{"xchacha20poly1305"},
 			Transports: []string{"grpc"},
 		},
 	})
@@ -76,6 +80,11 @@ func TestHandshakeSuccess(t *testing.T) {
 		t.Fatalf("server accept: %v", err)
 	}
 
+	want := Selection{PQKEM: kemSuite.Name(), PQSig: sigSuite.Name(), AEAD: "xchacha20poly1305"}
+	if resp.Payload.Selected != want {
+		t.Fatalf("unexpected selection %+v", resp.Payload.Selected)
+	}
+
 	clientKeys, err := pending.Finish(ctx, resp)
 	if err != nil {
 		t.Fatalf("client finish: %v", err)
@@ -84,17 +93,55 @@ func TestHandshakeSuccess(t *testing.T) {
 	if !bytesEqual(serverKeys.SessionID, clientKeys.SessionID) {
 		t.Fatal("session id mismatch")
 	}
-	if !bytesEqual(serverKeys.ClientToServer, clientKeys.ClientToServer) {
+	if !bytesEqual(serverKeys.ClientToServer.Bytes(), clientKeys.ClientToServer.Bytes()) {
 		t.Fatal("client->server key mismatch")
 	}
-	if !bytesEqual(serverKeys.ServerToClient, clientKeys.ServerToClient) {
+	if !bytesEqual(serverKeys.ServerToClient.Bytes(), clientKeys.ServerToClient.Bytes()) {
 		t.Fatal("server->client key mismatch")
 	}
-	if !bytesEqual(serverKeys.ExporterSecret, clientKeys.ExporterSecret) {
+	if !bytesEqual(serverKeys.ExporterSecret.Bytes(), clientKeys.ExporterSecret.Bytes()) {
 		t.Fatal("exporter key mismatch")
 	}
 }
 
+func TestHandshakeHybrid(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+
+	clientInit, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if len(clientInit.ClassicalShare) != 32 {
+		t.Fatalf("expected 32-byte classical share, got %d", len(clientInit.ClassicalShare))
+	}
+
+	resp, serverKeys, err := server.Accept(ctx, *clientInit)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if len(resp.Payload.ClassicalShare) != 32 {
+		t.Fatalf("expected 32-byte server share, got %d", len(resp.Payload.ClassicalShare))
+	}
+
+	clientKeys, err := pending.Finish(ctx, resp)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if !bytesEqual(serverKeys.ClientToServer.Bytes(), clientKeys.ClientToServer.Bytes()) {
+		t.Fatal("client->server key mismatch")
+	}
+	if !bytesEqual(serverKeys.ServerToClient.Bytes(), clientKeys.ServerToClient.Bytes()) {
+		t.Fatal("server->client key mismatch")
+	}
+
+	stripped := *clientInit
+	stripped.ClassicalShare = nil
+	if _, _, err := server.Accept(ctx, stripped); err == nil {
+		t.Fatal("expected hybrid server to reject init without classical share")
+	}
+}
+
 func bytesEqual(a, b []byte) bool {
 	if len(a) != len(b) {
 		return false
@@ -106,3 +153,192 @@ func bytesEqual(a, b []byte) bool {
 	}
 	return true
 }
+
+func TestPendingClientCloseWipesSecrets(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	ephemeral := []*secret.Buffer{pending.sharedSecret, pending.classicalPrivate}
+	resp, serverKeys, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	defer serverKeys.Wipe()
+	keys, err := pending.Finish(ctx, resp)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	for i, buf := range ephemeral {
+		if !buf.Wiped() {
+			t.Fatalf("ephemeral secret %d survived Finish", i)
+		}
+	}
+
+	kept := pending.done.keys
+	raw := kept.ExporterSecret.Bytes()
+	pending.Close()
+	for i, buf := range []*secret.Buffer{kept.ClientToServer, kept.ServerToClient, kept.ExporterSecret, kept.SharedSecret} {
+		if !buf.Wiped() {
+			t.Fatalf("completion secret %d not wiped by Close", i)
+		}
+	}
+	if !bytesEqual(raw, make([]byte, len(raw))) {
+		t.Fatal("exporter secret not zeroed")
+	}
+	if keys.ClientToServer.Wiped() || !bytesEqual(keys.ClientToServer.Bytes(), serverKeys.ClientToServer.Bytes()) {
+		t.Fatal("Close touched the keys returned by Finish")
+	}
+	if _, err := pending.Finished(); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected Finished after Close to be refused, got %v", err)
+	}
+	keys.Wipe()
+	if !keys.ClientToServer.Wiped() || !keys.SharedSecret.Wiped() {
+		t.Fatal("Keys.Wipe left secrets behind")
+	}
+}
+
+func TestServerCloseWipesKeys(t *testing.T) {
+	server, _ := newHandshakePair(t, withMode("hybrid"))
+	var private [][]byte
+	for _, c := range server.kems {
+		private = append(private, c.KeyPair.Private)
+	}
+	for _, c := range server.sigs {
+		private = append(private, c.KeyPair.Private)
+	}
+	server.Close()
+	for i, key := range private {
+		if !bytesEqual(key, make([]byte, len(key))) {
+			t.Fatalf("private key %d survived Close", i)
+		}
+	}
+}
+
+// handshakeOption adjusts the configurations newHandshakePair builds from, before
+// either side is constructed.
+type handshakeOption func(t *testing.T, server *ServerConfig, client *ClientConfig)
+
+// newHandshakePair returns a server and a client that can reach it: ML-KEM-768 and
+// ML-DSA-65 in strict mode, without tickets, policy or client identity unless opts say
+// otherwise.
+func newHandshakePair(t *testing.T, opts ...handshakeOption) (*Server, *Client) {
+	t.Helper()
+	kemSuite := kem.NewMLKEM768()
+	serverKp, err := kemSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate kem keypair: %v", err)
+	}
+	sigSuite := sign.NewMLDSA65()
+	sigKeys, err := sigSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate signature keypair: %v", err)
+	}
+	schedCfg := scheduler.Config{Mode: "strict", RotationInterval: 10 * time.Minute}
+	serverCfg := ServerConfig{
+		KEMSuite:         kemSuite,
+		KEMKeyPair:       serverKp,
+		SignatureScheme:  sigSuite,
+		SignatureKeyPair: sigKeys,
+		Scheduler:        schedCfg,
+	}
+	clientCfg := ClientConfig{
+		KEMSuite:           kemSuite,
+		ServerPublicKey:    serverKp.Public,
+		Scheduler:          schedCfg,
+		SignatureScheme:    sigSuite,
+		ServerSignatureKey: sigKeys.Public,
+	}
+	for _, opt := range opts {
+		opt(t, &serverCfg, &clientCfg)
+	}
+	server, err := NewServer(serverCfg)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	client, err := NewClient(clientCfg)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return server, client
+}
+
+// newHandshakeClient returns another client for server, built from the server's
+// configuration and then adjusted by configure.
+func newHandshakeClient(t *testing.T, server *Server, configure func(*ClientConfig)) *Client {
+	t.Helper()
+	cfg := ClientConfig{
+		Mode:               server.cfg.Mode,
+		KEMSuite:           server.cfg.KEMSuite,
+		ServerPublicKey:    server.cfg.KEMKeyPair.Public,
+		Scheduler:          server.cfg.Scheduler,
+		SignatureScheme:    server.cfg.SignatureScheme,
+		ServerSignatureKey: server.cfg.SignatureKeyPair.Public,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client
+}
+
+// withMode runs both sides and their key schedules in mode.
+func withMode(mode string) handshakeOption {
+	return func(_ *testing.T, server *ServerConfig, client *ClientConfig) {
+		server.Mode, server.Scheduler.Mode = mode, mode
+		client.Mode, client.Scheduler.Mode = mode, mode
+	}
+}
+
+// withResumption gives the server a ticket keyring and a policy built from pcfg.
+func withResumption(pcfg policy.Config) handshakeOption {
+	return func(t *testing.T, server *ServerConfig, _ *ClientConfig) {
+		keyring, err := ticket.NewKeyring(ticket.Config{Lifetime: time.Hour})
+		if err != nil {
+			t.Fatalf("new keyring: %v", err)
+		}
+		server.Tickets = keyring
+		server.Policy = policy.New(pcfg)
+	}
+}
+
+// withSignatures has the server sign with primary and also offer additional, and the
+// client trust all of them.
+func withSignatures(primary sign.Scheme, additional ...sign.Scheme) handshakeOption {
+	return func(t *testing.T, server *ServerConfig, client *ClientConfig) {
+		keys, err := primary.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("generate signature keypair: %v", err)
+		}
+		server.SignatureScheme, server.SignatureKeyPair = primary, keys
+		client.SignatureScheme, client.ServerSignatureKey = primary, keys.Public
+		for _, scheme := range additional {
+			keys, err := scheme.GenerateKeyPair()
+			if err != nil {
+				t.Fatalf("generate signature keypair: %v", err)
+			}
+			server.AdditionalSignatures = append(server.AdditionalSignatures, SignatureCredential{Scheme: scheme, KeyPair: keys})
+			client.AdditionalVerifiers = append(client.AdditionalVerifiers, SignatureVerifier{Scheme: scheme, PublicKey: keys.Public})
+		}
+	}
+}
+
+// withServer applies configure to the server configuration.
+func withServer(configure func(*ServerConfig)) handshakeOption {
+	return func(_ *testing.T, server *ServerConfig, _ *ClientConfig) {
+		configure(server)
+	}
+}
+
+// withClient applies configure to the client configuration.
+func withClient(configure func(*ClientConfig)) handshakeOption {
+	return func(_ *testing.T, _ *ServerConfig, client *ClientConfig) {
+		configure(client)
+	}
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+// ErrClientAuthRequired indicates the server demands a client identity that was not supplied.
+var ErrClientAuthRequired = errors.New("handshake: client authentication required")
+
+// ErrClientNotAuthorized indicates a verified client identity was refused by server policy.
+var ErrClientNotAuthorized = errors.New("handshake: client not authorized")
+
+// clientSignatureContext separates client transcript signatures from server ones.
+const clientSignatureContext = "qsafe-handshake-client-v1"
+
+// PeerIdentity is the public signing identity a client presents during the handshake.
+type PeerIdentity struct {
+	Scheme    string `json:"scheme"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// Fingerprint returns a stable hex identifier for the identity, suitable for allow-lists.
+func (p PeerIdentity) Fingerprint() string {
+	h := blake3.New()
+	_, _ = h.Write([]byte("qsafe-peer-identity"))
+	_, _ = h.Write([]byte(p.Scheme))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(p.PublicKey)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verifier resolves the identity's scheme so its signatures can be checked.
+func (p PeerIdentity) Verifier() (SignatureVerifier, error) {
+	scheme, err := sign.Lookup(p.Scheme)
+	if err != nil {
+		return SignatureVerifier{}, err
+	}
+	return SignatureVerifier{Scheme: scheme, PublicKey: append([]byte(nil), p.PublicKey...)}, nil
+}
+
+// ClientIdentity holds the agent's signing credential for mutual authentication.
+type ClientIdentity struct {
+	Scheme  sign.Scheme
+	KeyPair sign.KeyPair
+}
+
+// Public returns the identity as advertised in ClientInit.
+func (c ClientIdentity) Public() PeerIdentity {
+	return PeerIdentity{Scheme: c.Scheme.Name(), PublicKey: c.KeyPair.Public}
+}
+
+// signClientInit signs the transcript after client_init and folds the signature in.
+func signClientInit(trans *transcript.Accumulator, id *ClientIdentity) ([]byte, error) {
+	signature, err := signTranscript(id.Scheme, id.KeyPair.Private, trans.Snapshot(), clientSignatureContext)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: sign client init: %w", err)
+	}
+	if err := trans.Append("client_signature", transcript.Raw(signature)); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// authenticateClient verifies the optional client identity against server policy and,
+// when present, folds its signature into the transcript.
+func (s *Server) authenticateClient(trans *transcript.Accumulator, init ClientInit) error {
+	if init.Identity == nil {
+		if s.cfg.RequireClientAuth {
+			return ErrClientAuthRequired
+		}
+		return nil
+	}
+	if !contains(s.cfg.ClientSignatureSchemes, init.Identity.Scheme) {
+		return fmt.Errorf("%w: client signature scheme %q", ErrNoCommonAlgorithm, init.Identity.Scheme)
+	}
+	scheme, err := sign.Lookup(init.Identity.Scheme)
+	if err != nil {
+		return fmt.Errorf("%w: client identity: %v", ErrNoCommonAlgorithm, err)
+	}
+	if err := verifyTranscript(scheme, init.Identity.PublicKey, trans.Snapshot(), init.IdentitySignature, clientSignatureContext); err != nil {
+		return fmt.Errorf("%w: client signature: %v", ErrBadSignature, err)
+	}
+	if err := trans.Append("client_signature", transcript.Raw(init.IdentitySignature)); err != nil {
+		return err
+	}
+	if s.cfg.AuthorizeClient != nil {
+		if err := s.cfg.AuthorizeClient(*init.Identity); err != nil {
+			return fmt.Errorf("%w: %v", ErrClientNotAuthorized, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+func TestHandshakeMutualAuth(t *testing.T) {
+	ctx := context.Background()
+
+	sigSuite := sign.NewMLDSA65()
+	clientKeys, err := sigSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate client keypair: %v", err)
+	}
+	identity := &ClientIdentity{Scheme: sigSuite, KeyPair: clientKeys}
+
+	var authorized string
+	server, _ := newHandshakePair(t, withServer(func(cfg *ServerConfig) {
+		cfg.RequireClientAuth = true
+		cfg.AuthorizeClient = func(id PeerIdentity) error {
+			if id.Fingerprint() != identity.Public().Fingerprint() {
+				return errors.New("unknown client")
+			}
+			authorized = id.Fingerprint()
+			return nil
+		}
+	}))
+	newClient := func(id *ClientIdentity) *Client {
+		return newHandshakeClient(t, server, func(cfg *ClientConfig) { cfg.Identity = id })
+	}
+
+	init, pending, err := newClient(identity).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, serverSide, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if authorized == "" {
+		t.Fatal("authorize hook not invoked")
+	}
+	clientSide, err := pending.Finish(ctx, resp)
+	if err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if !bytesEqual(serverSide.SessionID, clientSide.SessionID) {
+		t.Fatal("session id mismatch")
+	}
+
+	session, err := NewSession(SessionConfig{Role: RoleServer, Keys: serverSide, PeerIdentity: init.Identity})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	peer, ok := session.PeerIdentity()
+	if !ok || peer.Fingerprint() != authorized {
+		t.Fatal("session does not expose verified peer identity")
+	}
+
+	tampered := *init
+	tampered.IdentitySignature = append([]byte(nil), init.IdentitySignature...)
+	tampered.IdentitySignature[0] ^= 0xff
+	if _, _, err := server.Accept(ctx, tampered); err == nil {
+		t.Fatal("expected tampered client signature to fail")
+	}
+
+	anonymous, _, err := newClient(nil).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("anonymous initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *anonymous); !errors.Is(err, ErrClientAuthRequired) {
+		t.Fatalf("expected ErrClientAuthRequired, got %v", err)
+	}
+
+	strangerKeys, err := sigSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate stranger keypair: %v", err)
+	}
+	stranger, _, err := newClient(&ClientIdentity{Scheme: sigSuite, KeyPair: strangerKeys}).Initiate(ctx)
+	if err != nil {
+		t.Fatalf("stranger initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *stranger); !errors.Is(err, ErrClientNotAuthorized) {
+		t.Fatalf("expected ErrClientNotAuthorized, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnexpectedMessage indicates a handshake step taken out of order or after failure.
+var ErrUnexpectedMessage = errors.New("handshake: unexpected message")
+
+// HandshakeState is a step of a handshake as seen by one side.
+type HandshakeState uint8
+
+const (
+	// StateIdle: nothing has been sent.
+	StateIdle HandshakeState = iota
+	// StateNegotiating: the init is in flight and the server response is outstanding.
+	StateNegotiating
+	// StateConfirming: keys are derived and the client Finished is outstanding.
+	StateConfirming
+	// StateEstablished: the client Finished has been produced; traffic may flow.
+	StateEstablished
+	// StateFailed: a step failed. The handshake is abandoned and cannot be resumed.
+	StateFailed
+)
+
+var stateNames = [...]string{"idle", "negotiating", "confirming", "established", "failed"}
+
+func (s HandshakeState) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("HandshakeState(%d)", s)
+}
+
+// transitions lists the legal successors of each state. Any state other than
+// StateEstablished may also move to StateFailed.
+var transitions = map[HandshakeState]HandshakeState{
+	StateIdle:        StateNegotiating,
+	StateNegotiating: StateConfirming,
+	StateConfirming:  StateEstablished,
+}
+
+// Handshake tracks the state of one handshake and rejects steps taken out of order
+// without changing state. A step that fails moves the handshake to StateFailed, after
+// which no further step is accepted. It is safe for concurrent use.
+type Handshake struct {
+	mu    sync.Mutex
+	state HandshakeState
+}
+
+// State reports the current state.
+func (h *Handshake) State() HandshakeState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// step runs fn as the transition to next. fn only runs if the transition is legal, and
+// the handshake moves to next if fn succeeds or to StateFailed if it does not.
+func (h *Handshake) step(next HandshakeState, fn func() error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if succ, ok := transitions[h.state]; !ok || succ != next {
+		return fmt.Errorf("%w: %s while %s", ErrUnexpectedMessage, next, h.state)
+	}
+	if err := fn(); err != nil {
+		h.state = StateFailed
+		return err
+	}
+	h.state = next
+	return nil
+}
+
+// abandon moves the handshake to StateFailed from any state, so no further step is
+// accepted. It waits for a step in progress to finish.
+func (h *Handshake) abandon() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = StateFailed
+}
+
+// expect returns ErrUnexpectedMessage unless the handshake is in want.
+func (h *Handshake) expect(want HandshakeState) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state != want {
+		return fmt.Errorf("%w: expected %s, handshake is %s", ErrUnexpectedMessage, want, h.state)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHandshakeStateTransitions(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if got := pending.State(); got != StateNegotiating {
+		t.Fatalf("after initiate: state %s", got)
+	}
+	if _, err := pending.StoreTicket(NewSessionTicket{}); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected ticket before Finished to be unexpected, got %v", err)
+	}
+	if got := pending.State(); got != StateNegotiating {
+		t.Fatalf("out-of-order call changed state to %s", got)
+	}
+
+	resp, _, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected second response to be unexpected, got %v", err)
+	}
+	if _, err := pending.Finished(); err != nil {
+		t.Fatalf("client finished: %v", err)
+	}
+	if got := pending.State(); got != StateEstablished {
+		t.Fatalf("after finished: state %s", got)
+	}
+	if _, err := pending.Finished(); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected second Finished to be unexpected, got %v", err)
+	}
+}
+
+func TestHandshakeFailureIsTerminal(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, _, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	tampered := resp
+	tampered.Confirmation = append([]byte(nil), resp.Confirmation...)
+	tampered.Confirmation[0] ^= 0x01
+	if _, err := pending.Finish(ctx, tampered); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected integrity failure, got %v", err)
+	}
+	if got := pending.State(); got != StateFailed {
+		t.Fatalf("after failure: state %s", got)
+	}
+	if _, err := pending.Finish(ctx, resp); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected failed handshake to refuse a retry, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/example/qsafe/pkg/crypto/kem"
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+// ErrNoCommonAlgorithm indicates the peers share no acceptable algorithm for a category.
+var ErrNoCommonAlgorithm = errors.New("handshake: no mutually supported algorithm")
+
+// ErrUnexpectedSelection indicates the server selected an algorithm the client never offered.
+var ErrUnexpectedSelection = errors.New("handshake: server selected unoffered algorithm")
+
+// ErrDowngrade indicates the negotiated algorithms are weaker than the two offers allow,
+// i.e. an offer was altered in transit or the peer ignored the negotiation rules.
+var ErrDowngrade = errors.New("handshake: downgrade detected")
+
+// Selection records the algorithms chosen by the server for a session.
+type Selection struct {
+	PQKEM string `json:"pq_kem"`
+	PQSig string `json:"pq_sig"`
+	AEAD  string `json:"aead"`
+}
+
+// KEMCredential pairs a KEM suite with the gateway's static keypair for it.
+type KEMCredential struct {
+	Suite   kem.Suite
+	KeyPair kem.KeyPair
+}
+
+// SignatureCredential pairs a signature scheme with the gateway's signing keypair for it.
+type SignatureCredential struct {
+	Scheme  sign.Scheme
+	KeyPair sign.KeyPair
+}
+
+// SignatureVerifier pairs a signature scheme with the peer public key used to verify it.
+type SignatureVerifier struct {
+	Scheme    sign.Scheme
+	PublicKey []byte
+}
+
+// negotiate selects the best mutually supported algorithms. The server's lists are
+// authoritative for ordering; kemUsed is the suite the client already encapsulated with.
+func negotiate(offer, supported CapabilitySet, kemUsed string) (Selection, error) {
+	if !contains(offer.PQKEMs, kemUsed) {
+		return Selection{}, fmt.Errorf("%w: kem %q not in client offer", ErrNoCommonAlgorithm, kemUsed)
+	}
+	if !contains(supported.PQKEMs, kemUsed) {
+		return Selection{}, fmt.Errorf("%w: kem %q not permitted by server", ErrNoCommonAlgorithm, kemUsed)
+	}
+	if want, _ := firstCommon(offer.PQKEMs, supported.PQKEMs); want != kemUsed {
+		return Selection{}, fmt.Errorf("%w: client encapsulated with %q although both sides support %q", ErrDowngrade, kemUsed, want)
+	}
+
+	sig, ok := firstCommon(supported.PQSigs, offer.PQSigs)
+	if !ok {
+		return Selection{}, fmt.Errorf("%w: signature offer %v, server %v", ErrNoCommonAlgorithm, offer.PQSigs, supported.PQSigs)
+	}
+
+	aead, ok := firstCommon(supported.AEADs, offer.AEADs)
+	if !ok {
+		return Selection{}, fmt.Errorf("%w: aead offer %v, server %v", ErrNoCommonAlgorithm, offer.AEADs, supported.AEADs)
+	}
+
+	return Selection{PQKEM: kemUsed, PQSig: sig, AEAD: aead}, nil
+}
+
+// checkSelection ensures every selected algorithm was part of the local offer.
+func checkSelection(offer CapabilitySet, kemUsed string, sel Selection) error {
+	if sel.PQKEM != kemUsed {
+		return fmt.Errorf("%w: kem %q (encapsulated with %q)", ErrUnexpectedSelection, sel.PQKEM, kemUsed)
+	}
+	if !contains(offer.PQSigs, sel.PQSig) {
+		return fmt.Errorf("%w: signature %q", ErrUnexpectedSelection, sel.PQSig)
+	}
+	if !contains(offer.AEADs, sel.AEAD) {
+		return fmt.Errorf("%w: aead %q", ErrUnexpectedSelection, sel.AEAD)
+	}
+	return nil
+}
+
+// checkDowngrade recomputes the selection both full offers imply and requires the
+// server's choice to match it. The KEM follows client preference because the client
+// encapsulates before the server answers; every other category follows server preference.
+func checkDowngrade(clientOffer, serverOffer CapabilitySet, sel Selection) error {
+	var want Selection
+	want.PQKEM, _ = firstCommon(clientOffer.PQKEMs, serverOffer.PQKEMs)
+	want.PQSig, _ = firstCommon(serverOffer.PQSigs, clientOffer.PQSigs)
+	want.AEAD, _ = firstCommon(serverOffer.AEADs, clientOffer.AEADs)
+	if sel != want {
+		return fmt.Errorf("%w: selected %+v, offers imply %+v", ErrDowngrade, sel, want)
+	}
+	return nil
+}
+
+// sameOffer reports whether two capability sets list the same algorithms in the same order.
+func sameOffer(a, b CapabilitySet) bool {
+	return slices.Equal(a.PQKEMs, b.PQKEMs) &&
+		slices.Equal(a.PQSigs, b.PQSigs) &&
+		slices.Equal(a.AEADs, b.AEADs) &&
+		slices.Equal(a.Transports, b.Transports)
+}
+
+func firstCommon(preferred, offered []string) (string, bool) {
+	for _, p := range preferred {
+		if contains(offered, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/kem"
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+func TestNegotiatePrefersServerOrder(t *testing.T) {
+	offer := CapabilitySet{
+		PQKEMs: []string{"ML-KEM-768", "ML-KEM-1024"},
+		PQSigs: []string{"ML-DSA-65", "ML-DSA-87"},
+		AEADs:  []string{"xchacha20poly1305", "aes256gcm"},
+	}
+	supported := CapabilitySet{
+		PQKEMs: []string{"ML-KEM-1024", "ML-KEM-768"},
+		PQSigs: []string{"ML-DSA-87", "ML-DSA-65"},
+		AEADs:  []string{"aes256gcm", "xchacha20poly1305"},
+	}
+
+	sel, err := negotiate(offer, supported, "ML-KEM-768")
+	if err != nil {
+		t.Fatalf("negotiate: %v", err)
+	}
+	want := Selection{PQKEM: "ML-KEM-768", PQSig: "ML-DSA-87", AEAD: "aes256gcm"}
+	if sel != want {
+		t.Fatalf("unexpected selection %+v", sel)
+	}
+
+	if _, err := negotiate(offer, CapabilitySet{
+		PQKEMs: []string{"ML-KEM-768"},
+		PQSigs: []string{"ML-DSA-44"},
+		AEADs:  []string{"xchacha20poly1305"},
+	}, "ML-KEM-768"); !errors.Is(err, ErrNoCommonAlgorithm) {
+		t.Fatalf("expected no common signature, got %v", err)
+	}
+
+	if err := checkSelection(offer, "ML-KEM-768", Selection{PQKEM: "ML-KEM-768", PQSig: "ML-DSA-44", AEAD: "aes256gcm"}); !errors.Is(err, ErrUnexpectedSelection) {
+		t.Fatalf("expected unexpected selection, got %v", err)
+	}
+}
+
+func TestHandshakeRejectsUnsupportedKEMBeforeDecapsulation(t *testing.T) {
+	ctx := context.Background()
+
+	// A client encapsulating with a suite the server never offered.
+	x := kem.NewX25519()
+	xKp, err := x.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate x25519 keypair: %v", err)
+	}
+	server, client := newHandshakePair(t, withClient(func(cfg *ClientConfig) {
+		cfg.KEMSuite, cfg.ServerPublicKey = x, xKp.Public
+	}))
+
+	init, _, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	if _, _, err := server.Accept(ctx, *init); !errors.Is(err, ErrNoCommonAlgorithm) {
+		t.Fatalf("expected ErrNoCommonAlgorithm, got %v", err)
+	}
+}
+
+func TestCheckDowngrade(t *testing.T) {
+	client := CapabilitySet{
+		PQKEMs: []string{"ML-KEM-1024", "ML-KEM-768"},
+		PQSigs: []string{"ML-DSA-65", "ML-DSA-87"},
+		AEADs:  []string{"xchacha20poly1305"},
+	}
+	server := CapabilitySet{
+		PQKEMs: []string{"ML-KEM-768", "ML-KEM-1024"},
+		PQSigs: []string{"ML-DSA-87", "ML-DSA-65"},
+		AEADs:  []string{"xchacha20poly1305"},
+	}
+
+	if err := checkDowngrade(client, server, Selection{PQKEM: "ML-KEM-1024", PQSig: "ML-DSA-87", AEAD: "xchacha20poly1305"}); err != nil {
+		t.Fatalf("expected consistent selection, got %v", err)
+	}
+	if err := checkDowngrade(client, server, Selection{PQKEM: "ML-KEM-1024", PQSig: "ML-DSA-65", AEAD: "xchacha20poly1305"}); !errors.Is(err, ErrDowngrade) {
+		t.Fatalf("expected signature downgrade, got %v", err)
+	}
+	if _, err := negotiate(client, server, "ML-KEM-768"); !errors.Is(err, ErrDowngrade) {
+		t.Fatalf("expected kem downgrade, got %v", err)
+	}
+}
+
+func TestHandshakeDetectsStrippedOffer(t *testing.T) {
+	ctx := context.Background()
+
+	strong, weak := sign.NewMLDSA87(), sign.NewMLDSA65()
+	server, client := newHandshakePair(t, withSignatures(strong, weak))
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	// An on-path attacker strips the stronger signature scheme from the offer.
+	stripped := *init
+	stripped.Capabilities.PQSigs = []string{weak.Name()}
+	resp, _, err := server.Accept(ctx, stripped)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if resp.Payload.Selected.PQSig != weak.Name() {
+		t.Fatalf("expected server to select %s, got %s", weak.Name(), resp.Payload.Selected.PQSig)
+	}
+	if _, err := pending.Finish(ctx, resp); !errors.Is(err, ErrDowngrade) {
+		t.Fatalf("expected downgrade, got %v", err)
+	}
+}
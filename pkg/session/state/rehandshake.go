@@ -0,0 +1,426 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/example/qsafe/pkg/crypto/kem"
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+// Re-handshake signature contexts, one per direction as for the handshake itself.
+const (
+	rehandshakeInitContext     = "qsafe-rehandshake-init-v1"
+	rehandshakeResponseContext = "qsafe-rehandshake-response-v1"
+)
+
+var (
+	// ErrRehandshakeInProgress is returned by Rehandshake while a re-handshake the
+	// session started earlier is still pending.
+	ErrRehandshakeInProgress = errors.New("session: rehandshake already in progress")
+	// ErrRehandshakeCollision is returned by AcceptRehandshake on the client when both
+	// sides started a re-handshake at once. The client's init wins; the server abandons
+	// its own.
+	ErrRehandshakeCollision = errors.New("session: simultaneous rehandshake")
+)
+
+// rehandshakeExporterLabel derives the secret that chains a re-handshake to the session
+// it runs in. The "qsafe-" prefix keeps it out of reach of ExportKeyingMaterial callers.
+const rehandshakeExporterLabel = "qsafe-rehandshake"
+
+// RehandshakeInit opens a fresh KEM exchange inside an established session. Either side
+// may send it. PublicKey is an ephemeral key for the session's KEM, and Binder, keyed by
+// the current session secrets, shows the responder the init comes from its peer before
+// it does any asymmetric work.
+type RehandshakeInit struct {
+	Epoch     uint64 `json:"epoch"`
+	KEM       string `json:"kem"`
+	PublicKey []byte `json:"public_key"`
+	Nonce     []byte `json:"nonce"`
+	Binder    []byte `json:"binder"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// MarshalTranscript encodes the init as the rehandshake_init transcript entry. Binder
+// and Signature are computed over the transcript and are not part of it.
+func (i RehandshakeInit) MarshalTranscript(e *transcript.Encoder) {
+	e.Uint(1, i.Epoch)
+	e.String(2, i.KEM)
+	e.Bytes(3, i.PublicKey)
+	e.Bytes(4, i.Nonce)
+}
+
+// RehandshakeResponse completes a re-handshake. Confirmation proves the responder
+// derived the same keys; Signature is present when the responder has a signing key.
+type RehandshakeResponse struct {
+	Ciphertext   []byte `json:"ciphertext"`
+	Nonce        []byte `json:"nonce"`
+	Confirmation []byte `json:"confirmation"`
+	Signature    []byte `json:"signature,omitempty"`
+}
+
+// MarshalTranscript encodes the response as the rehandshake_response transcript entry.
+func (r RehandshakeResponse) MarshalTranscript(e *transcript.Encoder) {
+	h := blake3.Sum256(r.Ciphertext)
+	e.Bytes(1, h[:])
+	e.Bytes(2, r.Nonce)
+}
+
+// PendingRehandshake is an initiated re-handshake awaiting the peer's response. Its
+// ephemeral KEM key and chaining secret are wiped by Finish or Close.
+type PendingRehandshake struct {
+	session *Session
+	suite   kem.Suite
+	keyPair kem.KeyPair
+	init    RehandshakeInit
+	chain   *secret.Buffer
+	trans   *transcript.Accumulator
+}
+
+// Rehandshake starts a fresh KEM exchange with the peer. The session keeps using its
+// current keys until Finish installs the new ones. Only one re-handshake may be pending
+// at a time: until Finish or Close, Rehandshake returns ErrRehandshakeInProgress.
+func (s *Session) Rehandshake() (*RehandshakeInit, *PendingRehandshake, error) {
+	pending := &PendingRehandshake{session: s}
+	s.chainMu.Lock()
+	if s.pending != nil {
+		s.chainMu.Unlock()
+		return nil, nil, ErrRehandshakeInProgress
+	}
+	s.pending = pending
+	s.chainMu.Unlock()
+
+	suite, err := kem.Lookup(s.kem)
+	if err != nil {
+		pending.Close()
+		return nil, nil, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	keyPair, err := suite.GenerateKeyPair()
+	if err != nil {
+		pending.Close()
+		return nil, nil, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	pending.suite, pending.keyPair = suite, keyPair
+	if pending.chain, pending.trans, err = s.rehandshakeTranscript(); err != nil {
+		pending.Close()
+		return nil, nil, err
+	}
+	init, err := pending.start()
+	if err != nil {
+		pending.Close()
+		return nil, nil, err
+	}
+	pending.init = init
+	out := init
+	return &out, pending, nil
+}
+
+// start builds and signs the init, appending it to the pending transcript.
+func (p *PendingRehandshake) start() (RehandshakeInit, error) {
+	s, trans := p.session, p.trans
+	nonce, err := randomBytes(32)
+	if err != nil {
+		return RehandshakeInit{}, err
+	}
+	init := RehandshakeInit{
+		Epoch:     s.nextKEMEpoch(),
+		KEM:       p.suite.Name(),
+		PublicKey: p.keyPair.Public,
+		Nonce:     nonce,
+	}
+	if err := trans.Append("rehandshake_init", init); err != nil {
+		return RehandshakeInit{}, err
+	}
+	if init.Binder, err = scheduler.Confirm(p.chain.Bytes(), trans.Snapshot()); err != nil {
+		return RehandshakeInit{}, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	if s.signer != nil {
+		if init.Signature, err = signTranscript(s.signer.Scheme, s.signer.KeyPair.Private, trans.Snapshot(), rehandshakeInitContext); err != nil {
+			return RehandshakeInit{}, fmt.Errorf("session: sign rehandshake: %w", err)
+		}
+		if err := trans.Append("initiator_signature", transcript.Raw(init.Signature)); err != nil {
+			return RehandshakeInit{}, err
+		}
+	}
+	return init, nil
+}
+
+// Finish verifies the responder's reply and switches the session to the new keys. The
+// previous epoch stays open for receiving during the rotation grace period. Finish
+// consumes the pending re-handshake whether or not it succeeds, and fails for one the
+// session abandoned in favour of the peer's.
+func (p *PendingRehandshake) Finish(resp RehandshakeResponse) error {
+	defer p.Close()
+	s := p.session
+	s.chainMu.Lock()
+	current := s.pending == p
+	s.chainMu.Unlock()
+	if !current {
+		return fmt.Errorf("%w: rehandshake already finished or superseded", ErrUnexpectedMessage)
+	}
+	if err := p.trans.Append("rehandshake_response", resp); err != nil {
+		return err
+	}
+	hash := p.trans.Snapshot()
+	if s.peerVerifier != nil {
+		if len(resp.Signature) == 0 {
+			return fmt.Errorf("%w: rehandshake response is unsigned", ErrBadSignature)
+		}
+		if err := verifyTranscript(s.peerVerifier.Scheme, s.peerVerifier.PublicKey, hash, resp.Signature, rehandshakeResponseContext); err != nil {
+			return fmt.Errorf("%w: rehandshake response: %v", ErrBadSignature, err)
+		}
+	}
+
+	shared, err := p.suite.Decapsulate(p.keyPair.Private, resp.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("%w: rehandshake: %v", ErrIntegrity, err)
+	}
+	keys, err := s.rehandshakeKeys(shared.Bytes(), p.chain, resp.Ciphertext, p.init.PublicKey, hash)
+	shared.Wipe()
+	if err != nil {
+		return err
+	}
+	confirm, err := scheduler.Confirm(keys.ServerToClient.Bytes(), hash)
+	if err != nil {
+		keys.Wipe()
+		return fmt.Errorf("session: rehandshake: %w", err)
+	}
+	if !constantTimeEqual(confirm, resp.Confirmation) {
+		keys.Wipe()
+		return fmt.Errorf("%w: rehandshake confirmation mismatch", ErrIntegrity)
+	}
+	return s.installKeys(keys, p.init.Epoch)
+}
+
+// Close abandons the re-handshake, letting the session start another, and wipes its
+// ephemeral KEM private key and chaining secret. It is safe to call after Finish.
+func (p *PendingRehandshake) Close() {
+	s := p.session
+	s.chainMu.Lock()
+	if s.pending == p {
+		s.pending = nil
+	}
+	s.chainMu.Unlock()
+	p.keyPair.Wipe()
+	p.chain.Wipe()
+}
+
+// AcceptRehandshake answers a peer's RehandshakeInit and switches the session to the new
+// keys before returning, so the response must reach the peer before anything sealed
+// afterwards. Envelopes the peer sealed under the old keys still open during the grace
+// period.
+//
+// If this side has a re-handshake of its own pending, the two collided. The client's
+// init wins: a client refuses the server's with ErrRehandshakeCollision, and a server
+// abandons its own, whose Finish then fails.
+func (s *Session) AcceptRehandshake(init RehandshakeInit) (RehandshakeResponse, error) {
+	chain, trans, err := s.rehandshakeTranscript()
+	if err != nil {
+		return RehandshakeResponse{}, err
+	}
+	defer chain.Wipe()
+	if err := trans.Append("rehandshake_init", init); err != nil {
+		return RehandshakeResponse{}, err
+	}
+	binder, err := scheduler.Confirm(chain.Bytes(), trans.Snapshot())
+	if err != nil {
+		return RehandshakeResponse{}, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	if !constantTimeEqual(binder, init.Binder) {
+		return RehandshakeResponse{}, fmt.Errorf("%w: rehandshake binder mismatch", ErrIntegrity)
+	}
+	if want := s.nextKEMEpoch(); init.Epoch != want {
+		return RehandshakeResponse{}, fmt.Errorf("%w: rehandshake to epoch %d, expected %d", ErrUnexpectedMessage, init.Epoch, want)
+	}
+	if init.KEM != s.kem {
+		return RehandshakeResponse{}, fmt.Errorf("%w: rehandshake kem %q, session uses %q", ErrNoCommonAlgorithm, init.KEM, s.kem)
+	}
+	if s.peerVerifier != nil {
+		if len(init.Signature) == 0 {
+			return RehandshakeResponse{}, fmt.Errorf("%w: rehandshake init is unsigned", ErrBadSignature)
+		}
+		if err := verifyTranscript(s.peerVerifier.Scheme, s.peerVerifier.PublicKey, trans.Snapshot(), init.Signature, rehandshakeInitContext); err != nil {
+			return RehandshakeResponse{}, fmt.Errorf("%w: rehandshake init: %v", ErrBadSignature, err)
+		}
+	}
+	s.chainMu.Lock()
+	if s.pending != nil {
+		if s.role == RoleClient {
+			s.chainMu.Unlock()
+			return RehandshakeResponse{}, fmt.Errorf("%w: %w", ErrUnexpectedMessage, ErrRehandshakeCollision)
+		}
+		s.pending = nil
+	}
+	s.chainMu.Unlock()
+	if init.Signature != nil {
+		if err := trans.Append("initiator_signature", transcript.Raw(init.Signature)); err != nil {
+			return RehandshakeResponse{}, err
+		}
+	}
+
+	suite, err := kem.Lookup(init.KEM)
+	if err != nil {
+		return RehandshakeResponse{}, fmt.Errorf("%w: %v", ErrNoCommonAlgorithm, err)
+	}
+	ciphertext, shared, err := suite.Encapsulate(init.PublicKey)
+	if err != nil {
+		return RehandshakeResponse{}, fmt.Errorf("%w: rehandshake: %v", ErrDecode, err)
+	}
+	defer shared.Wipe()
+	nonce, err := randomBytes(32)
+	if err != nil {
+		return RehandshakeResponse{}, err
+	}
+	resp := RehandshakeResponse{Ciphertext: ciphertext, Nonce: nonce}
+	if err := trans.Append("rehandshake_response", resp); err != nil {
+		return RehandshakeResponse{}, err
+	}
+	hash := trans.Snapshot()
+
+	keys, err := s.rehandshakeKeys(shared.Bytes(), chain, ciphertext, init.PublicKey, hash)
+	if err != nil {
+		return RehandshakeResponse{}, err
+	}
+	if resp.Confirmation, err = scheduler.Confirm(keys.ServerToClient.Bytes(), hash); err != nil {
+		keys.Wipe()
+		return RehandshakeResponse{}, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	if s.signer != nil {
+		if resp.Signature, err = signTranscript(s.signer.Scheme, s.signer.KeyPair.Private, hash, rehandshakeResponseContext); err != nil {
+			keys.Wipe()
+			return RehandshakeResponse{}, fmt.Errorf("session: sign rehandshake: %w", err)
+		}
+	}
+	if err := s.installKeys(keys, init.Epoch); err != nil {
+		return RehandshakeResponse{}, err
+	}
+	return resp, nil
+}
+
+// RehandshakeDue reports whether the session's keys have outlived the configured
+// re-handshake interval.
+func (s *Session) RehandshakeDue() bool {
+	return s.rotation.RehandshakeDue(time.Now().UTC())
+}
+
+// rehandshakeTranscript starts a re-handshake transcript chained to the current one and
+// returns the chaining secret exported from the current keys.
+func (s *Session) rehandshakeTranscript() (*secret.Buffer, *transcript.Accumulator, error) {
+	s.chainMu.Lock()
+	previous := append([]byte(nil), s.transcript...)
+	exporter := s.exporter.Clone()
+	s.chainMu.Unlock()
+	if exporter == nil {
+		return nil, nil, ErrSessionClosed
+	}
+	defer exporter.Wipe()
+	if len(previous) == 0 {
+		return nil, nil, fmt.Errorf("session: rehandshake: no transcript to chain to")
+	}
+
+	chain, err := scheduler.Export(scheduler.Keys{ExporterSecret: exporter}, rehandshakeExporterLabel, previous, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	trans := transcript.New("qsafe-rehandshake")
+	if err := trans.Append("previous", transcript.Raw(previous)); err != nil {
+		clear(chain)
+		return nil, nil, err
+	}
+	return secret.Take(chain), trans, nil
+}
+
+// rehandshakeKeys derives the new key set. The KEM secret is combined with the chaining
+// secret, so the result depends on both the fresh exchange and the session it extends.
+func (s *Session) rehandshakeKeys(shared []byte, chain *secret.Buffer, ciphertext, publicKey, hash []byte) (scheduler.Keys, error) {
+	combined, err := scheduler.Combine(shared, chain.Bytes(), ciphertext, publicKey)
+	if err != nil {
+		return scheduler.Keys{}, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	defer combined.Wipe()
+	s.sendMu.Lock()
+	keySize := s.sendKey.Len()
+	s.sendMu.Unlock()
+	s.chainMu.Lock()
+	exporterSize := s.exporter.Len()
+	s.chainMu.Unlock()
+	keys, err := scheduler.Derive(combined.Bytes(), hash, scheduler.Config{
+		Mode:          s.mode,
+		ClientKeySize: keySize,
+		ServerKeySize: keySize,
+		ExporterSize:  exporterSize,
+	})
+	if err != nil {
+		return scheduler.Keys{}, fmt.Errorf("session: rehandshake: %w", err)
+	}
+	return keys, nil
+}
+
+// nextKEMEpoch is the epoch both directions move to after a re-handshake: one past the
+// later of the two, so it is fresh whichever side last rekeyed.
+func (s *Session) nextKEMEpoch() uint64 {
+	send := s.rotation.NextEpoch()
+	var recv uint64
+	s.recvMu.Lock()
+	if s.recv != nil {
+		recv = s.recv.epoch
+	}
+	s.recvMu.Unlock()
+	if recv > send {
+		return recv + 1
+	}
+	return send + 1
+}
+
+// installKeys switches both directions to keys at epoch, which must be past both
+// current epochs. The session ID, and so the nonce sequence, is unchanged; the exporter
+// secret and transcript are replaced, so exported values and channel bindings change
+// after a re-handshake. The session takes ownership of keys and wipes the ones they
+// replace, or keys themselves if they are refused.
+func (s *Session) installKeys(keys scheduler.Keys, epoch uint64) error {
+	keys.SharedSecret.Wipe()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	if s.sendCipher == nil {
+		keys.Wipe()
+		return ErrSessionClosed
+	}
+	// Checked under the locks, so two exchanges racing to the same epoch cannot both
+	// install and the loser never touches the winner's replay window.
+	if current := max(s.rotation.NextEpoch(), s.recv.epoch); epoch <= current {
+		keys.Wipe()
+		return fmt.Errorf("%w: rehandshake to epoch %d, session already at %d", ErrUnexpectedMessage, epoch, current)
+	}
+
+	sendKey, recvKey := directionalKeys(s.role, keys)
+	sendCipher, err := newCipher(s.aeadName, sendKey.Bytes())
+	if err != nil {
+		keys.Wipe()
+		return err
+	}
+	next, err := newRecvEpoch(s.aeadName, recvKey, epoch, s.replayCfg, replayKey(s.sessionID, s.role, epoch))
+	if err != nil {
+		keys.Wipe()
+		return err
+	}
+
+	now := time.Now()
+	s.sendKey.Wipe()
+	s.sendKey, s.sendCipher, s.sendSeq = sendKey, sendCipher, 0
+	s.rotation.Advance(now.UTC(), epoch)
+	s.recv.expires = now.Add(s.rotation.Grace())
+	s.retireRecvLocked(s.recv, next)
+	s.exporter.Wipe()
+	s.exporter = keys.ExporterSecret
+	s.transcript = keys.TranscriptHash
+	return nil
+}
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/secret"
+	"github.com/example/qsafe/pkg/crypto/sign"
+)
+
+func TestRehandshakeSwitchesKeys(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	scheme := sign.NewMLDSA65()
+	serverSig, err := scheme.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate signing key: %v", err)
+	}
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch, PeerVerifier: &SignatureVerifier{Scheme: scheme, PublicKey: serverSig.Public}})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch, Signer: &SignatureCredential{Scheme: scheme, KeyPair: serverSig}})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+	bindingBefore, _ := client.ChannelBinding()
+
+	// A symmetric rekey on one side first; the re-handshake must land past it.
+	notice, err := client.Rekey()
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if err := server.ApplyRekey(notice); err != nil {
+		t.Fatalf("apply rekey: %v", err)
+	}
+	inFlight, _, err := client.Encrypt(ctx, []byte("in flight"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	init, pending, err := client.Rehandshake()
+	if err != nil {
+		t.Fatalf("rehandshake: %v", err)
+	}
+	if init.Epoch != InitialEpoch+2 {
+		t.Fatalf("unexpected re-handshake epoch %d", init.Epoch)
+	}
+	resp, err := server.AcceptRehandshake(*init)
+	if err != nil {
+		t.Fatalf("accept rehandshake: %v", err)
+	}
+	if _, err := server.AcceptRehandshake(*init); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected a replayed init to be refused, got %v", err)
+	}
+
+	reply, _, err := server.Encrypt(ctx, []byte("new keys"), nil)
+	if err != nil {
+		t.Fatalf("server encrypt: %v", err)
+	}
+	if _, _, err := client.Decrypt(ctx, reply); !errors.Is(err, ErrUnknownEpoch) {
+		t.Fatalf("expected new epoch to be unknown before Finish, got %v", err)
+	}
+
+	if _, _, err := client.Rehandshake(); !errors.Is(err, ErrRehandshakeInProgress) {
+		t.Fatalf("expected a second pending re-handshake to be refused, got %v", err)
+	}
+
+	if err := pending.Finish(resp); err != nil {
+		t.Fatalf("finish rehandshake: %v", err)
+	}
+	if !pending.chain.Wiped() || !bytes.Equal(pending.keyPair.Private, make([]byte, len(pending.keyPair.Private))) {
+		t.Fatal("re-handshake secrets survived Finish")
+	}
+
+	// The signed response is bound to its own init.
+	_, other, err := client.Rehandshake()
+	if err != nil {
+		t.Fatalf("second rehandshake: %v", err)
+	}
+	if err := other.Finish(resp); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected a response for another init to be refused, got %v", err)
+	}
+	if plaintext, _, err := client.Decrypt(ctx, reply); err != nil || string(plaintext) != "new keys" {
+		t.Fatalf("decrypt after re-handshake: %q, %v", plaintext, err)
+	}
+	if plaintext, _, err := server.Decrypt(ctx, inFlight); err != nil || string(plaintext) != "in flight" {
+		t.Fatalf("in-flight envelope lost: %q, %v", plaintext, err)
+	}
+	fresh, _, err := client.Encrypt(ctx, []byte("after"), nil)
+	if err != nil || fresh.Epoch != init.Epoch || fresh.Sequence != 1 {
+		t.Fatalf("unexpected envelope after re-handshake: epoch %d sequence %d, %v", fresh.Epoch, fresh.Sequence, err)
+	}
+	if _, _, err := server.Decrypt(ctx, fresh); err != nil {
+		t.Fatalf("server decrypt after re-handshake: %v", err)
+	}
+
+	bindingAfter, _ := client.ChannelBinding()
+	serverBinding, _ := server.ChannelBinding()
+	if bytes.Equal(bindingBefore, bindingAfter) || !bytes.Equal(bindingAfter, serverBinding) {
+		t.Fatal("channel binding did not move to the new keys on both sides")
+	}
+}
+
+func TestRehandshakeRejectsForeignInit(t *testing.T) {
+	keys := testKeys(t)
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+	other := keys
+	other.ExporterSecret = secret.From(bytes.Repeat([]byte{0x99}, keys.ExporterSecret.Len()))
+	stranger, err := NewSession(SessionConfig{Role: RoleClient, Keys: other, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("stranger session: %v", err)
+	}
+	init, _, err := stranger.Rehandshake()
+	if err != nil {
+		t.Fatalf("rehandshake: %v", err)
+	}
+	if _, err := server.AcceptRehandshake(*init); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected init without the session secret to be refused, got %v", err)
+	}
+}
+
+func TestRehandshakeSimultaneous(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+
+	// Both sides start at once and each receives the other's init.
+	clientInit, clientPending, err := client.Rehandshake()
+	if err != nil {
+		t.Fatalf("client rehandshake: %v", err)
+	}
+	serverInit, serverPending, err := server.Rehandshake()
+	if err != nil {
+		t.Fatalf("server rehandshake: %v", err)
+	}
+	if _, err := client.AcceptRehandshake(*serverInit); !errors.Is(err, ErrRehandshakeCollision) {
+		t.Fatalf("expected the client to refuse the server's init, got %v", err)
+	}
+	resp, err := server.AcceptRehandshake(*clientInit)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if err := serverPending.Finish(resp); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected the server's abandoned re-handshake to fail, got %v", err)
+	}
+	if err := clientPending.Finish(resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+
+	env, _, err := client.Encrypt(ctx, []byte("agreed"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if plaintext, _, err := server.Decrypt(ctx, env); err != nil || string(plaintext) != "agreed" || env.Epoch != clientInit.Epoch {
+		t.Fatalf("decrypt after collision: %q epoch %d, %v", plaintext, env.Epoch, err)
+	}
+
+	// Keys for an epoch the session has already reached are never installed again.
+	if err := server.installKeys(testKeys(t), clientInit.Epoch); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected a stale epoch to be refused, got %v", err)
+	}
+	if _, _, err := server.Rehandshake(); err != nil {
+		t.Fatalf("server rehandshake after collision: %v", err)
+	}
+}
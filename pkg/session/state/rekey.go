@@ -0,0 +1,213 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
+	"github.com/example/qsafe/pkg/session/replay"
+)
+
+var (
+	// ErrRekeyRequired is returned by Encrypt once the epoch's hard packet limit is
+	// reached; the sender must call Rekey before sealing anything else.
+	ErrRekeyRequired = errors.New("session: rekey required")
+	// ErrUnknownEpoch is returned by Decrypt for an envelope whose epoch has no keys,
+	// either because the peer has not announced it or its grace period has ended.
+	ErrUnknownEpoch = errors.New("session: unknown epoch")
+)
+
+// rekeySignatureContext separates rekey notice signatures from handshake signatures made
+// with the same key.
+const rekeySignatureContext = "qsafe-rekey-v1"
+
+// RekeyNotice announces that the sender has moved its sending direction to NextEpoch. It
+// mirrors the RekeyNotice message in messaging.proto. Commitment proves the sender holds
+// the next epoch's key, and Signature, when the sender has a signing key, authenticates
+// the notice to a peer that does not trust the channel alone.
+type RekeyNotice struct {
+	NextEpoch  uint64 `json:"next_epoch"`
+	Commitment []byte `json:"commitment"`
+	Signature  []byte `json:"signature,omitempty"`
+}
+
+// recvEpoch is the key, cipher and replay window for one receive epoch.
+type recvEpoch struct {
+	epoch   uint64
+	key     *secret.Buffer
+	cipher  cipherAEAD
+	window  *replay.Window
+	expires time.Time
+}
+
+// newRecvEpoch takes ownership of key, wiping it if the cipher or replay window cannot
+// be built. windowKey names the epoch's window in cfg.Store, if one is set.
+func newRecvEpoch(aead string, key *secret.Buffer, epoch uint64, cfg replay.Config, windowKey string) (*recvEpoch, error) {
+	cipher, err := newCipher(aead, key.Bytes())
+	if err != nil {
+		key.Wipe()
+		return nil, err
+	}
+	window, err := replay.Open(context.Background(), cfg, windowKey)
+	if err != nil {
+		key.Wipe()
+		return nil, fmt.Errorf("session: replay window: %w", err)
+	}
+	return &recvEpoch{
+		epoch:  epoch,
+		key:    key,
+		cipher: cipher,
+		window: window,
+	}, nil
+}
+
+// discard wipes the epoch's key and forgets its persisted replay window. A failure to
+// forget only leaves a stale mark in the store, so it is ignored.
+func (e *recvEpoch) discard() {
+	e.key.Wipe()
+	_ = e.window.Forget(context.Background())
+}
+
+// replayKey names the replay window of the direction received by role at epoch.
+func replayKey(sessionID []byte, role Role, epoch uint64) string {
+	return fmt.Sprintf("%x/%s/%d", sessionID, role, epoch)
+}
+
+// Rekey moves the sending direction to the next epoch and returns the notice the peer
+// must apply before it can open anything sealed afterwards. Sequence numbers restart at
+// 1 under the new key, and the packet and time budgets start afresh.
+func (s *Session) Rekey() (RekeyNotice, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.sendCipher == nil {
+		return RekeyNotice{}, ErrSessionClosed
+	}
+
+	next := s.rotation.NextEpoch() + 1
+	key, err := scheduler.NextTrafficKey(s.sendKey, next)
+	if err != nil {
+		return RekeyNotice{}, fmt.Errorf("session: rekey: %w", err)
+	}
+	notice, cipher, err := s.rekeyNotice(key, next)
+	if err != nil {
+		key.Wipe()
+		return RekeyNotice{}, err
+	}
+
+	s.sendKey.Wipe()
+	s.sendKey, s.sendCipher, s.sendSeq = key, cipher, 0
+	s.rotation.Reset(time.Now().UTC())
+	return notice, nil
+}
+
+// rekeyNotice builds the cipher and the notice announcing key at epoch next.
+func (s *Session) rekeyNotice(key *secret.Buffer, next uint64) (RekeyNotice, cipherAEAD, error) {
+	cipher, err := newCipher(s.aeadName, key.Bytes())
+	if err != nil {
+		return RekeyNotice{}, nil, err
+	}
+	commitment, err := scheduler.Confirm(key.Bytes(), rekeyContext(s.sessionID, next))
+	if err != nil {
+		return RekeyNotice{}, nil, fmt.Errorf("session: rekey: %w", err)
+	}
+	notice := RekeyNotice{NextEpoch: next, Commitment: commitment}
+	if s.signer != nil {
+		notice.Signature, err = signTranscript(s.signer.Scheme, s.signer.KeyPair.Private, notice.signedBytes(s.sessionID), rekeySignatureContext)
+		if err != nil {
+			return RekeyNotice{}, nil, fmt.Errorf("session: sign rekey notice: %w", err)
+		}
+	}
+	return notice, cipher, nil
+}
+
+// ApplyRekey moves the receiving direction to the epoch announced by notice. The notice
+// must name the epoch directly after the current one and its commitment must match the
+// key derived locally. The previous epoch's keys and replay window are kept for the
+// rotation grace period so envelopes already in flight still open.
+func (s *Session) ApplyRekey(notice RekeyNotice) error {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+
+	current := s.recv
+	if current == nil {
+		return ErrSessionClosed
+	}
+	if notice.NextEpoch != current.epoch+1 {
+		return fmt.Errorf("%w: rekey to epoch %d while at epoch %d", ErrUnexpectedMessage, notice.NextEpoch, current.epoch)
+	}
+	if s.peerVerifier != nil {
+		if len(notice.Signature) == 0 {
+			return fmt.Errorf("%w: rekey notice is unsigned", ErrBadSignature)
+		}
+		if err := verifyTranscript(s.peerVerifier.Scheme, s.peerVerifier.PublicKey, notice.signedBytes(s.sessionID), notice.Signature, rekeySignatureContext); err != nil {
+			return fmt.Errorf("%w: rekey notice: %v", ErrBadSignature, err)
+		}
+	}
+
+	key, err := scheduler.NextTrafficKey(current.key, notice.NextEpoch)
+	if err != nil {
+		return fmt.Errorf("session: rekey: %w", err)
+	}
+	commitment, err := scheduler.Confirm(key.Bytes(), rekeyContext(s.sessionID, notice.NextEpoch))
+	if err != nil {
+		key.Wipe()
+		return fmt.Errorf("session: rekey: %w", err)
+	}
+	if !constantTimeEqual(commitment, notice.Commitment) {
+		key.Wipe()
+		return fmt.Errorf("%w: rekey commitment mismatch", ErrIntegrity)
+	}
+	next, err := newRecvEpoch(s.aeadName, key, notice.NextEpoch, s.replayCfg, replayKey(s.sessionID, s.role, notice.NextEpoch))
+	if err != nil {
+		return err
+	}
+
+	current.expires = time.Now().Add(s.rotation.Grace())
+	s.retireRecvLocked(current, next)
+	return nil
+}
+
+// retireRecvLocked makes next the receive epoch and keeps current for its grace period,
+// discarding the epoch current displaces. The caller holds recvMu.
+func (s *Session) retireRecvLocked(current, next *recvEpoch) {
+	if s.recvPrev != nil {
+		s.recvPrev.discard()
+	}
+	s.recvPrev, s.recv = current, next
+}
+
+// recvEpochLocked returns the receive state for epoch, dropping the previous epoch once
+// its grace period has passed. The caller holds recvMu.
+func (s *Session) recvEpochLocked(epoch uint64, now time.Time) (*recvEpoch, error) {
+	if s.recv == nil {
+		return nil, ErrSessionClosed
+	}
+	if s.recvPrev != nil && !now.Before(s.recvPrev.expires) {
+		s.recvPrev.discard()
+		s.recvPrev = nil
+	}
+	switch {
+	case epoch == s.recv.epoch:
+		return s.recv, nil
+	case s.recvPrev != nil && epoch == s.recvPrev.epoch:
+		return s.recvPrev, nil
+	default:
+		return nil, fmt.Errorf("%w: %d (current %d)", ErrUnknownEpoch, epoch, s.recv.epoch)
+	}
+}
+
+// rekeyContext binds a commitment to the session and epoch it announces.
+func rekeyContext(sessionID []byte, epoch uint64) []byte {
+	buf := make([]byte, 0, len("qsafe-rekey")+len(sessionID)+8)
+	buf = append(buf, []byte("qsafe-rekey")...)
+	buf = append(buf, sessionID...)
+	return binary.BigEndian.AppendUint64(buf, epoch)
+}
+
+func (n RekeyNotice) signedBytes(sessionID []byte) []byte {
+	return append(rekeyContext(sessionID, n.NextEpoch), n.Commitment...)
+}
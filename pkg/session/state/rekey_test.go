@@ -0,0 +1,130 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/replay"
+	"github.com/example/qsafe/pkg/session/rotation"
+)
+
+func TestRekeyAdvancesEpoch(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	rot := rotation.Config{Interval: time.Hour, MaxPackets: 2}
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Rotation: rot, Replay: replay.Config{Depth: 64}, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Rotation: rot, Replay: replay.Config{Depth: 64}, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+
+	var sealed []Envelope
+	for i := 0; i < 4; i++ {
+		env, _, err := client.Encrypt(ctx, []byte("old"), nil)
+		if err != nil {
+			t.Fatalf("encrypt %d: %v", i, err)
+		}
+		sealed = append(sealed, env)
+	}
+	if _, rotate, err := client.Encrypt(ctx, []byte("too many"), nil); !errors.Is(err, ErrRekeyRequired) || !rotate {
+		t.Fatalf("expected hard limit to refuse encryption, got %v", err)
+	}
+
+	notice, err := client.Rekey()
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if notice.NextEpoch != InitialEpoch+1 {
+		t.Fatalf("unexpected next epoch %d", notice.NextEpoch)
+	}
+	fresh, _, err := client.Encrypt(ctx, []byte("new"), nil)
+	if err != nil {
+		t.Fatalf("encrypt after rekey: %v", err)
+	}
+	if fresh.Epoch != notice.NextEpoch || fresh.Sequence != 1 {
+		t.Fatalf("unexpected envelope epoch %d sequence %d", fresh.Epoch, fresh.Sequence)
+	}
+	if _, _, err := server.Decrypt(ctx, fresh); !errors.Is(err, ErrUnknownEpoch) {
+		t.Fatalf("expected unannounced epoch to be refused, got %v", err)
+	}
+
+	if err := server.ApplyRekey(notice); err != nil {
+		t.Fatalf("apply rekey: %v", err)
+	}
+	if err := server.ApplyRekey(notice); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected repeated notice to be refused, got %v", err)
+	}
+	if plaintext, _, err := server.Decrypt(ctx, fresh); err != nil || string(plaintext) != "new" {
+		t.Fatalf("decrypt new epoch: %q, %v", plaintext, err)
+	}
+	// In-flight envelopes from the old epoch still open, each only once.
+	if plaintext, _, err := server.Decrypt(ctx, sealed[0]); err != nil || string(plaintext) != "old" {
+		t.Fatalf("decrypt previous epoch: %q, %v", plaintext, err)
+	}
+	if _, _, err := server.Decrypt(ctx, sealed[0]); !errors.Is(err, replay.ErrDuplicate) {
+		t.Fatalf("expected replay in previous epoch, got %v", err)
+	}
+
+	// Once the grace period passes, the previous epoch is forgotten.
+	server.recvMu.Lock()
+	server.recvPrev.expires = time.Now().Add(-time.Second)
+	server.recvMu.Unlock()
+	if _, _, err := server.Decrypt(ctx, sealed[1]); !errors.Is(err, ErrUnknownEpoch) {
+		t.Fatalf("expected expired epoch to be refused, got %v", err)
+	}
+}
+
+func TestRekeyNoticeVerification(t *testing.T) {
+	keys := testKeys(t)
+	scheme := sign.NewMLDSA65()
+	pair, err := scheme.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate signing key: %v", err)
+	}
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch, Signer: &SignatureCredential{Scheme: scheme, KeyPair: pair}})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	newServer := func() *Session {
+		server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch, PeerVerifier: &SignatureVerifier{Scheme: scheme, PublicKey: pair.Public}})
+		if err != nil {
+			t.Fatalf("server session: %v", err)
+		}
+		return server
+	}
+
+	notice, err := client.Rekey()
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+
+	unsigned := notice
+	unsigned.Signature = nil
+	if err := newServer().ApplyRekey(unsigned); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected unsigned notice to be refused, got %v", err)
+	}
+	forged := notice
+	forged.Commitment = append([]byte(nil), notice.Commitment...)
+	forged.Commitment[0] ^= 0xff
+	if err := newServer().ApplyRekey(forged); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected altered commitment to fail the signature, got %v", err)
+	}
+	if err := newServer().ApplyRekey(notice); err != nil {
+		t.Fatalf("apply signed notice: %v", err)
+	}
+
+	// Without a verifier the commitment alone must still match the derived key.
+	unverified, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("unverified session: %v", err)
+	}
+	if err := unverified.ApplyRekey(forged); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected commitment mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,398 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
+	"github.com/example/qsafe/pkg/session/ticket"
+	"github.com/example/qsafe/pkg/session/transcript"
+)
+
+// ErrResumptionDisabled indicates the server does not issue or accept tickets.
+var ErrResumptionDisabled = errors.New("handshake: resumption disabled")
+
+// ErrResumptionRefused indicates a ticket was presented but cannot be used; callers
+// should fall back to a full handshake.
+var ErrResumptionRefused = errors.New("handshake: resumption refused")
+
+// NewSessionTicket is sent by the server once the client Finished has been verified.
+// Ticket is opaque to the client; EarlyData reports whether it may carry 0-RTT data.
+type NewSessionTicket struct {
+	Ticket    []byte    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+	EarlyData bool      `json:"early_data,omitempty"`
+}
+
+// ClientTicket is the client's record of a ticket, suitable for persisting between runs.
+// Secret is the resumption secret and must be stored with the same care as a key.
+type ClientTicket struct {
+	Ticket    []byte    `json:"ticket"`
+	Secret    []byte    `json:"secret"`
+	Mode      string    `json:"mode"`
+	Selected  Selection `json:"selected"`
+	ExpiresAt time.Time `json:"expires_at"`
+	EarlyData bool      `json:"early_data,omitempty"`
+}
+
+// ticketState is the server's view of a session, sealed inside the ticket.
+type ticketState struct {
+	Secret    []byte        `json:"secret"`
+	Mode      string        `json:"mode"`
+	Selected  Selection     `json:"selected"`
+	Peer      *PeerIdentity `json:"peer,omitempty"`
+	EarlyData bool          `json:"early_data,omitempty"`
+}
+
+// ResumeInit opens an abbreviated handshake from a previously issued ticket. EarlyData,
+// if present, is sealed under keys derived from the ticket secret.
+type ResumeInit struct {
+	Version   uint32    `json:"version"`
+	Mode      string    `json:"mode"`
+	Timestamp time.Time `json:"timestamp"`
+	Nonce     []byte    `json:"nonce"`
+	Ticket    []byte    `json:"ticket"`
+	EarlyData *Envelope `json:"early_data,omitempty"`
+}
+
+// ResumePayload carries the server fields covered by the resumption transcript.
+type ResumePayload struct {
+	Version      uint32    `json:"version"`
+	Mode         string    `json:"mode"`
+	Timestamp    time.Time `json:"timestamp"`
+	Nonce        []byte    `json:"nonce"`
+	RotationSecs uint32    `json:"rotation_secs"`
+	Selected     Selection `json:"selected"`
+	// EarlyDataAccepted reports whether the server opened the 0-RTT data. If false the
+	// client must resend it over the established session.
+	EarlyDataAccepted bool `json:"early_data_accepted"`
+}
+
+// ResumeResponse is the server reply to ResumeInit. There is no signature: only a holder
+// of the resumption secret can produce a matching Confirmation.
+type ResumeResponse struct {
+	Payload        ResumePayload `json:"payload"`
+	TranscriptHash []byte        `json:"transcript_hash"`
+	Confirmation   []byte        `json:"confirmation"`
+}
+
+// ResumedSession is the server's result of a successful Resume. Peer is the identity
+// authenticated by the original handshake, if any; EarlyData is set only when 0-RTT
+// data was offered and accepted.
+type ResumedSession struct {
+	Keys      scheduler.Keys
+	Peer      *PeerIdentity
+	EarlyData *EarlyData
+}
+
+// PendingResumption captures state between Resume and Finish. It holds its own copy of
+// the ticket's resumption secret, in resumption, so the caller's ticket is untouched by
+// Close.
+type PendingResumption struct {
+	transcript    *transcript.Accumulator
+	cfg           ClientConfig
+	ticket        ClientTicket
+	resumption    *secret.Buffer
+	earlyAccepted bool
+	hs            Handshake
+	done          completion
+}
+
+// IssueTicket seals a resumption secret for a confirmed session. It must only be called
+// after VerifyFinished succeeds for keys.
+func (s *Server) IssueTicket(keys scheduler.Keys, selected Selection, peer *PeerIdentity) (NewSessionTicket, error) {
+	if s.cfg.Tickets == nil {
+		return NewSessionTicket{}, ErrResumptionDisabled
+	}
+	if s.cfg.Policy != nil {
+		if err := s.cfg.Policy.ValidateResumption(s.cfg.Mode); err != nil {
+			return NewSessionTicket{}, fmt.Errorf("%w: %v", ErrResumptionDisabled, err)
+		}
+	}
+	resumption, err := scheduler.ResumptionSecret(keys)
+	if err != nil {
+		return NewSessionTicket{}, err
+	}
+	st := ticketState{Secret: resumption, Mode: s.cfg.Mode, Selected: selected, Peer: peer}
+	st.EarlyData = s.cfg.Policy == nil || s.cfg.Policy.ValidateEarlyData(s.cfg.Mode) == nil
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return NewSessionTicket{}, fmt.Errorf("handshake: encode ticket: %w", err)
+	}
+	sealed, expires, err := s.cfg.Tickets.Seal(payload)
+	if err != nil {
+		return NewSessionTicket{}, err
+	}
+	return NewSessionTicket{Ticket: sealed, ExpiresAt: expires, EarlyData: st.EarlyData}, nil
+}
+
+// StoreTicket pairs a server ticket with the locally derived resumption secret. Tickets
+// are only accepted once the handshake is established.
+func (p *PendingClient) StoreTicket(nst NewSessionTicket) (ClientTicket, error) {
+	return p.done.storeTicket(&p.hs, nst)
+}
+
+// StoreTicket pairs a server ticket with the locally derived resumption secret. Tickets
+// are only accepted once the handshake is established.
+func (p *PendingResumption) StoreTicket(nst NewSessionTicket) (ClientTicket, error) {
+	return p.done.storeTicket(&p.hs, nst)
+}
+
+func (c completion) storeTicket(hs *Handshake, nst NewSessionTicket) (ClientTicket, error) {
+	if err := hs.expect(StateEstablished); err != nil {
+		return ClientTicket{}, err
+	}
+	resumption, err := scheduler.ResumptionSecret(*c.keys)
+	if err != nil {
+		return ClientTicket{}, err
+	}
+	return ClientTicket{
+		Ticket:    nst.Ticket,
+		Secret:    resumption,
+		Mode:      c.mode,
+		Selected:  c.selected,
+		ExpiresAt: nst.ExpiresAt,
+		EarlyData: nst.EarlyData,
+	}, nil
+}
+
+// Resume starts an abbreviated handshake from t. No KEM or signature work is done; keys
+// are derived from the ticket secret and a transcript over both fresh nonces.
+func (c *Client) Resume(ctx context.Context, t ClientTicket) (*ResumeInit, *PendingResumption, error) {
+	if t.Mode != c.cfg.Mode {
+		return nil, nil, fmt.Errorf("%w: ticket issued for %s mode", ErrResumptionRefused, t.Mode)
+	}
+	if !time.Now().Before(t.ExpiresAt) {
+		return nil, nil, fmt.Errorf("%w: %w", ErrResumptionRefused, ticket.ErrExpired)
+	}
+	if len(t.Ticket) == 0 || len(t.Secret) == 0 {
+		return nil, nil, fmt.Errorf("%w: incomplete ticket", ErrResumptionRefused)
+	}
+
+	nonce, err := randomBytes(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	init := &ResumeInit{
+		Version:   1,
+		Mode:      c.cfg.Mode,
+		Timestamp: time.Now().UTC(),
+		Nonce:     nonce,
+		Ticket:    t.Ticket,
+	}
+	trans := transcript.New("qsafe-resumption")
+	if err := trans.Append("resume_init", resumeInitEntry(*init)); err != nil {
+		return nil, nil, err
+	}
+	pending := &PendingResumption{transcript: trans, cfg: c.cfg, ticket: t, resumption: secret.From(t.Secret), hs: Handshake{state: StateNegotiating}}
+	pending.ticket.Secret = nil
+	return init, pending, nil
+}
+
+// ResumeWithEarlyData is Resume with plaintext sent as 0-RTT data in the ResumeInit.
+// Early data has no replay protection beyond the server's ticket cache and no forward
+// secrecy from the ticket secret; only send requests that are safe to repeat. After
+// Finish, EarlyDataAccepted reports whether it must be resent.
+func (c *Client) ResumeWithEarlyData(ctx context.Context, t ClientTicket, plaintext []byte, metadata map[string]string) (*ResumeInit, *PendingResumption, error) {
+	if !t.EarlyData {
+		return nil, nil, ErrEarlyDataNotPermitted
+	}
+	init, pending, err := c.Resume(ctx, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	earlyKeys, err := earlyDataKeys(t.Secret, pending.transcript.Snapshot(), c.cfg.Scheduler)
+	if err != nil {
+		pending.Close()
+		return nil, nil, err
+	}
+	env, err := sealEarlyData(t.Selected.AEAD, earlyKeys, plaintext, metadata)
+	earlyKeys.Wipe()
+	if err != nil {
+		pending.Close()
+		return nil, nil, err
+	}
+	if err := pending.transcript.Append("early_data", earlyDataEntry(env)); err != nil {
+		return nil, nil, err
+	}
+	init.EarlyData = &env
+	return init, pending, nil
+}
+
+// State reports how far the resumption has progressed.
+func (p *PendingResumption) State() HandshakeState {
+	return p.hs.State()
+}
+
+// Finish validates the server's resumption response and derives symmetric keys. As with
+// PendingClient.Finish, the returned keys belong to the caller.
+func (p *PendingResumption) Finish(ctx context.Context, resp ResumeResponse) (scheduler.Keys, error) {
+	var keys scheduler.Keys
+	err := p.hs.step(StateConfirming, func() (err error) {
+		keys, err = p.finish(resp)
+		if p.cfg.Audit != nil {
+			p.cfg.Audit(newRecord(RoleClient, p.transcript, resp.TranscriptHash, nil, nil, nil, err))
+		}
+		return err
+	})
+	return keys, err
+}
+
+func (p *PendingResumption) finish(resp ResumeResponse) (scheduler.Keys, error) {
+	if resp.Payload.Mode != p.cfg.Mode {
+		return scheduler.Keys{}, fmt.Errorf("%w: expected %s got %s", ErrModeMismatch, p.cfg.Mode, resp.Payload.Mode)
+	}
+	if resp.Payload.Selected != p.ticket.Selected {
+		return scheduler.Keys{}, fmt.Errorf("%w: resumed with %+v, ticket holds %+v", ErrUnexpectedSelection, resp.Payload.Selected, p.ticket.Selected)
+	}
+	if err := p.transcript.Append("resume_payload", resp.Payload); err != nil {
+		return scheduler.Keys{}, err
+	}
+	transHash := p.transcript.Snapshot()
+	if !constantTimeEqual(transHash, resp.TranscriptHash) {
+		return scheduler.Keys{}, fmt.Errorf("%w: transcript hash", ErrIntegrity)
+	}
+
+	keys, err := scheduler.Derive(p.resumption.Bytes(), transHash, p.cfg.Scheduler)
+	p.resumption.Wipe()
+	if err != nil {
+		return scheduler.Keys{}, fmt.Errorf("handshake: derive keys: %w", err)
+	}
+	confirm, err := scheduler.Confirm(keys.ServerToClient.Bytes(), transHash)
+	if err != nil {
+		keys.Wipe()
+		return scheduler.Keys{}, err
+	}
+	if !constantTimeEqual(confirm, resp.Confirmation) {
+		keys.Wipe()
+		return scheduler.Keys{}, fmt.Errorf("%w: confirmation", ErrIntegrity)
+	}
+	p.done = newCompletion(keys, transHash, p.cfg.Mode, resp.Payload.Selected)
+	p.earlyAccepted = resp.Payload.EarlyDataAccepted
+	return keys, nil
+}
+
+// EarlyDataAccepted reports whether the server accepted the 0-RTT data. It is only
+// meaningful after Finish succeeds.
+func (p *PendingResumption) EarlyDataAccepted() bool {
+	return p.earlyAccepted
+}
+
+// Finished builds the client Finished message and marks the resumption established. It
+// is only available, once, after Finish succeeds.
+func (p *PendingResumption) Finished() (HandshakeFinished, error) {
+	return p.done.finished(&p.hs)
+}
+
+// Close abandons the resumption and wipes its copy of the resumption secret and the
+// keys kept for Finished and StoreTicket.
+func (p *PendingResumption) Close() {
+	p.hs.abandon()
+	p.resumption.Wipe()
+	p.done.wipe()
+}
+
+// Resume redeems a ticket and returns the response with the resumed keys, peer identity
+// and any accepted early data. As with Accept, the session should stay pending until
+// VerifyFinished succeeds; early data, however, is available immediately and may be a
+// replay (see EarlyData).
+func (s *Server) Resume(ctx context.Context, init ResumeInit) (ResumeResponse, ResumedSession, error) {
+	trans := transcript.New("qsafe-resumption")
+	resp, resumed, err := s.resume(ctx, init, trans)
+	if s.cfg.Audit != nil {
+		s.cfg.Audit(newRecord(RoleServer, trans, resp.TranscriptHash, nil, nil, resumed.Peer, err))
+	}
+	return resp, resumed, err
+}
+
+func (s *Server) resume(ctx context.Context, init ResumeInit, trans *transcript.Accumulator) (ResumeResponse, ResumedSession, error) {
+	if s.cfg.Tickets == nil {
+		return ResumeResponse{}, ResumedSession{}, ErrResumptionDisabled
+	}
+	if init.Mode != s.cfg.Mode {
+		return ResumeResponse{}, ResumedSession{}, fmt.Errorf("%w: expected %s got %s", ErrModeMismatch, s.cfg.Mode, init.Mode)
+	}
+	if s.cfg.Policy != nil {
+		if err := s.cfg.Policy.ValidateResumption(init.Mode); err != nil {
+			return ResumeResponse{}, ResumedSession{}, fmt.Errorf("%w: %v", ErrResumptionRefused, err)
+		}
+	}
+	// Ticket reuse is enforced by the keyring, which remembers redeemed tickets for
+	// their whole lifetime; only the nonce goes through the freshness cache.
+	if err := s.checkFreshness(init.Timestamp, init.Nonce, nil); err != nil {
+		return ResumeResponse{}, ResumedSession{}, err
+	}
+
+	sealed, err := s.cfg.Tickets.Redeem(init.Ticket)
+	if err != nil {
+		return ResumeResponse{}, ResumedSession{}, fmt.Errorf("%w: %w", ErrResumptionRefused, err)
+	}
+	var st ticketState
+	if err := json.Unmarshal(sealed, &st); err != nil {
+		return ResumeResponse{}, ResumedSession{}, fmt.Errorf("%w: decode ticket: %v", ErrResumptionRefused, err)
+	}
+	if st.Mode != s.cfg.Mode || !contains(s.cfg.Capabilities.AEADs, st.Selected.AEAD) {
+		return ResumeResponse{}, ResumedSession{}, fmt.Errorf("%w: ticket parameters no longer permitted", ErrResumptionRefused)
+	}
+
+	if err := trans.Append("resume_init", resumeInitEntry(init)); err != nil {
+		return ResumeResponse{}, ResumedSession{}, err
+	}
+	var early *EarlyData
+	if init.EarlyData != nil {
+		if s.earlyDataPermitted(st, init.Ticket, init.EarlyData) {
+			earlyKeys, err := earlyDataKeys(st.Secret, trans.Snapshot(), s.cfg.Scheduler)
+			if err != nil {
+				return ResumeResponse{}, ResumedSession{}, err
+			}
+			early, err = openEarlyData(st.Selected.AEAD, earlyKeys, *init.EarlyData)
+			earlyKeys.Wipe()
+			if err != nil {
+				return ResumeResponse{}, ResumedSession{}, err
+			}
+		}
+		// Rejected early data is still bound into the transcript so both sides agree
+		// on what was offered.
+		if err := trans.Append("early_data", earlyDataEntry(*init.EarlyData)); err != nil {
+			return ResumeResponse{}, ResumedSession{}, err
+		}
+	}
+
+	serverNonce, err := randomBytes(32)
+	if err != nil {
+		return ResumeResponse{}, ResumedSession{}, err
+	}
+	payload := ResumePayload{
+		Version:           1,
+		Mode:              s.cfg.Mode,
+		Timestamp:         time.Now().UTC(),
+		Nonce:             serverNonce,
+		RotationSecs:      uint32(s.cfg.Scheduler.RotationInterval.Seconds()),
+		Selected:          st.Selected,
+		EarlyDataAccepted: early != nil,
+	}
+	if err := trans.Append("resume_payload", payload); err != nil {
+		return ResumeResponse{}, ResumedSession{}, err
+	}
+	transHash := trans.Snapshot()
+
+	keys, err := scheduler.Derive(st.Secret, transHash, s.cfg.Scheduler)
+	clear(st.Secret)
+	if err != nil {
+		return ResumeResponse{}, ResumedSession{}, fmt.Errorf("handshake: derive keys: %w", err)
+	}
+	confirm, err := scheduler.Confirm(keys.ServerToClient.Bytes(), transHash)
+	if err != nil {
+		keys.Wipe()
+		return ResumeResponse{}, ResumedSession{}, err
+	}
+	return ResumeResponse{
+		Payload:        payload,
+		TranscriptHash: transHash,
+		Confirmation:   confirm,
+	}, ResumedSession{Keys: keys, Peer: st.Peer, EarlyData: early}, nil
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
+	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/policy"
+	"github.com/example/qsafe/pkg/session/ticket"
+)
+
+func TestResumption(t *testing.T) {
+	ctx := context.Background()
+
+	sigSuite := sign.NewMLDSA65()
+	clientKeys, err := sigSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate client keypair: %v", err)
+	}
+	identity := &ClientIdentity{Scheme: sigSuite, KeyPair: clientKeys}
+	server, client := newHandshakePair(t,
+		withMode("hybrid"),
+		withResumption(policy.Config{AllowedModes: []string{"hybrid"}}),
+		withClient(func(cfg *ClientConfig) { cfg.Identity = identity }),
+	)
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	resp, serverKeys, err := server.Accept(ctx, *init)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish: %v", err)
+	}
+	if _, err := pending.Finished(); err != nil {
+		t.Fatalf("client finished: %v", err)
+	}
+	nst, err := server.IssueTicket(serverKeys, resp.Payload.Selected, init.Identity)
+	if err != nil {
+		t.Fatalf("issue ticket: %v", err)
+	}
+	stored, err := pending.StoreTicket(nst)
+	if err != nil {
+		t.Fatalf("store ticket: %v", err)
+	}
+
+	resumeInit, resuming, err := client.Resume(ctx, stored)
+	if err != nil {
+		t.Fatalf("client resume: %v", err)
+	}
+	resumeResp, resumed, err := server.Resume(ctx, *resumeInit)
+	if err != nil {
+		t.Fatalf("server resume: %v", err)
+	}
+	if resumed.Peer == nil || resumed.Peer.Fingerprint() != identity.Public().Fingerprint() {
+		t.Fatalf("resumed session lost peer identity: %+v", resumed.Peer)
+	}
+	resumedServer := resumed.Keys
+	resumedClient, err := resuming.Finish(ctx, resumeResp)
+	if err != nil {
+		t.Fatalf("client resume finish: %v", err)
+	}
+	if !bytes.Equal(resumedClient.ClientToServer.Bytes(), resumedServer.ClientToServer.Bytes()) {
+		t.Fatal("resumed client->server keys differ")
+	}
+	if bytes.Equal(resumedClient.ClientToServer.Bytes(), serverKeys.ClientToServer.Bytes()) {
+		t.Fatal("resumed session reused original traffic keys")
+	}
+	fin, err := resuming.Finished()
+	if err != nil {
+		t.Fatalf("resume finished: %v", err)
+	}
+	if err := VerifyFinished(resumedServer, resumeResp.TranscriptHash, fin); err != nil {
+		t.Fatalf("verify resume finished: %v", err)
+	}
+
+	// Tickets are single-use.
+	again, _, err := client.Resume(ctx, stored)
+	if err != nil {
+		t.Fatalf("client resume: %v", err)
+	}
+	if _, _, err := server.Resume(ctx, *again); !errors.Is(err, ErrResumptionRefused) || !errors.Is(err, ticket.ErrReused) {
+		t.Fatalf("expected reused ticket refusal, got %v", err)
+	}
+}
+
+func TestResumptionRefusedInStrictModeByDefault(t *testing.T) {
+	server, _ := newHandshakePair(t, withResumption(policy.Config{}))
+	keys := scheduler.Keys{ExporterSecret: secret.From([]byte("exporter")), TranscriptHash: []byte("transcript")}
+	if _, err := server.IssueTicket(keys, Selection{}, nil); !errors.Is(err, ErrResumptionDisabled) {
+		t.Fatalf("expected strict resumption to be disabled, got %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package state
+
+import "encoding/binary"
+
+// HelloRetryRequest asks the client to resend its ClientInit with Cookie set. The server
+// keeps no state for the first attempt: the cookie itself proves the client received the
+// reply at its claimed address, and only then does the server do KEM or signature work.
+type HelloRetryRequest struct {
+	Cookie []byte `json:"cookie"`
+}
+
+// Retry returns a copy of init carrying the cookie from hrr.
+func (init ClientInit) Retry(hrr HelloRetryRequest) ClientInit {
+	init.Cookie = append([]byte(nil), hrr.Cookie...)
+	return init
+}
+
+// RetryBinding is the value a retry cookie is bound to: the client's network address and
+// the init nonce, length-prefixed so the two cannot be shifted into each other.
+func RetryBinding(addr string, init ClientInit) []byte {
+	out := make([]byte, 0, 8+len(addr)+len(init.Nonce))
+	out = binary.BigEndian.AppendUint64(out, uint64(len(addr)))
+	out = append(out, addr...)
+	return append(out, init.Nonce...)
+}
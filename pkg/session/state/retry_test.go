@@ -0,0 +1,36 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestRetriedInitKeepsTranscript(t *testing.T) {
+	ctx := context.Background()
+	server, client := newHandshakePair(t, withMode("hybrid"))
+
+	init, pending, err := client.Initiate(ctx)
+	if err != nil {
+		t.Fatalf("client initiate: %v", err)
+	}
+	retried := init.Retry(HelloRetryRequest{Cookie: []byte("cookie")})
+	if init.Cookie != nil {
+		t.Fatal("Retry modified the original init")
+	}
+	resp, _, err := server.Accept(ctx, retried)
+	if err != nil {
+		t.Fatalf("server accept: %v", err)
+	}
+	if _, err := pending.Finish(ctx, resp); err != nil {
+		t.Fatalf("client finish after retry: %v", err)
+	}
+}
+
+func TestRetryBinding(t *testing.T) {
+	a := RetryBinding("10.0.0.1", ClientInit{Nonce: []byte("1nonce")})
+	b := RetryBinding("10.0.0.11", ClientInit{Nonce: []byte("nonce")})
+	if bytes.Equal(a, b) {
+		t.Fatal("address and nonce boundaries are ambiguous")
+	}
+}
@@ -0,0 +1,348 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
+	"github.com/example/qsafe/pkg/session/policy"
+	"github.com/example/qsafe/pkg/session/replay"
+	"github.com/example/qsafe/pkg/session/rotation"
+)
+
+// SealedKeySize is the length of the wrapping key taken by MarshalSealed and
+// RestoreSession.
+const SealedKeySize = chacha20poly1305.KeySize
+
+// sealedSequenceSkip is how far a restored session's send sequence starts past the one
+// it was sealed at. The original may go on sealing after MarshalSealed; as long as it
+// seals fewer messages than this, the restored session never reuses one of its nonces.
+const sealedSequenceSkip = 1 << 20
+
+// sealedContext versions the sealed format and binds it as associated data.
+const sealedContext = "qsafe-sealed-session-v1"
+
+// ErrSealedSession is returned by RestoreSession for a blob that is malformed, forged
+// or sealed under another wrapping key.
+var ErrSealedSession = errors.New("session: invalid sealed session")
+
+// RestoreConfig supplies what a sealed session does not carry: local configuration, and
+// signing keys, which never leave the process.
+type RestoreConfig struct {
+	Rotation rotation.Config
+	Replay   replay.Config
+	Policy   *policy.Enforcer
+	// Signers maps signature scheme names to credentials. A session that signed its
+	// rekey notices is restored with the credential for the same scheme.
+	Signers map[string]*SignatureCredential
+}
+
+// MarshalSealed exports the session's state encrypted and authenticated under
+// wrappingKey with XChaCha20-Poly1305: role, algorithms, traffic and exporter keys,
+// epochs, send sequence, rotation progress, peer identity and receive replay windows.
+// Layout: nonce || AEAD(state). RestoreSession turns it back into a session.
+//
+// A sealed session must be restored at most once, and the original should be released
+// rather than used further: both sides of a split would seal with the same keys.
+func (s *Session) MarshalSealed(wrappingKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(wrappingKey)
+	if err != nil {
+		return nil, fmt.Errorf("session: wrapping key: %w", err)
+	}
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	if s.sendCipher == nil {
+		return nil, ErrSessionClosed
+	}
+
+	epochs := []*recvEpoch{s.recv}
+	if s.recvPrev != nil {
+		epochs = append(epochs, s.recvPrev)
+	}
+	snapshots := make([]replay.Snapshot, len(epochs))
+	size := 1024 + len(s.sessionID) + len(s.transcript) + s.sendKey.Len() + s.exporter.Len()
+	for i, epoch := range epochs {
+		snapshots[i] = epoch.window.Snapshot()
+		size += 64 + epoch.key.Len() + 8*len(snapshots[i].Blocks)
+	}
+	if s.peer != nil {
+		size += len(s.peer.PublicKey)
+	}
+	if s.peerVerifier != nil {
+		size += len(s.peerVerifier.PublicKey)
+	}
+
+	// Sized up front so that growing the buffer never leaves a stray copy of the keys.
+	w := sealedWriter{buf: make([]byte, 0, size)}
+	defer func() { clear(w.buf) }()
+	w.uint(uint64(s.role))
+	w.string(s.mode)
+	w.string(s.aeadName)
+	w.string(s.kem)
+	w.bytes(s.sessionID)
+	w.bytes(s.sendKey.Bytes())
+	w.uint(s.sendSeq + sealedSequenceSkip)
+	progress := s.rotation.State()
+	w.time(progress.Start)
+	w.time(progress.KEMAt)
+	w.uint(progress.Packets)
+	w.uint(progress.Epoch)
+	w.uint(uint64(s.rotation.Interval()))
+	w.bytes(s.exporter.Bytes())
+	w.bytes(s.transcript)
+	w.time(s.established)
+	w.identity(s.peer)
+	var verifier *PeerIdentity
+	if s.peerVerifier != nil {
+		verifier = &PeerIdentity{Scheme: s.peerVerifier.Scheme.Name(), PublicKey: s.peerVerifier.PublicKey}
+	}
+	w.identity(verifier)
+	var signer string
+	if s.signer != nil {
+		signer = s.signer.Scheme.Name()
+	}
+	w.string(signer)
+	w.uint(uint64(len(epochs)))
+	for i, epoch := range epochs {
+		w.uint(epoch.epoch)
+		w.bytes(epoch.key.Bytes())
+		w.time(epoch.expires)
+		w.uint(snapshots[i].Highest)
+		w.uint(snapshots[i].Reserved)
+		w.uint(uint64(len(snapshots[i].Blocks)))
+		for _, block := range snapshots[i].Blocks {
+			w.uint(block)
+		}
+	}
+
+	out := make([]byte, aead.NonceSize(), aead.NonceSize()+len(w.buf)+aead.Overhead())
+	if _, err := rand.Read(out); err != nil {
+		return nil, fmt.Errorf("session: random nonce: %w", err)
+	}
+	return aead.Seal(out, out, w.buf, []byte(sealedContext)), nil
+}
+
+// RestoreSession rebuilds a session exported by MarshalSealed. Its send sequence skips
+// ahead of the sealed one, and its replay windows refuse everything the original
+// accepted. With a replay Store configured, a window whose mark is still the one the
+// original released picks up exactly where it left off; one whose mark has moved on
+// skips ahead past it. The session is checked against cfg.Policy as NewSession would.
+func RestoreSession(sealed, wrappingKey []byte, cfg RestoreConfig) (*Session, error) {
+	aead, err := chacha20poly1305.NewX(wrappingKey)
+	if err != nil {
+		return nil, fmt.Errorf("session: wrapping key: %w", err)
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrSealedSession
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(sealedContext))
+	if err != nil {
+		return nil, ErrSealedSession
+	}
+	defer clear(plaintext)
+
+	r := sealedReader{buf: plaintext}
+	role := Role(r.uint())
+	mode, aeadName, kemName := r.string(), r.string(), r.string()
+	sessionID := r.bytes()
+	sendKey := r.bytes()
+	sendSeq := r.uint()
+	progress := rotation.State{Start: r.time(), KEMAt: r.time(), Packets: r.uint(), Epoch: r.uint()}
+	interval := time.Duration(r.uint())
+	exporter := r.bytes()
+	transcript := r.bytes()
+	established := r.time()
+	peer := r.identity()
+	verifierID := r.identity()
+	signerScheme := r.string()
+	count := r.uint()
+	if count != 1 && count != 2 {
+		return nil, ErrSealedSession
+	}
+	epochs := make([]sealedEpoch, count)
+	for i := range epochs {
+		epochs[i] = sealedEpoch{epoch: r.uint(), key: r.bytes(), expires: r.time()}
+		epochs[i].window.Highest = r.uint()
+		epochs[i].window.Reserved = r.uint()
+		epochs[i].window.Blocks = r.blocks()
+	}
+	if r.err != nil || len(r.buf) != 0 {
+		return nil, ErrSealedSession
+	}
+
+	var signer *SignatureCredential
+	if signerScheme != "" {
+		if signer = cfg.Signers[signerScheme]; signer == nil {
+			return nil, fmt.Errorf("session: restore: no signing credential for %s", signerScheme)
+		}
+	}
+	var verifier *SignatureVerifier
+	if verifierID != nil {
+		v, err := verifierID.Verifier()
+		if err != nil {
+			return nil, fmt.Errorf("session: restore: peer verifier: %w", err)
+		}
+		verifier = &v
+	}
+
+	keys := scheduler.Keys{
+		SessionID:      sessionID,
+		ExporterSecret: secret.From(exporter),
+		TranscriptHash: transcript,
+		EstablishedAt:  established,
+		NextRotation:   established.Add(interval),
+	}
+	send, recv := secret.From(sendKey), secret.From(epochs[0].key)
+	if role == RoleClient {
+		keys.ClientToServer, keys.ServerToClient = send, recv
+	} else {
+		keys.ServerToClient, keys.ClientToServer = send, recv
+	}
+	defer keys.Wipe()
+
+	s, err := NewSession(SessionConfig{
+		Role:         role,
+		Mode:         mode,
+		AEAD:         aeadName,
+		KEM:          kemName,
+		Keys:         keys,
+		Rotation:     cfg.Rotation,
+		Replay:       cfg.Replay,
+		Policy:       cfg.Policy,
+		Epoch:        epochs[0].epoch,
+		PeerIdentity: peer,
+		Signer:       signer,
+		PeerVerifier: verifier,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.sendSeq = sendSeq
+	s.rotation.Restore(progress)
+	s.recv.window.Restore(epochs[0].window)
+	if len(epochs) == 2 {
+		prev := epochs[1]
+		epoch, err := newRecvEpoch(aeadName, secret.From(prev.key), prev.epoch, cfg.Replay, replayKey(sessionID, role, prev.epoch))
+		if err != nil {
+			_ = s.Release()
+			return nil, err
+		}
+		epoch.window.Restore(prev.window)
+		epoch.expires = prev.expires
+		s.recvPrev = epoch
+	}
+	return s, nil
+}
+
+type sealedEpoch struct {
+	epoch   uint64
+	key     []byte
+	expires time.Time
+	window  replay.Snapshot
+}
+
+// sealedWriter encodes fixed-width integers and length-prefixed byte strings.
+type sealedWriter struct {
+	buf []byte
+}
+
+func (w *sealedWriter) uint(v uint64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+}
+
+func (w *sealedWriter) bytes(b []byte) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *sealedWriter) string(v string) {
+	w.bytes([]byte(v))
+}
+
+func (w *sealedWriter) time(t time.Time) {
+	w.uint(uint64(t.Unix()))
+	w.uint(uint64(t.Nanosecond()))
+}
+
+func (w *sealedWriter) identity(id *PeerIdentity) {
+	if id == nil {
+		w.uint(0)
+		return
+	}
+	w.uint(1)
+	w.string(id.Scheme)
+	w.bytes(id.PublicKey)
+}
+
+// sealedReader decodes what sealedWriter wrote. The first short read sets err, after
+// which every read returns a zero value. Byte strings alias buf.
+type sealedReader struct {
+	buf []byte
+	err error
+}
+
+func (r *sealedReader) next(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.buf)) {
+		r.err = ErrSealedSession
+		return nil
+	}
+	out := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return out
+}
+
+func (r *sealedReader) uint() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *sealedReader) bytes() []byte {
+	n := r.next(4)
+	if n == nil {
+		return nil
+	}
+	return r.next(uint64(binary.BigEndian.Uint32(n)))
+}
+
+func (r *sealedReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *sealedReader) time() time.Time {
+	sec, nsec := r.uint(), r.uint()
+	return time.Unix(int64(sec), int64(nsec)).UTC()
+}
+
+func (r *sealedReader) identity() *PeerIdentity {
+	if r.uint() == 0 {
+		return nil
+	}
+	return &PeerIdentity{Scheme: r.string(), PublicKey: append([]byte(nil), r.bytes()...)}
+}
+
+func (r *sealedReader) blocks() []uint64 {
+	n := r.uint()
+	if n > uint64(len(r.buf))/8 {
+		r.err = ErrSealedSession
+		return nil
+	}
+	out := make([]uint64, n)
+	for i := range out {
+		out[i] = r.uint()
+	}
+	return out
+}
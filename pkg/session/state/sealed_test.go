@@ -0,0 +1,202 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/example/qsafe/pkg/crypto/sign"
+	"github.com/example/qsafe/pkg/session/replay"
+)
+
+func TestSessionSealedRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	wrappingKey := make([]byte, SealedKeySize)
+	if _, err := rand.Read(wrappingKey); err != nil {
+		t.Fatalf("wrapping key: %v", err)
+	}
+	keys := testKeys(t)
+	scheme := sign.NewMLDSA65()
+	pair, err := scheme.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate signing key: %v", err)
+	}
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch, Signer: &SignatureCredential{Scheme: scheme, KeyPair: pair}})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	identity := &PeerIdentity{Scheme: scheme.Name(), PublicKey: pair.Public}
+	server, err := NewSession(SessionConfig{
+		Role:         RoleServer,
+		Keys:         keys,
+		Epoch:        InitialEpoch,
+		PeerIdentity: identity,
+		PeerVerifier: &SignatureVerifier{Scheme: scheme, PublicKey: pair.Public},
+	})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+
+	// Leave the server holding two receive epochs, with an envelope from the old one
+	// still in flight.
+	old, _, err := client.Encrypt(ctx, []byte("in flight"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	notice, err := client.Rekey()
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if err := server.ApplyRekey(notice); err != nil {
+		t.Fatalf("apply rekey: %v", err)
+	}
+	seen, _, err := client.Encrypt(ctx, []byte("seen"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, _, err := server.Decrypt(ctx, seen); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	reply, _, err := server.Encrypt(ctx, []byte("reply"), nil)
+	if err != nil {
+		t.Fatalf("encrypt reply: %v", err)
+	}
+
+	sealed, err := server.MarshalSealed(wrappingKey)
+	if err != nil {
+		t.Fatalf("marshal sealed: %v", err)
+	}
+	if bytes.Contains(sealed, keys.ClientToServer.Bytes()) || bytes.Contains(sealed, keys.SessionID) {
+		t.Fatal("sealed session exposes key material")
+	}
+	if err := server.Release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	restored, err := RestoreSession(sealed, wrappingKey, RestoreConfig{})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !bytes.Equal(restored.SessionID(), keys.SessionID) {
+		t.Fatal("restored session ID differs")
+	}
+	if peer, ok := restored.PeerIdentity(); !ok || peer.Fingerprint() != identity.Fingerprint() {
+		t.Fatal("restored session lost its peer identity")
+	}
+	if plaintext, _, err := restored.Decrypt(ctx, old); err != nil || string(plaintext) != "in flight" {
+		t.Fatalf("previous epoch after restore: %q, %v", plaintext, err)
+	}
+	if _, _, err := restored.Decrypt(ctx, seen); !errors.Is(err, replay.ErrDuplicate) {
+		t.Fatalf("expected replayed envelope to be refused, got %v", err)
+	}
+
+	// The restored sender skips ahead, so its nonces never repeat the original's.
+	next, _, err := restored.Encrypt(ctx, []byte("after restore"), nil)
+	if err != nil {
+		t.Fatalf("encrypt after restore: %v", err)
+	}
+	if next.Sequence != reply.Sequence+1+sealedSequenceSkip || next.Epoch != reply.Epoch {
+		t.Fatalf("restored sender at sequence %d epoch %d", next.Sequence, next.Epoch)
+	}
+	if plaintext, _, err := client.Decrypt(ctx, next); err != nil || string(plaintext) != "after restore" {
+		t.Fatalf("client decrypt: %q, %v", plaintext, err)
+	}
+
+	// Rekey notices must still be signed by the peer the original verified.
+	notice, err = client.Rekey()
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	unsigned := notice
+	unsigned.Signature = nil
+	if err := restored.ApplyRekey(unsigned); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected unsigned notice to be refused, got %v", err)
+	}
+	if err := restored.ApplyRekey(notice); err != nil {
+		t.Fatalf("apply rekey after restore: %v", err)
+	}
+}
+
+func TestSessionSealedRejectsTampering(t *testing.T) {
+	wrappingKey := make([]byte, SealedKeySize)
+	client, _ := newSessionPair(t, "aes256gcm")
+	sealed, err := client.MarshalSealed(wrappingKey)
+	if err != nil {
+		t.Fatalf("marshal sealed: %v", err)
+	}
+
+	otherKey := bytes.Repeat([]byte{1}, SealedKeySize)
+	if _, err := RestoreSession(sealed, otherKey, RestoreConfig{}); !errors.Is(err, ErrSealedSession) {
+		t.Fatalf("wrong key: expected ErrSealedSession, got %v", err)
+	}
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	if _, err := RestoreSession(flipped, wrappingKey, RestoreConfig{}); !errors.Is(err, ErrSealedSession) {
+		t.Fatalf("tampered: expected ErrSealedSession, got %v", err)
+	}
+	if _, err := RestoreSession(sealed[:10], wrappingKey, RestoreConfig{}); !errors.Is(err, ErrSealedSession) {
+		t.Fatalf("truncated: expected ErrSealedSession, got %v", err)
+	}
+	if _, err := client.MarshalSealed(wrappingKey[:16]); err == nil {
+		t.Fatal("expected short wrapping key to be refused")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := client.MarshalSealed(wrappingKey); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("marshal after close: %v", err)
+	}
+}
+
+func TestSessionReleaseKeepsReplayStore(t *testing.T) {
+	ctx := context.Background()
+	wrappingKey := make([]byte, SealedKeySize)
+	keys := testKeys(t)
+	store := replay.NewMemoryStore()
+	cfg := replay.Config{Store: store}
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch, Replay: cfg})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+	env, _, err := client.Encrypt(ctx, []byte("payload"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, _, err := server.Decrypt(ctx, env); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+
+	sealed, err := server.MarshalSealed(wrappingKey)
+	if err != nil {
+		t.Fatalf("marshal sealed: %v", err)
+	}
+	if err := server.Release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("Release left %d marks, want 1", store.Len())
+	}
+	restored, err := RestoreSession(sealed, wrappingKey, RestoreConfig{Replay: cfg})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, _, err := restored.Decrypt(ctx, env); !errors.Is(err, replay.ErrDuplicate) {
+		t.Fatalf("expected replayed envelope to be refused, got %v", err)
+	}
+	// The store still holds the original's reservation, so the restored window picks up
+	// where the original left off rather than skipping past it.
+	next, _, err := client.Encrypt(ctx, []byte("next"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if plaintext, _, err := restored.Decrypt(ctx, next); err != nil || string(plaintext) != "next" {
+		t.Fatalf("next sequence after restore: %q, %v", plaintext, err)
+	}
+}
@@ -6,20 +6,29 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"maps"
 	"sort"
 	"sync"
 	"time"
 
-	"golang.org/x/crypto/chacha20poly1305"
-
 	"github.com/zeebo/blake3"
 
+	"github.com/example/qsafe/pkg/crypto/aead"
 	"github.com/example/qsafe/pkg/crypto/scheduler"
+	"github.com/example/qsafe/pkg/crypto/secret"
 	"github.com/example/qsafe/pkg/session/policy"
 	"github.com/example/qsafe/pkg/session/replay"
 	"github.com/example/qsafe/pkg/session/rotation"
 )
 
+var (
+	// ErrSessionClosed is returned by every Session operation after Close.
+	ErrSessionClosed = errors.New("session: closed")
+	// ErrDecrypt is returned for an envelope that does not authenticate under the
+	// session's keys.
+	ErrDecrypt = errors.New("session: decrypt failed")
+)
+
 // Role identifies the local perspective within a session.
 type Role uint8
 
@@ -59,38 +68,74 @@ type Envelope struct {
 
 // SessionConfig governs session construction.
 type SessionConfig struct {
-	Role     Role
-	Mode     string
-	AEAD     string
+	Role Role
+	Mode string
+	AEAD string
+	// KEM is the suite used for in-session re-handshakes; it defaults to ML-KEM-768.
+	KEM string
+	// Keys is copied; the caller still owns it and should Wipe it once done.
 	Keys     scheduler.Keys
 	Rotation rotation.Config
 	Replay   replay.Config
 	Policy   *policy.Enforcer
 	Epoch    uint64
+	// PeerIdentity is the authenticated client identity, if the handshake verified one.
+	PeerIdentity *PeerIdentity
+	// Signer, if set, signs the RekeyNotices this side issues.
+	Signer *SignatureCredential
+	// PeerVerifier, if set, is the peer's signing key; ApplyRekey then refuses unsigned
+	// notices.
+	PeerVerifier *SignatureVerifier
 }
 
-// Session orchestrates encrypt/decrypt paths with replay and rotation enforcement.
+// Session orchestrates encrypt/decrypt paths with replay and rotation enforcement. Its
+// keys live until Close wipes them; keys replaced by a rekey or re-handshake are wiped
+// as soon as nothing can use them.
 type Session struct {
 	role      Role
 	mode      string
 	aeadName  string
 	sessionID []byte
 
+	sendMu     sync.Mutex
+	sendKey    *secret.Buffer
 	sendCipher cipherAEAD
-	recvCipher cipherAEAD
+	sendSeq    uint64
+	sendNonce  *nonceSource
+	sendAAD    aadCache
+	rotation   *rotation.Manager
+
+	// recv holds the current receive epoch and recvPrev the one it replaced, kept until
+	// its grace period ends.
+	recvMu    sync.Mutex
+	recv      *recvEpoch
+	recvPrev  *recvEpoch
+	recvNonce *nonceSource
+	recvAAD   aadCache
+	replayCfg replay.Config
+
+	signer       *SignatureCredential
+	peerVerifier *SignatureVerifier
 
-	sendMu   sync.Mutex
-	sendSeq  uint64
-	rotation *rotation.Manager
+	policy *policy.Enforcer
 
-	recvWindow *replay.Window
+	peer *PeerIdentity
 
-	policy *policy.Enforcer
+	kem string
+
+	// chainMu guards the exporter secret and the transcript hash that re-handshakes
+	// chain to, both replaced by installKeys, and the re-handshake this side started.
+	chainMu    sync.Mutex
+	exporter   *secret.Buffer
+	transcript []byte
+	pending    *PendingRehandshake
 
 	established time.Time
 }
 
 type cipherAEAD interface {
+	NonceSize() int
+	Overhead() int
 	Seal(dst, nonce, plaintext, additionalData []byte) []byte
 	Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error)
 }
@@ -106,6 +151,9 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 	if cfg.AEAD == "" {
 		cfg.AEAD = "xchacha20poly1305"
 	}
+	if cfg.KEM == "" {
+		cfg.KEM = "ML-KEM-768"
+	}
 
 	if cfg.Policy != nil {
 		if err := cfg.Policy.Validate(policy.Parameters{
@@ -113,17 +161,27 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 			AEAD:           cfg.AEAD,
 			RotationWindow: cfg.Keys.NextRotation.Sub(cfg.Keys.EstablishedAt),
 		}); err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: %w", ErrPolicyDenied, err)
 		}
 	}
 
 	sendKey, recvKey := directionalKeys(cfg.Role, cfg.Keys)
-	sendCipher, recvCipher, err := buildCiphers(cfg.AEAD, sendKey, recvKey)
+	sendCipher, err := newCipher(cfg.AEAD, sendKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	sendNonce, err := newNonceSource(cfg.Keys.SessionID, cfg.Role, sendCipher.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	recvNonce, err := newNonceSource(cfg.Keys.SessionID, cfg.Role.peer(), sendCipher.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	recv, err := newRecvEpoch(cfg.AEAD, recvKey.Clone(), cfg.Epoch, cfg.Replay, replayKey(cfg.Keys.SessionID, cfg.Role, cfg.Epoch))
 	if err != nil {
 		return nil, err
 	}
-
-	window := replay.New(cfg.Replay)
 
 	interval := cfg.Keys.NextRotation.Sub(cfg.Keys.EstablishedAt)
 	if interval <= 0 {
@@ -139,67 +197,114 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 
 	manager := rotation.New(rotationCfg, cfg.Keys.EstablishedAt, cfg.Epoch)
 
+	var peer *PeerIdentity
+	if cfg.PeerIdentity != nil {
+		copied := *cfg.PeerIdentity
+		copied.PublicKey = append([]byte(nil), copied.PublicKey...)
+		peer = &copied
+	}
+
 	return &Session{
-		role:        cfg.Role,
-		mode:        cfg.Mode,
-		aeadName:    cfg.AEAD,
-		sessionID:   append([]byte(nil), cfg.Keys.SessionID...),
-		sendCipher:  sendCipher,
-		recvCipher:  recvCipher,
-		rotation:    manager,
-		recvWindow:  window,
-		policy:      cfg.Policy,
-		established: cfg.Keys.EstablishedAt,
+		role:         cfg.Role,
+		mode:         cfg.Mode,
+		aeadName:     cfg.AEAD,
+		sessionID:    append([]byte(nil), cfg.Keys.SessionID...),
+		sendKey:      sendKey.Clone(),
+		sendCipher:   sendCipher,
+		sendNonce:    sendNonce,
+		rotation:     manager,
+		recv:         recv,
+		recvNonce:    recvNonce,
+		replayCfg:    cfg.Replay,
+		signer:       cfg.Signer,
+		peerVerifier: cfg.PeerVerifier,
+		policy:       cfg.Policy,
+		peer:         peer,
+		kem:          cfg.KEM,
+		exporter:     cfg.Keys.ExporterSecret.Clone(),
+		transcript:   append([]byte(nil), cfg.Keys.TranscriptHash...),
+		established:  cfg.Keys.EstablishedAt,
 	}, nil
 }
 
-// Encrypt protects the payload, returning an envelope and whether rotation should be triggered.
+// Encrypt protects the payload, returning an envelope and whether rotation should be
+// triggered. Once the epoch's hard packet limit is reached it returns ErrRekeyRequired
+// until Rekey is called.
 func (s *Session) Encrypt(ctx context.Context, plaintext []byte, metadata map[string]string) (Envelope, bool, error) {
-	if plaintext == nil {
-		plaintext = []byte{}
-	}
-	metaCopy := copyMap(metadata)
-	aad := metadataAAD(metaCopy)
+	return s.SealTo(ctx, nil, plaintext, copyMap(metadata))
+}
 
+// SealTo is Encrypt for callers that reuse buffers. It appends the nonce and then the
+// ciphertext to dst, and the returned envelope's Nonce and Ciphertext alias that space;
+// its Metadata is metadata itself rather than a copy. With enough capacity in dst and
+// metadata repeated from the previous message, sealing does not allocate.
+func (s *Session) SealTo(ctx context.Context, dst, plaintext []byte, metadata map[string]string) (Envelope, bool, error) {
 	s.sendMu.Lock()
 	defer s.sendMu.Unlock()
 
+	if s.sendCipher == nil {
+		return Envelope{}, false, ErrSessionClosed
+	}
+	if s.rotation.Exhausted() {
+		return Envelope{}, true, fmt.Errorf("%w: epoch %d", ErrRekeyRequired, s.rotation.NextEpoch())
+	}
+
 	s.sendSeq++
 	seq := s.sendSeq
 
-	nonce := computeNonce(s.sessionID, seq, s.role)
+	nonce := s.sendNonce.next(seq)
 	shouldRotate := s.rotation.Record(time.Now().UTC())
 
-	ciphertext := s.sendCipher.Seal(nil, nonce[:], plaintext, aad)
+	start, split := len(dst), len(dst)+len(nonce)
+	out := s.sendCipher.Seal(append(dst, nonce...), nonce, plaintext, s.sendAAD.lookup(metadata))
 
 	env := Envelope{
-		Ciphertext: ciphertext,
-		Nonce:      append([]byte(nil), nonce[:]...),
+		Ciphertext: out[split:],
+		Nonce:      out[start:split:split],
 		Sequence:   seq,
 		Epoch:      s.rotation.NextEpoch(),
-		Metadata:   metaCopy,
+		Metadata:   metadata,
 	}
 	return env, shouldRotate, nil
 }
 
 // Decrypt authenticates and opens an envelope, returning plaintext and rotation hint.
+// Envelopes from the previous epoch are accepted until its grace period ends; any other
+// epoch fails with ErrUnknownEpoch.
 func (s *Session) Decrypt(ctx context.Context, env Envelope) ([]byte, bool, error) {
+	return s.OpenTo(ctx, nil, env)
+}
+
+// OpenTo is Decrypt for callers that reuse buffers: it appends the plaintext to dst and
+// returns the extended slice. With enough capacity in dst and metadata repeated from the
+// previous envelope, opening does not allocate.
+func (s *Session) OpenTo(ctx context.Context, dst []byte, env Envelope) ([]byte, bool, error) {
 	if env.Sequence == 0 {
 		return nil, false, errors.New("session: sequence must start at 1")
 	}
-	if err := s.recvWindow.Accept(env.Sequence); err != nil {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	epoch, err := s.recvEpochLocked(env.Epoch, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	// Check before opening and record only after, so a forged envelope cannot move the
+	// window or its persisted mark.
+	if err := epoch.window.Check(env.Sequence); err != nil {
 		return nil, false, err
 	}
 
-	expectedNonce := computeNonce(s.sessionID, env.Sequence, s.role.peer())
-	if len(env.Nonce) > 0 && !bytes.Equal(env.Nonce, expectedNonce[:]) {
-		return nil, false, errors.New("session: nonce mismatch")
+	expectedNonce := s.recvNonce.next(env.Sequence)
+	if len(env.Nonce) > 0 && !bytes.Equal(env.Nonce, expectedNonce) {
+		return nil, false, fmt.Errorf("%w: nonce mismatch", ErrDecrypt)
 	}
 
-	aad := metadataAAD(env.Metadata)
-	plaintext, err := s.recvCipher.Open(nil, expectedNonce[:], env.Ciphertext, aad)
+	plaintext, err := epoch.cipher.Open(dst, expectedNonce, env.Ciphertext, s.recvAAD.lookup(env.Metadata))
 	if err != nil {
-		return nil, false, fmt.Errorf("session: decrypt: %w", err)
+		return nil, false, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	if err := epoch.window.AcceptContext(ctx, env.Sequence); err != nil {
+		return nil, false, err
 	}
 
 	rotate := s.rotation.ShouldRotate(time.Now().UTC())
@@ -211,12 +316,82 @@ func (s *Session) SessionID() []byte {
 	return append([]byte(nil), s.sessionID...)
 }
 
+// PeerIdentity returns the authenticated client identity, if the session has one.
+func (s *Session) PeerIdentity() (PeerIdentity, bool) {
+	if s.peer == nil {
+		return PeerIdentity{}, false
+	}
+	return *s.peer, true
+}
+
+// ReplayStats returns the replay window counters for the current receive epoch; they
+// start afresh with each epoch.
+func (s *Session) ReplayStats() replay.Stats {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if s.recv == nil {
+		return replay.Stats{}
+	}
+	return s.recv.window.Stats()
+}
+
 // EstablishedAt returns the handshake completion timestamp.
 func (s *Session) EstablishedAt() time.Time {
 	return s.established
 }
 
-func directionalKeys(role Role, keys scheduler.Keys) (send []byte, recv []byte) {
+// Close wipes the session's traffic keys and exporter secret and forgets its persisted
+// replay windows; every later operation fails with ErrSessionClosed. The AEAD
+// implementations keep their own expanded copies of the keys, which become unreachable
+// here but are not zeroed. Closing twice is harmless.
+func (s *Session) Close() error {
+	s.close(true)
+	return nil
+}
+
+// Release wipes the session's keys like Close but leaves its replay windows in the
+// store, for a session exported with MarshalSealed that RestoreSession will pick up.
+func (s *Session) Release() error {
+	s.close(false)
+	return nil
+}
+
+func (s *Session) close(forget bool) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	for _, buf := range s.secretsLocked() {
+		buf.Wipe()
+	}
+	if forget {
+		for _, epoch := range []*recvEpoch{s.recv, s.recvPrev} {
+			if epoch != nil {
+				epoch.discard()
+			}
+		}
+	}
+	s.sendKey, s.sendCipher = nil, nil
+	s.recv, s.recvPrev = nil, nil
+	s.exporter = nil
+}
+
+// secretsLocked lists every buffer the session owns. The caller holds all three locks;
+// tests use it to check that Close leaves nothing behind.
+func (s *Session) secretsLocked() []*secret.Buffer {
+	out := []*secret.Buffer{s.sendKey, s.exporter}
+	for _, epoch := range []*recvEpoch{s.recv, s.recvPrev} {
+		if epoch != nil {
+			out = append(out, epoch.key)
+		}
+	}
+	return out
+}
+
+func directionalKeys(role Role, keys scheduler.Keys) (send, recv *secret.Buffer) {
 	switch role {
 	case RoleClient:
 		return keys.ClientToServer, keys.ServerToClient
@@ -225,21 +400,22 @@ func directionalKeys(role Role, keys scheduler.Keys) (send []byte, recv []byte)
 	}
 }
 
-func buildCiphers(name string, sendKey, recvKey []byte) (cipherAEAD, cipherAEAD, error) {
-	switch name {
-	case "xchacha20poly1305":
-		send, err := chacha20poly1305.NewX(sendKey)
-		if err != nil {
-			return nil, nil, fmt.Errorf("session: new send cipher: %w", err)
-		}
-		recv, err := chacha20poly1305.NewX(recvKey)
-		if err != nil {
-			return nil, nil, fmt.Errorf("session: new recv cipher: %w", err)
-		}
-		return send, recv, nil
-	default:
-		return nil, nil, fmt.Errorf("session: unsupported AEAD %q", name)
+// SupportedAEADs lists the AEAD suites NewSession can instantiate, most preferred first.
+// AES-GCM-SIV tolerates nonce reuse; AES-256-GCM is the choice for FIPS deployments.
+func SupportedAEADs() []string {
+	return []string{"xchacha20poly1305", "aes256gcmsiv", "aes256gcm", "chacha20poly1305"}
+}
+
+func newCipher(name string, key []byte) (cipherAEAD, error) {
+	suite, err := aead.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("session: unsupported AEAD %q", name)
+	}
+	c, err := suite.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("session: new cipher: %w", err)
 	}
+	return c, nil
 }
 
 func metadataAAD(metadata map[string]string) []byte {
@@ -274,20 +450,79 @@ func copyMap(in map[string]string) map[string]string {
 	return out
 }
 
-func computeNonce(sessionID []byte, seq uint64, role Role) [24]byte {
-	var nonce [24]byte
-	var seqBuf [8]byte
-	binary.BigEndian.PutUint64(seqBuf[:], seq)
+// aadCache holds the AAD for the most recently seen metadata, since consecutive messages
+// usually carry the same headers. Each direction has its own, guarded by its mutex.
+type aadCache struct {
+	metadata map[string]string
+	aad      []byte
+}
+
+func (c *aadCache) lookup(metadata map[string]string) []byte {
+	if c.aad != nil && maps.Equal(c.metadata, metadata) {
+		return c.aad
+	}
+	c.metadata = copyMap(metadata)
+	c.aad = metadataAAD(c.metadata)
+	return c.aad
+}
 
+// nonceSource derives the nonces for one sending direction. A 24-byte nonce is a keyed
+// BLAKE3 hash of the sequence number and role, safe in XChaCha20's random-nonce space.
+// The 12-byte nonces of the other suites are too short to hash into, so they follow
+// TLS 1.3: a per-direction base XORed with the big-endian sequence number, unique for
+// every seq. The keyed hasher and the base depend only on the session ID and role, so
+// they are set up once per session rather than per message.
+type nonceSource struct {
+	size   int
+	hasher *blake3.Hasher
+	input  [9]byte
+	out    [32]byte
+	base   [12]byte
+}
+
+func newNonceSource(sessionID []byte, role Role, size int) (*nonceSource, error) {
 	hasher, err := blake3.NewKeyed(sessionID)
 	if err != nil {
-		panic("blake3: invalid session key length")
+		return nil, fmt.Errorf("session: nonce key: %w", err)
+	}
+	n := &nonceSource{size: size, hasher: hasher}
+	n.input[8] = byte(role)
+	switch size {
+	case 24:
+	case len(n.base):
+		_, _ = hasher.Write([]byte("qsafe-nonce-base"))
+		_, _ = hasher.Write([]byte{byte(role)})
+		copy(n.base[:], hasher.Sum(n.out[:0]))
+	default:
+		return nil, fmt.Errorf("session: unsupported nonce size %d", size)
 	}
-	_, _ = hasher.Write(seqBuf[:])
-	_, _ = hasher.Write([]byte{byte(role)})
-	digest := hasher.Digest()
-	if _, err := digest.Read(nonce[:]); err != nil {
-		panic("blake3: nonce read failed")
+	return n, nil
+}
+
+// next returns the nonce for seq. The slice aliases the source's scratch space and is
+// only valid until the next call.
+func (n *nonceSource) next(seq uint64) []byte {
+	if n.size == 24 {
+		binary.BigEndian.PutUint64(n.input[:8], seq)
+		n.hasher.Reset()
+		_, _ = n.hasher.Write(n.input[:])
+		return n.hasher.Sum(n.out[:0])[:24]
+	}
+	nonce := n.out[:len(n.base)]
+	copy(nonce, n.base[:])
+	var seqBuf [8]byte
+	binary.BigEndian.PutUint64(seqBuf[:], seq)
+	for i := range seqBuf {
+		nonce[len(nonce)-8+i] ^= seqBuf[i]
 	}
 	return nonce
 }
+
+// computeNonce derives a single nonce outside a session, for early data.
+func computeNonce(sessionID []byte, seq uint64, role Role, size int) []byte {
+	n, err := newNonceSource(sessionID, role, size)
+	if err != nil {
+		panic(err)
+	}
+	return append([]byte(nil), n.next(seq)...)
+}
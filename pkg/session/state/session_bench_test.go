@@ -0,0 +1,113 @@
+package state
+
+import (
+	"context"
+	"testing"
+)
+
+// benchPayloadSize is a typical frame on the gateway's message path.
+const benchPayloadSize = 1024
+
+var benchMetadata = map[string]string{"content-type": "application/octet-stream", "stream": "7"}
+
+func newSessionPair(tb testing.TB, aeadName string) (client, server *Session) {
+	tb.Helper()
+	keys := testKeys(tb)
+	client, err := NewSession(SessionConfig{Role: RoleClient, AEAD: aeadName, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		tb.Fatalf("%s: client session: %v", aeadName, err)
+	}
+	server, err = NewSession(SessionConfig{Role: RoleServer, AEAD: aeadName, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		tb.Fatalf("%s: server session: %v", aeadName, err)
+	}
+	return client, server
+}
+
+func BenchmarkSessionEncryptDecrypt(b *testing.B) {
+	ctx := context.Background()
+	plaintext := make([]byte, benchPayloadSize)
+	for _, name := range SupportedAEADs() {
+		b.Run(name, func(b *testing.B) {
+			client, server := newSessionPair(b, name)
+			b.SetBytes(benchPayloadSize)
+			b.ReportAllocs()
+			for b.Loop() {
+				env, _, err := client.Encrypt(ctx, plaintext, benchMetadata)
+				if err != nil {
+					b.Fatalf("encrypt: %v", err)
+				}
+				if _, _, err := server.Decrypt(ctx, env); err != nil {
+					b.Fatalf("decrypt: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSessionSealTo(b *testing.B) {
+	ctx := context.Background()
+	plaintext := make([]byte, benchPayloadSize)
+	for _, name := range SupportedAEADs() {
+		b.Run(name, func(b *testing.B) {
+			client, _ := newSessionPair(b, name)
+			buf := make([]byte, 0, benchPayloadSize+64)
+			b.SetBytes(benchPayloadSize)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := client.SealTo(ctx, buf[:0], plaintext, benchMetadata); err != nil {
+					b.Fatalf("seal: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSessionSealOpenTo(b *testing.B) {
+	ctx := context.Background()
+	plaintext := make([]byte, benchPayloadSize)
+	for _, name := range SupportedAEADs() {
+		b.Run(name, func(b *testing.B) {
+			client, server := newSessionPair(b, name)
+			sealed := make([]byte, 0, benchPayloadSize+64)
+			opened := make([]byte, 0, benchPayloadSize)
+			b.SetBytes(benchPayloadSize)
+			b.ReportAllocs()
+			for b.Loop() {
+				env, _, err := client.SealTo(ctx, sealed[:0], plaintext, benchMetadata)
+				if err != nil {
+					b.Fatalf("seal: %v", err)
+				}
+				if _, _, err := server.OpenTo(ctx, opened[:0], env); err != nil {
+					b.Fatalf("open: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionSealOpenToAllocs(t *testing.T) {
+	ctx := context.Background()
+	plaintext := make([]byte, benchPayloadSize)
+	for _, name := range SupportedAEADs() {
+		if name == "aes256gcmsiv" {
+			// Every AES-GCM-SIV nonce derives its own AES key schedule.
+			continue
+		}
+		client, server := newSessionPair(t, name)
+		sealed := make([]byte, 0, benchPayloadSize+64)
+		opened := make([]byte, 0, benchPayloadSize)
+		allocs := testing.AllocsPerRun(100, func() {
+			env, _, err := client.SealTo(ctx, sealed[:0], plaintext, benchMetadata)
+			if err != nil {
+				t.Fatalf("%s: seal: %v", name, err)
+			}
+			if _, _, err := server.OpenTo(ctx, opened[:0], env); err != nil {
+				t.Fatalf("%s: open: %v", name, err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per message, want 0", name, allocs)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package state
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -39,9 +41,9 @@ func TestSessionEncryptDecrypt(t *testing.T) {
 		SignatureScheme:  sigSuite,
 		SignatureKeyPair: sigKeys,
 		Capabilities: CapabilitySet{
-			PQKEM:      kemSuite.Name(),
-			PQSigs:     sigSuite.Name(),
-			AEAD:       "xchacha20poly1305",
+			PQKEMs:     []string{kemSuite.Name()},
+			PQSigs:     []string{sigSuite.Name()},
+			AEADs:      []string{"xchacha20poly1305"},
 			Transports: []string{"grpc"},
 		},
 		Scheduler: schedCfg,
@@ -58,9 +60,9 @@ func TestSessionEncryptDecrypt(t *testing.T) {
 		SignatureScheme:    sigSuite,
 		ServerSignatureKey: sigKeys.Public,
 		Capabilities: CapabilitySet{
-			PQKEM:      kemSuite.Name(),
-			PQSigs:     sigSuite.Name(),
-			AEAD:       "xchacha20poly1305",
+			PQKEMs:     []string{kemSuite.Name()},
+			PQSigs:     []string{sigSuite.Name()},
+			AEADs:      []string{"xchacha20poly1305"},
 			Transports: []string{"grpc"},
 		},
 	})
@@ -138,6 +140,12 @@ func TestSessionEncryptDecrypt(t *testing.T) {
 	if string(plaintext) != "hello quantum" {
 		t.Fatalf("unexpected plaintext: %s", plaintext)
 	}
+	if _, _, err := serverSession.Decrypt(ctx, env); !errors.Is(err, replay.ErrDuplicate) {
+		t.Fatalf("expected replayed envelope to be refused, got %v", err)
+	}
+	if stats := serverSession.ReplayStats(); stats.Accepted != 1 || stats.Duplicates != 1 {
+		t.Fatalf("unexpected replay stats %+v", stats)
+	}
 
 	respEnv, _, err := serverSession.Encrypt(ctx, []byte("ack"), nil)
 	if err != nil {
@@ -152,3 +160,208 @@ func TestSessionEncryptDecrypt(t *testing.T) {
 		t.Fatalf("unexpected reply: %s", reply)
 	}
 }
+
+func TestSessionSupportedAEADs(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	for _, name := range SupportedAEADs() {
+		client, err := NewSession(SessionConfig{Role: RoleClient, AEAD: name, Keys: keys, Epoch: InitialEpoch})
+		if err != nil {
+			t.Fatalf("%s: client session: %v", name, err)
+		}
+		server, err := NewSession(SessionConfig{Role: RoleServer, AEAD: name, Keys: keys, Epoch: InitialEpoch})
+		if err != nil {
+			t.Fatalf("%s: server session: %v", name, err)
+		}
+
+		nonces := make(map[string]bool)
+		for i := 0; i < 3; i++ {
+			env, _, err := client.Encrypt(ctx, []byte(name), map[string]string{"i": "x"})
+			if err != nil {
+				t.Fatalf("%s: encrypt: %v", name, err)
+			}
+			if nonces[string(env.Nonce)] {
+				t.Fatalf("%s: nonce repeated at sequence %d", name, env.Sequence)
+			}
+			nonces[string(env.Nonce)] = true
+			plaintext, _, err := server.Decrypt(ctx, env)
+			if err != nil || string(plaintext) != name {
+				t.Fatalf("%s: decrypt: %q, %v", name, plaintext, err)
+			}
+		}
+		// The directions use distinct nonces for the same sequence number.
+		reply, _, err := server.Encrypt(ctx, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: server encrypt: %v", name, err)
+		}
+		if nonces[string(reply.Nonce)] {
+			t.Fatalf("%s: server reused a client nonce", name)
+		}
+	}
+
+	if _, err := NewSession(SessionConfig{Role: RoleClient, AEAD: "aes-gcm", Keys: keys}); err == nil {
+		t.Fatal("expected unknown AEAD to be refused")
+	}
+}
+
+func TestSessionSealToOpenTo(t *testing.T) {
+	ctx := context.Background()
+	client, server := newSessionPair(t, "xchacha20poly1305")
+
+	// SealTo appends after whatever dst already holds.
+	meta := map[string]string{"stream": "1"}
+	sealed := append(make([]byte, 0, 256), "hdr:"...)
+	env, _, err := client.SealTo(ctx, sealed, []byte("first"), meta)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if string(sealed[:4]) != "hdr:" || len(env.Nonce) != 24 || &env.Nonce[0] != &sealed[:5][4] {
+		t.Fatal("sealed envelope does not alias dst after its existing contents")
+	}
+	opened, _, err := server.OpenTo(ctx, []byte("got:"), env)
+	if err != nil || string(opened) != "got:first" {
+		t.Fatalf("open: %q, %v", opened, err)
+	}
+
+	// Mutating the caller's map in place must not reuse the previous AAD.
+	meta["stream"] = "2"
+	env, _, err = client.SealTo(ctx, nil, []byte("second"), meta)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	env.Metadata = map[string]string{"stream": "1"}
+	if _, _, err := server.OpenTo(ctx, nil, env); err == nil {
+		t.Fatal("expected envelope with substituted metadata to fail")
+	}
+
+	// Encrypt still hands out metadata the caller cannot disturb.
+	plain, _, err := client.Encrypt(ctx, []byte("third"), meta)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	meta["stream"] = "3"
+	if plaintext, _, err := server.Decrypt(ctx, plain); err != nil || string(plaintext) != "third" {
+		t.Fatalf("decrypt: %q, %v", plaintext, err)
+	}
+}
+
+func TestSessionCloseWipesSecrets(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+
+	// A rekey wipes the key it replaces on the sending side and leaves the receiving
+	// side holding two epochs.
+	oldSend := client.sendKey
+	notice, err := client.Rekey()
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if !oldSend.Wiped() {
+		t.Fatal("previous send key survived the rekey")
+	}
+	if err := server.ApplyRekey(notice); err != nil {
+		t.Fatalf("apply rekey: %v", err)
+	}
+
+	for name, s := range map[string]*Session{"client": client, "server": server} {
+		held := s.secretsLocked()
+		raw := make([][]byte, len(held))
+		for i, buf := range held {
+			raw[i] = buf.Bytes()
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("%s: close: %v", name, err)
+		}
+		for i, buf := range held {
+			if !buf.Wiped() || !bytes.Equal(raw[i], make([]byte, len(raw[i]))) {
+				t.Fatalf("%s: secret %d not wiped by Close", name, i)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("%s: second close: %v", name, err)
+		}
+	}
+	if keys.ClientToServer.Wiped() || keys.ExporterSecret.Wiped() {
+		t.Fatal("Close wiped the caller's keys")
+	}
+
+	if _, _, err := client.Encrypt(ctx, []byte("late"), nil); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("encrypt after close: %v", err)
+	}
+	if _, _, err := server.Decrypt(ctx, Envelope{Sequence: 1, Epoch: InitialEpoch}); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("decrypt after close: %v", err)
+	}
+	if _, err := client.Rekey(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("rekey after close: %v", err)
+	}
+	if _, err := server.ChannelBinding(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("export after close: %v", err)
+	}
+	if _, _, err := client.Rehandshake(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("rehandshake after close: %v", err)
+	}
+}
+
+func TestSessionReplayStore(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	store := replay.NewMemoryStore()
+	cfg := replay.Config{Depth: 64, Store: store, Checkpoint: 8}
+	client, err := NewSession(SessionConfig{Role: RoleClient, Keys: keys, Epoch: InitialEpoch})
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+	server, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch, Replay: cfg})
+	if err != nil {
+		t.Fatalf("server session: %v", err)
+	}
+
+	var envs []Envelope
+	for range 3 {
+		env, _, err := client.Encrypt(ctx, []byte("payload"), nil)
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		envs = append(envs, env)
+	}
+
+	// A forged envelope fails authentication without consuming its sequence.
+	forged := envs[0]
+	forged.Ciphertext = append([]byte(nil), forged.Ciphertext...)
+	forged.Ciphertext[0] ^= 1
+	if _, _, err := server.Decrypt(ctx, forged); err == nil {
+		t.Fatal("expected forged envelope to fail")
+	}
+	for _, env := range envs[:2] {
+		if _, _, err := server.Decrypt(ctx, env); err != nil {
+			t.Fatalf("decrypt %d: %v", env.Sequence, err)
+		}
+	}
+
+	// A session rebuilt from the same keys and store refuses what the first accepted,
+	// and skips ahead past the reservation rather than trusting envelopes in it.
+	rebuilt, err := NewSession(SessionConfig{Role: RoleServer, Keys: keys, Epoch: InitialEpoch, Replay: cfg})
+	if err != nil {
+		t.Fatalf("rebuilt session: %v", err)
+	}
+	for _, env := range envs {
+		if _, _, err := rebuilt.Decrypt(ctx, env); !errors.Is(err, replay.ErrDuplicate) {
+			t.Fatalf("rebuilt session: sequence %d: expected duplicate, got %v", env.Sequence, err)
+		}
+	}
+
+	if err := rebuilt.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("Close left %d marks in the store", store.Len())
+	}
+}
@@ -0,0 +1,310 @@
+package state
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultStreamChunkSize is the plaintext carried by each stream envelope unless
+// StreamConfig says otherwise.
+const DefaultStreamChunkSize = 64 << 10
+
+// Metadata keys reserved for streams. Every chunk carries the stream ID, its index and
+// whether it is the last one, and metadata is bound into the AEAD's additional data, so
+// a reader detects chunks that are dropped, reordered, spliced in from another stream
+// or appended after the end (the STREAM construction of Hoang et al.).
+const (
+	streamIDKey    = "qsafe-stream"
+	streamChunkKey = "qsafe-chunk"
+	streamFinalKey = "qsafe-final"
+)
+
+var (
+	// ErrStreamTruncated is returned when the envelopes run out before the final chunk.
+	ErrStreamTruncated = errors.New("session: stream truncated")
+	// ErrStreamOrder is returned for a chunk that is not the next one of the stream.
+	ErrStreamOrder = errors.New("session: stream chunk out of order")
+	// ErrStreamExtended is returned when envelopes follow the final chunk.
+	ErrStreamExtended = errors.New("session: data after final stream chunk")
+	// ErrStreamChunkTooLarge is returned for a chunk larger than the reader accepts.
+	ErrStreamChunkTooLarge = errors.New("session: stream chunk too large")
+)
+
+// StreamConfig governs a StreamWriter or StreamReader.
+type StreamConfig struct {
+	// ChunkSize is the plaintext carried per envelope; it defaults to
+	// DefaultStreamChunkSize. A reader refuses chunks larger than its ChunkSize, so it
+	// must be at least the writer's.
+	ChunkSize int
+	// Metadata travels with the first chunk and is returned by StreamReader.Metadata.
+	// Readers ignore it.
+	Metadata map[string]string
+}
+
+// StreamWriter seals everything written to it as a sequence of envelopes, handing each
+// to a sink. A full chunk is held back until more data arrives, so that Close can mark
+// the last chunk final; an empty stream is a single empty final chunk.
+type StreamWriter struct {
+	ctx     context.Context
+	session *Session
+	sink    func(Envelope) error
+
+	id     string
+	meta   map[string]string
+	chunk  uint64
+	buf    []byte
+	sealed []byte
+	rotate bool
+	closed bool
+	err    error
+}
+
+// NewStreamWriter starts a stream under a fresh random ID. sink receives each sealed
+// envelope in order; the envelope's buffers are reused once sink returns, so it must
+// send or copy them rather than keep them. The session's hard packet limit applies to
+// chunks as to any other envelope, so a caller that rekeys should do so between streams.
+func (s *Session) NewStreamWriter(ctx context.Context, sink func(Envelope) error, cfg StreamConfig) (*StreamWriter, error) {
+	if sink == nil {
+		return nil, errors.New("session: stream sink required")
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultStreamChunkSize
+	}
+	for _, key := range []string{streamIDKey, streamChunkKey, streamFinalKey} {
+		if _, ok := cfg.Metadata[key]; ok {
+			return nil, fmt.Errorf("session: stream metadata key %q is reserved", key)
+		}
+	}
+	id, err := randomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamWriter{
+		ctx:     ctx,
+		session: s,
+		sink:    sink,
+		id:      hex.EncodeToString(id),
+		meta:    copyMap(cfg.Metadata),
+		buf:     make([]byte, 0, cfg.ChunkSize),
+		sealed:  make([]byte, 0, cfg.ChunkSize+64),
+	}, nil
+}
+
+// ID returns the stream identifier carried by every chunk.
+func (w *StreamWriter) ID() string {
+	return w.id
+}
+
+// RotateSuggested reports whether sealing any chunk so far produced a rotation hint.
+func (w *StreamWriter) RotateSuggested() bool {
+	return w.rotate
+}
+
+// Write buffers p, sealing and emitting every chunk that fills up before the next one
+// starts.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n := 0
+	for len(p) > 0 {
+		if w.err != nil {
+			return n, w.err
+		}
+		if len(w.buf) == cap(w.buf) {
+			w.flush(false)
+			continue
+		}
+		k := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+k]
+		n += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Close seals the remaining data as the final chunk. The stream is only complete once
+// Close returns nil.
+func (w *StreamWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err == nil {
+		w.flush(true)
+	}
+	return w.err
+}
+
+func (w *StreamWriter) flush(final bool) {
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return
+	}
+	meta := make(map[string]string, len(w.meta)+3)
+	if w.chunk == 0 {
+		for k, v := range w.meta {
+			meta[k] = v
+		}
+	}
+	meta[streamIDKey] = w.id
+	meta[streamChunkKey] = strconv.FormatUint(w.chunk, 10)
+	meta[streamFinalKey] = "0"
+	if final {
+		meta[streamFinalKey] = "1"
+	}
+
+	env, rotate, err := w.session.SealTo(w.ctx, w.sealed[:0], w.buf, meta)
+	if err != nil {
+		w.err = fmt.Errorf("session: stream chunk %d: %w", w.chunk, err)
+		return
+	}
+	w.rotate = w.rotate || rotate
+	if err := w.sink(env); err != nil {
+		w.err = err
+		return
+	}
+	w.chunk++
+	w.buf = w.buf[:0]
+}
+
+// StreamReader opens the envelopes of one stream and reads back the plaintext. It
+// returns io.EOF only after the final chunk has been authenticated and the source has
+// confirmed there is nothing after it.
+type StreamReader struct {
+	ctx     context.Context
+	session *Session
+	source  func() (Envelope, error)
+
+	id     string
+	meta   map[string]string
+	next   uint64
+	limit  int
+	buf    []byte
+	off    int
+	final  bool
+	rotate bool
+	err    error
+}
+
+// NewStreamReader opens the first chunk from source, so ID and Metadata are available
+// straight away. source returns the stream's envelopes in order and then io.EOF; it must
+// carry nothing else, since anything after the final chunk is treated as an extension.
+// Chunks over cfg.ChunkSize fail with ErrStreamChunkTooLarge before being opened.
+func (s *Session) NewStreamReader(ctx context.Context, source func() (Envelope, error), cfg StreamConfig) (*StreamReader, error) {
+	if source == nil {
+		return nil, errors.New("session: stream source required")
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultStreamChunkSize
+	}
+	r := &StreamReader{ctx: ctx, session: s, source: source, limit: cfg.ChunkSize + s.overhead()}
+	if err := r.advance(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ID returns the stream identifier chosen by the writer.
+func (r *StreamReader) ID() string {
+	return r.id
+}
+
+// Metadata returns the metadata the writer attached to the stream.
+func (r *StreamReader) Metadata() map[string]string {
+	return copyMap(r.meta)
+}
+
+// RotateSuggested reports whether opening any chunk so far produced a rotation hint.
+func (r *StreamReader) RotateSuggested() bool {
+	return r.rotate
+}
+
+// Read returns plaintext from authenticated chunks. Any failure, including
+// ErrStreamTruncated, ErrStreamOrder and ErrStreamExtended, is permanent.
+func (r *StreamReader) Read(p []byte) (int, error) {
+	for r.off == len(r.buf) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.final {
+			return 0, io.EOF
+		}
+		r.err = r.advance()
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// advance opens the next chunk into buf and checks its place in the stream.
+func (r *StreamReader) advance() error {
+	env, err := r.source()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w after %d chunks", ErrStreamTruncated, r.next)
+	}
+	if err != nil {
+		return err
+	}
+	if len(env.Ciphertext) > r.limit {
+		return fmt.Errorf("%w: chunk %d seals %d bytes", ErrStreamChunkTooLarge, r.next, len(env.Ciphertext))
+	}
+	plaintext, rotate, err := r.session.OpenTo(r.ctx, r.buf[:0], env)
+	if err != nil {
+		return fmt.Errorf("session: stream chunk %d: %w", r.next, err)
+	}
+	// Nothing from the chunk is readable until its place in the stream checks out.
+	r.buf, r.off = plaintext[:0], 0
+	r.rotate = r.rotate || rotate
+
+	id := env.Metadata[streamIDKey]
+	chunk, err := strconv.ParseUint(env.Metadata[streamChunkKey], 10, 64)
+	if err != nil || id == "" {
+		return fmt.Errorf("%w: envelope is not a stream chunk", ErrStreamOrder)
+	}
+	if r.next == 0 {
+		r.id = id
+		r.meta = copyMap(env.Metadata)
+		delete(r.meta, streamIDKey)
+		delete(r.meta, streamChunkKey)
+		delete(r.meta, streamFinalKey)
+	}
+	if id != r.id {
+		return fmt.Errorf("%w: chunk of stream %s inside stream %s", ErrStreamOrder, id, r.id)
+	}
+	if chunk != r.next {
+		return fmt.Errorf("%w: got chunk %d, want %d", ErrStreamOrder, chunk, r.next)
+	}
+	r.next++
+
+	switch env.Metadata[streamFinalKey] {
+	case "0":
+		r.buf = plaintext
+		return nil
+	case "1":
+	default:
+		return fmt.Errorf("%w: chunk %d has no final flag", ErrStreamOrder, chunk)
+	}
+	if _, err := r.source(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = ErrStreamExtended
+		}
+		return err
+	}
+	r.buf, r.final = plaintext, true
+	return nil
+}
+
+// overhead returns how much longer the session's AEAD makes a sealed plaintext.
+func (s *Session) overhead() int {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.sendCipher == nil {
+		return 0
+	}
+	return s.sendCipher.Overhead()
+}
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, size := range []int{0, 1, 64, 100, 1000} {
+		client, server := newSessionPair(t, "aes256gcm")
+		data := bytes.Repeat([]byte("0123456789"), size/10)
+		data = append(data, make([]byte, size%10)...)
+
+		envs := sealStream(t, client, data, 32, map[string]string{"name": "report.csv"})
+		if want := max(1, (size+31)/32); len(envs) != want {
+			t.Fatalf("size %d: %d chunks, want %d", size, len(envs), want)
+		}
+		reader, err := server.NewStreamReader(ctx, envelopeSource(envs), StreamConfig{ChunkSize: 32})
+		if err != nil {
+			t.Fatalf("size %d: open stream: %v", size, err)
+		}
+		got, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("size %d: read %d bytes, %v", size, len(got), err)
+		}
+		if reader.Metadata()["name"] != "report.csv" || len(reader.Metadata()) != 1 {
+			t.Fatalf("size %d: unexpected metadata %v", size, reader.Metadata())
+		}
+	}
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("x"), 100)
+
+	cases := map[string]struct {
+		edit func(envs, other []Envelope) []Envelope
+		want error
+	}{
+		"truncated": {
+			edit: func(envs, _ []Envelope) []Envelope { return envs[:len(envs)-1] },
+			want: ErrStreamTruncated,
+		},
+		"head dropped": {
+			edit: func(envs, _ []Envelope) []Envelope { return envs[1:] },
+			want: ErrStreamOrder,
+		},
+		"reordered": {
+			edit: func(envs, _ []Envelope) []Envelope {
+				envs[1], envs[2] = envs[2], envs[1]
+				return envs
+			},
+			want: ErrStreamOrder,
+		},
+		"spliced": {
+			edit: func(envs, other []Envelope) []Envelope {
+				envs[1] = other[1]
+				return envs
+			},
+			want: ErrStreamOrder,
+		},
+		"extended": {
+			edit: func(envs, other []Envelope) []Envelope { return append(envs, other[0]) },
+			want: ErrStreamExtended,
+		},
+	}
+	for name, tc := range cases {
+		client, server := newSessionPair(t, "xchacha20poly1305")
+		envs := sealStream(t, client, data, 32, nil)
+		other := sealStream(t, client, data, 32, nil)
+
+		reader, err := server.NewStreamReader(ctx, envelopeSource(tc.edit(envs, other)), StreamConfig{ChunkSize: 32})
+		if err == nil {
+			_, err = io.ReadAll(reader)
+		}
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestStreamReaderChunkLimit(t *testing.T) {
+	ctx := context.Background()
+	client, server := newSessionPair(t, "xchacha20poly1305")
+	envs := sealStream(t, client, bytes.Repeat([]byte("x"), 100), 64, nil)
+
+	if _, err := server.NewStreamReader(ctx, envelopeSource(envs), StreamConfig{ChunkSize: 32}); !errors.Is(err, ErrStreamChunkTooLarge) {
+		t.Fatalf("expected a chunk over the limit to be refused, got %v", err)
+	}
+	// The refused chunk was never opened, so a reader with room for it still can.
+	reader, err := server.NewStreamReader(ctx, envelopeSource(envs), StreamConfig{ChunkSize: 64})
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if got, err := io.ReadAll(reader); err != nil || len(got) != 100 {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+}
+
+func TestStreamWriterReservedMetadata(t *testing.T) {
+	client, _ := newSessionPair(t, "xchacha20poly1305")
+	sink := func(Envelope) error { return nil }
+	if _, err := client.NewStreamWriter(context.Background(), sink, StreamConfig{Metadata: map[string]string{streamFinalKey: "1"}}); err == nil {
+		t.Fatal("expected reserved metadata key to be refused")
+	}
+}
+
+// sealStream writes data through a StreamWriter and returns independent copies of the
+// envelopes it emitted.
+func sealStream(t *testing.T, s *Session, data []byte, chunkSize int, meta map[string]string) []Envelope {
+	t.Helper()
+	var envs []Envelope
+	sink := func(env Envelope) error {
+		env.Ciphertext = append([]byte(nil), env.Ciphertext...)
+		env.Nonce = append([]byte(nil), env.Nonce...)
+		envs = append(envs, env)
+		return nil
+	}
+	w, err := s.NewStreamWriter(context.Background(), sink, StreamConfig{ChunkSize: chunkSize, Metadata: meta})
+	if err != nil {
+		t.Fatalf("new stream writer: %v", err)
+	}
+	// Uneven writes exercise chunk boundaries that do not line up with Write calls.
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 7)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("stream write: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("stream close: %v", err)
+	}
+	if _, err := w.Write([]byte("late")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected write after close to fail, got %v", err)
+	}
+	return envs
+}
+
+func envelopeSource(envs []Envelope) func() (Envelope, error) {
+	return func() (Envelope, error) {
+		if len(envs) == 0 {
+			return Envelope{}, io.EOF
+		}
+		env := envs[0]
+		envs = envs[1:]
+		return env, nil
+	}
+}
@@ -0,0 +1,199 @@
+package ticket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/example/qsafe/pkg/session/replay"
+)
+
+var (
+	// ErrInvalid indicates a ticket that is malformed, forged, or sealed under a retired key.
+	ErrInvalid = errors.New("ticket: invalid")
+	// ErrExpired indicates a ticket past its lifetime.
+	ErrExpired = errors.New("ticket: expired")
+	// ErrReused indicates a ticket that has already been redeemed.
+	ErrReused = errors.New("ticket: already redeemed")
+	// ErrCapacity indicates a valid ticket refused because Capacity tickets have already
+	// been redeemed within one lifetime. Forgetting an earlier redemption instead would
+	// let that ticket be used again.
+	ErrCapacity = errors.New("ticket: redemption cache full")
+)
+
+const (
+	keyIDSize = 8
+	idSize    = 16
+	// MaxLifetime caps ticket lifetimes regardless of configuration.
+	MaxLifetime = 24 * time.Hour
+)
+
+// Config controls ticket lifetime and ticket key rotation.
+type Config struct {
+	// Lifetime bounds how long an issued ticket may be redeemed (default 1h, max 24h).
+	Lifetime time.Duration
+	// RotationInterval is how often a fresh sealing key is generated (default Lifetime).
+	// Retired keys are kept only until the tickets they sealed have expired.
+	RotationInterval time.Duration
+	// Capacity bounds the single-use cache of redeemed ticket IDs. Once it is full,
+	// Redeem fails closed with ErrCapacity until the oldest redemptions expire.
+	Capacity int
+}
+
+// Keyring seals resumption tickets under a rotating XChaCha20-Poly1305 key and enforces
+// lifetime and single use on redemption.
+type Keyring struct {
+	mu       sync.Mutex
+	cfg      Config
+	keys     []sealingKey // newest first
+	redeemed *replay.Cache
+	now      func() time.Time
+}
+
+type sealingKey struct {
+	id      [keyIDSize]byte
+	key     []byte
+	created time.Time
+}
+
+// NewKeyring creates a keyring with a freshly generated sealing key.
+func NewKeyring(cfg Config) (*Keyring, error) {
+	if cfg.Lifetime <= 0 {
+		cfg.Lifetime = time.Hour
+	}
+	if cfg.Lifetime > MaxLifetime {
+		return nil, fmt.Errorf("ticket: lifetime %s exceeds maximum %s", cfg.Lifetime, MaxLifetime)
+	}
+	if cfg.RotationInterval <= 0 {
+		cfg.RotationInterval = cfg.Lifetime
+	}
+	k := &Keyring{
+		cfg:      cfg,
+		redeemed: replay.NewCache(replay.CacheConfig{Capacity: cfg.Capacity, TTL: cfg.Lifetime, RejectWhenFull: true}),
+		now:      time.Now,
+	}
+	if err := k.rotateLocked(k.now()); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Lifetime reports the configured ticket lifetime.
+func (k *Keyring) Lifetime() time.Duration {
+	return k.cfg.Lifetime
+}
+
+// Seal wraps payload into an opaque ticket and returns it with its expiry time.
+// Layout: key id || nonce || AEAD(expiry || ticket id || payload).
+func (k *Keyring) Seal(payload []byte) ([]byte, time.Time, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	if now.Sub(k.keys[0].created) >= k.cfg.RotationInterval {
+		if err := k.rotateLocked(now); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	current := k.keys[0]
+
+	expires := now.Add(k.cfg.Lifetime).UTC()
+	plaintext := make([]byte, 8+idSize, 8+idSize+len(payload))
+	binary.BigEndian.PutUint64(plaintext[:8], uint64(expires.Unix()))
+	if _, err := rand.Read(plaintext[8 : 8+idSize]); err != nil {
+		return nil, time.Time{}, fmt.Errorf("ticket: random id: %w", err)
+	}
+	plaintext = append(plaintext, payload...)
+
+	aead, err := chacha20poly1305.NewX(current.key)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("ticket: init cipher: %w", err)
+	}
+	out := make([]byte, keyIDSize+aead.NonceSize(), keyIDSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, current.id[:])
+	if _, err := rand.Read(out[keyIDSize:]); err != nil {
+		return nil, time.Time{}, fmt.Errorf("ticket: random nonce: %w", err)
+	}
+	out = aead.Seal(out, out[keyIDSize:], plaintext, current.id[:])
+	return out, expires, nil
+}
+
+// Redeem opens a ticket, checks its expiry and marks it used. A ticket is accepted at
+// most once; later attempts fail with ErrReused.
+func (k *Keyring) Redeem(ticket []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	k.retireLocked(now)
+
+	nonceSize := chacha20poly1305.NonceSizeX
+	if len(ticket) < keyIDSize+nonceSize+chacha20poly1305.Overhead+8+idSize {
+		return nil, ErrInvalid
+	}
+	var key *sealingKey
+	for i := range k.keys {
+		if string(k.keys[i].id[:]) == string(ticket[:keyIDSize]) {
+			key = &k.keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return nil, ErrInvalid
+	}
+
+	aead, err := chacha20poly1305.NewX(key.key)
+	if err != nil {
+		return nil, fmt.Errorf("ticket: init cipher: %w", err)
+	}
+	plaintext, err := aead.Open(nil, ticket[keyIDSize:keyIDSize+nonceSize], ticket[keyIDSize+nonceSize:], key.id[:])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	expires := time.Unix(int64(binary.BigEndian.Uint64(plaintext[:8])), 0)
+	if !now.Before(expires) {
+		return nil, ErrExpired
+	}
+	if err := k.redeemed.Insert(now, plaintext[8:8+idSize]); err != nil {
+		if errors.Is(err, replay.ErrDuplicate) {
+			return nil, ErrReused
+		}
+		if errors.Is(err, replay.ErrCacheFull) {
+			return nil, ErrCapacity
+		}
+		return nil, err
+	}
+	return plaintext[8+idSize:], nil
+}
+
+// rotateLocked installs a new current key and drops keys that can no longer open
+// unexpired tickets.
+func (k *Keyring) rotateLocked(now time.Time) error {
+	fresh := sealingKey{key: make([]byte, chacha20poly1305.KeySize), created: now}
+	if _, err := rand.Read(fresh.key); err != nil {
+		return fmt.Errorf("ticket: generate key: %w", err)
+	}
+	if _, err := rand.Read(fresh.id[:]); err != nil {
+		return fmt.Errorf("ticket: generate key id: %w", err)
+	}
+	k.keys = append([]sealingKey{fresh}, k.keys...)
+	k.retireLocked(now)
+	return nil
+}
+
+// retireLocked removes a key once every ticket it could have sealed has expired. A key
+// stops sealing when its successor is created, so its last ticket expires Lifetime later.
+func (k *Keyring) retireLocked(now time.Time) {
+	for i := 1; i < len(k.keys); i++ {
+		if now.Sub(k.keys[i-1].created) >= k.cfg.Lifetime {
+			k.keys = k.keys[:i]
+			return
+		}
+	}
+}
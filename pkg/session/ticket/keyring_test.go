@@ -0,0 +1,125 @@
+package ticket
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyringSealRedeem(t *testing.T) {
+	k, err := NewKeyring(Config{Lifetime: time.Hour, RotationInterval: 20 * time.Minute})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	k.now = func() time.Time { return now }
+
+	sealed, expires, err := k.Seal([]byte("resumption state"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry %s", expires)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err := k.Redeem(tampered); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid ticket, got %v", err)
+	}
+
+	payload, err := k.Redeem(sealed)
+	if err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	if !bytes.Equal(payload, []byte("resumption state")) {
+		t.Fatalf("unexpected payload %q", payload)
+	}
+	if _, err := k.Redeem(sealed); !errors.Is(err, ErrReused) {
+		t.Fatalf("expected reuse rejection, got %v", err)
+	}
+}
+
+func TestKeyringRotationAndExpiry(t *testing.T) {
+	k, err := NewKeyring(Config{Lifetime: time.Hour, RotationInterval: 20 * time.Minute})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	start := time.Now()
+	now := start
+	k.now = func() time.Time { return now }
+
+	early, _, err := k.Seal([]byte("early"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	expired, _, err := k.Seal([]byte("expired"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	// A ticket sealed under a rotated-out key still opens within its lifetime.
+	now = start.Add(30 * time.Minute)
+	if _, _, err := k.Seal([]byte("late")); err != nil {
+		t.Fatalf("seal after rotation: %v", err)
+	}
+	if len(k.keys) != 2 {
+		t.Fatalf("expected rotation to keep the previous key, have %d keys", len(k.keys))
+	}
+	if _, err := k.Redeem(early); err != nil {
+		t.Fatalf("redeem across rotation: %v", err)
+	}
+
+	now = start.Add(time.Hour + time.Second)
+	if _, err := k.Redeem(expired); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expiry, got %v", err)
+	}
+
+	// Once every ticket it sealed has expired, the old key is retired.
+	now = start.Add(2 * time.Hour)
+	if _, err := k.Redeem(expired); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected retired key, got %v", err)
+	}
+
+	if _, err := NewKeyring(Config{Lifetime: 48 * time.Hour}); err == nil {
+		t.Fatal("expected lifetime above maximum to be rejected")
+	}
+}
+
+func TestKeyringRedeemFailsClosedWhenFull(t *testing.T) {
+	k, err := NewKeyring(Config{Lifetime: time.Hour, Capacity: 2})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	k.now = func() time.Time { return now }
+
+	tickets := make([][]byte, 3)
+	for i := range tickets {
+		if tickets[i], _, err = k.Seal([]byte("state")); err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+	}
+	for _, ticket := range tickets[:2] {
+		if _, err := k.Redeem(ticket); err != nil {
+			t.Fatalf("redeem: %v", err)
+		}
+	}
+	if _, err := k.Redeem(tickets[2]); !errors.Is(err, ErrCapacity) {
+		t.Fatalf("expected full cache to refuse, got %v", err)
+	}
+	if _, err := k.Redeem(tickets[0]); !errors.Is(err, ErrReused) {
+		t.Fatalf("expected first ticket to stay redeemed, got %v", err)
+	}
+
+	// Once the earlier redemptions expire with their tickets, there is room again.
+	now = now.Add(time.Hour)
+	fresh, _, err := k.Seal([]byte("state"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if _, err := k.Redeem(fresh); err != nil {
+		t.Fatalf("redeem after expiry: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package transcript
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Version identifies the transcript encoding. It is folded into the domain label, so
+// peers that disagree on the encoding disagree on every transcript hash rather than on
+// some of them. See docs/transcript_encoding.md for the specification.
+const Version = 2
+
+// Marshaler is implemented by every value folded into a transcript.
+type Marshaler interface {
+	// MarshalTranscript writes the value's fields to e in ascending tag order.
+	MarshalTranscript(e *Encoder)
+}
+
+// Encoder builds the canonical binary form of a transcript entry: a sequence of fields,
+// each a one-byte tag, a four-byte big-endian length and the value. Tags must be written
+// in ascending order, and optional fields that are absent are omitted entirely.
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes writes an opaque byte string.
+func (e *Encoder) Bytes(tag uint8, v []byte) {
+	e.buf = append(e.buf, tag)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// String writes a UTF-8 string.
+func (e *Encoder) String(tag uint8, v string) {
+	e.Bytes(tag, []byte(v))
+}
+
+// Uint writes an unsigned integer as eight big-endian bytes.
+func (e *Encoder) Uint(tag uint8, v uint64) {
+	e.Bytes(tag, binary.BigEndian.AppendUint64(nil, v))
+}
+
+// Bool writes a single byte, 1 for true and 0 for false.
+func (e *Encoder) Bool(tag uint8, v bool) {
+	b := byte(0)
+	if v {
+		b = 1
+	}
+	e.Bytes(tag, []byte{b})
+}
+
+// Time writes t as eight bytes of signed Unix seconds followed by four bytes of
+// nanoseconds, both big-endian. Location and monotonic readings are ignored.
+func (e *Encoder) Time(tag uint8, t time.Time) {
+	v := binary.BigEndian.AppendUint64(nil, uint64(t.Unix()))
+	v = binary.BigEndian.AppendUint32(v, uint32(t.Nanosecond()))
+	e.Bytes(tag, v)
+}
+
+// Strings writes a list whose value is one tag-1 field per element, in order.
+func (e *Encoder) Strings(tag uint8, v []string) {
+	e.Nested(tag, func(n *Encoder) {
+		for _, s := range v {
+			n.String(1, s)
+		}
+	})
+}
+
+// Map writes a list with one tag-1 field per entry in ascending byte order of key, each
+// holding the key as tag 1 and the value as tag 2.
+func (e *Encoder) Map(tag uint8, v map[string]string) {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.Nested(tag, func(n *Encoder) {
+		for _, k := range keys {
+			n.Nested(1, func(p *Encoder) {
+				p.String(1, k)
+				p.String(2, v[k])
+			})
+		}
+	})
+}
+
+// Nested writes a field whose value is the encoding produced by fn.
+func (e *Encoder) Nested(tag uint8, fn func(*Encoder)) {
+	var n Encoder
+	fn(&n)
+	e.Bytes(tag, n.buf)
+}
+
+// Encode returns the canonical encoding of v.
+func Encode(v Marshaler) []byte {
+	var e Encoder
+	v.MarshalTranscript(&e)
+	if e.buf == nil {
+		return []byte{}
+	}
+	return e.buf
+}
+
+// Raw is a byte string folded into a transcript as a single tag-1 field, for entries
+// such as signatures that carry no further structure.
+type Raw []byte
+
+// MarshalTranscript implements Marshaler.
+func (r Raw) MarshalTranscript(e *Encoder) {
+	e.Bytes(1, r)
+}
+
+// ParseRaw extracts the byte string from the encoding of a Raw value.
+func ParseRaw(encoded []byte) (Raw, error) {
+	if len(encoded) < 5 || encoded[0] != 1 || int(binary.BigEndian.Uint32(encoded[1:5])) != len(encoded)-5 {
+		return nil, fmt.Errorf("transcript: malformed raw entry")
+	}
+	return Raw(encoded[5:]), nil
+}
@@ -0,0 +1,65 @@
+package transcript
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+type fields func(*Encoder)
+
+func (f fields) MarshalTranscript(e *Encoder) { f(e) }
+
+func TestEncoderFields(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   fields
+		want string
+	}{
+		{"bytes", func(e *Encoder) { e.Bytes(1, []byte{0xca, 0xfe}) }, "0100000002cafe"},
+		{"empty bytes", func(e *Encoder) { e.Bytes(7, nil) }, "0700000000"},
+		{"string", func(e *Encoder) { e.String(2, "hybrid") }, "0200000006687962726964"},
+		{"uint", func(e *Encoder) { e.Uint(3, 600) }, "03000000080000000000000258"},
+		{"bool", func(e *Encoder) { e.Bool(4, true); e.Bool(5, false) }, "040000000101" + "050000000100"},
+		{"time", func(e *Encoder) { e.Time(6, time.Unix(1_700_000_000, 5).In(time.FixedZone("x", 3600))) }, "060000000c000000006553f10000000005"},
+		{"strings", func(e *Encoder) { e.Strings(1, []string{"a", "bc"}) }, "010000000d" + "010000000161" + "01000000026263"},
+		{"map", func(e *Encoder) { e.Map(2, map[string]string{"z": "1", "a": ""}) }, "0200000021" +
+			"010000000b" + "010000000161" + "0200000000" +
+			"010000000c" + "01000000017a" + "020000000131"},
+		{"nested", func(e *Encoder) { e.Nested(9, func(n *Encoder) { n.String(1, "x") }) }, "0900000006010000000178"},
+		{"raw", Raw{0x01}.MarshalTranscript, "010000000101"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hex.EncodeToString(Encode(tc.fn)); got != tc.want {
+				t.Fatalf("encoding %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccumulatorSnapshot(t *testing.T) {
+	a := New("qsafe-test")
+	if err := a.Append("first", Raw("hello")); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := a.Append("second", fields(func(e *Encoder) { e.Uint(1, 1) })); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	// BLAKE3 over u32(len) || "qsafe-test/v2", then u32(len) || label || u32(len) ||
+	// encoding for each entry.
+	const want = "5604742df5212ef5a2e68a95a530200ffed2df06370f9d8e9e825810fc06bdbe"
+	if got := hex.EncodeToString(a.Snapshot()); got != want {
+		t.Fatalf("snapshot %s, want %s", got, want)
+	}
+
+	b := New("qsafe-other")
+	_ = b.Append("first", Raw("hello"))
+	_ = b.Append("second", fields(func(e *Encoder) { e.Uint(1, 1) }))
+	if hex.EncodeToString(b.Snapshot()) == want {
+		t.Fatal("domain does not separate transcripts")
+	}
+	if err := a.Append("", Raw(nil)); err == nil {
+		t.Fatal("expected empty label to be rejected")
+	}
+}
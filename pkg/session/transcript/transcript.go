@@ -1,67 +1,78 @@
 package transcript
 
 import (
-	"encoding/json"
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/zeebo/blake3"
 )
 
+// ErrRecordMismatch indicates a Record whose running hashes do not follow from its
+// encodings.
+var ErrRecordMismatch = errors.New("transcript: record does not match its encodings")
+
 // Accumulator incrementally records handshake artefacts into a domain-separated hash.
 type Accumulator struct {
 	mu     sync.Mutex
+	domain string
 	hasher *blake3.Hasher
-	logs   []entry
+	logs   []RecordEntry
+}
+
+// Record is a self-contained account of a transcript: everything that was hashed, in
+// order, with the commitment after each entry. It can be persisted and re-checked
+// without the parties that produced it.
+type Record struct {
+	Domain  string        `json:"domain"`
+	Version int           `json:"version"`
+	Entries []RecordEntry `json:"entries"`
 }
 
-type entry struct {
-	Label string
-	Data  json.RawMessage
+// RecordEntry is one appended value: its label, canonical encoding, and the transcript
+// snapshot taken immediately after it.
+type RecordEntry struct {
+	Label    string `json:"label"`
+	Encoding []byte `json:"encoding"`
+	Hash     []byte `json:"hash"`
 }
 
-// New constructs a fresh transcript accumulator.
+// New constructs a fresh transcript accumulator. The hash is seeded with the domain
+// qualified by the encoding version, e.g. "qsafe-handshake/v2".
 func New(domain string) *Accumulator {
 	h := blake3.New()
-	_, _ = h.Write([]byte("domain:"))
-	_, _ = h.Write([]byte(domain))
+	writeField(h, []byte(fmt.Sprintf("%s/v%d", domain, Version)))
 	return &Accumulator{
+		domain: domain,
 		hasher: h,
-		logs:   make([]entry, 0, 8),
+		logs:   make([]RecordEntry, 0, 8),
 	}
 }
 
-// Append serialises the provided value and folds it into the transcript hash.
-func (a *Accumulator) Append(label string, v any) error {
+// Append encodes the provided value and folds it into the transcript hash as the
+// length-prefixed label followed by the length-prefixed encoding.
+func (a *Accumulator) Append(label string, v Marshaler) error {
 	if label == "" {
 		return fmt.Errorf("transcript: label required")
 	}
-
-	serialized, err := json.Marshal(v)
-	if err != nil {
-		return fmt.Errorf("transcript: marshal %s: %w", label, err)
+	if v == nil {
+		return fmt.Errorf("transcript: %s: nil value", label)
 	}
+	a.appendEncoded(label, Encode(v))
+	return nil
+}
 
+func (a *Accumulator) appendEncoded(label string, encoded []byte) []byte {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if _, err := a.hasher.Write([]byte(label)); err != nil {
-		return fmt.Errorf("transcript: write label: %w", err)
-	}
-	length := uint64(len(serialized))
-	lenBuf := make([]byte, 8)
-	for i := uint(0); i < 8; i++ {
-		lenBuf[i] = byte(length >> (56 - 8*i))
-	}
-	if _, err := a.hasher.Write(lenBuf); err != nil {
-		return fmt.Errorf("transcript: write length: %w", err)
-	}
-	if _, err := a.hasher.Write(serialized); err != nil {
-		return fmt.Errorf("transcript: write body: %w", err)
-	}
-
-	a.logs = append(a.logs, entry{Label: label, Data: serialized})
-	return nil
+	writeField(a.hasher, []byte(label))
+	writeField(a.hasher, encoded)
+	hash := a.hasher.Clone().Sum(nil)
+	a.logs = append(a.logs, RecordEntry{Label: label, Encoding: encoded, Hash: hash})
+	return hash
 }
 
 // Snapshot returns the current transcript commitment.
@@ -72,13 +83,56 @@ func (a *Accumulator) Snapshot() []byte {
 	return append([]byte(nil), snapshot...)
 }
 
-// Entries exposes the recorded sequence for auditing.
+// Entries exposes the recorded sequence for auditing as label:hex(encoding).
+//
+// Deprecated: Use Record, which also carries the running hash after each entry.
 func (a *Accumulator) Entries() []string {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	out := make([]string, len(a.logs))
 	for i, e := range a.logs {
-		out[i] = fmt.Sprintf("%s:%s", e.Label, string(e.Data))
+		out[i] = fmt.Sprintf("%s:%x", e.Label, e.Encoding)
 	}
 	return out
 }
+
+// Record exports the recorded sequence for auditing.
+func (a *Accumulator) Record() Record {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries := make([]RecordEntry, len(a.logs))
+	for i, e := range a.logs {
+		entries[i] = RecordEntry{
+			Label:    e.Label,
+			Encoding: append([]byte(nil), e.Encoding...),
+			Hash:     append([]byte(nil), e.Hash...),
+		}
+	}
+	return Record{Domain: a.domain, Version: Version, Entries: entries}
+}
+
+// Recompute rebuilds the transcript from the record's encodings, checks every running
+// hash, and returns the final commitment. It trusts nothing in the record but the
+// encodings themselves.
+func (r Record) Recompute() ([]byte, error) {
+	if r.Version != Version {
+		return nil, fmt.Errorf("%w: encoding v%d, expected v%d", ErrRecordMismatch, r.Version, Version)
+	}
+	a := New(r.Domain)
+	for i, e := range r.Entries {
+		if e.Label == "" {
+			return nil, fmt.Errorf("%w: entry %d has no label", ErrRecordMismatch, i)
+		}
+		if hash := a.appendEncoded(e.Label, e.Encoding); !bytes.Equal(hash, e.Hash) {
+			return nil, fmt.Errorf("%w: hash after entry %d (%s)", ErrRecordMismatch, i, e.Label)
+		}
+	}
+	return a.Snapshot(), nil
+}
+
+func writeField(h *blake3.Hasher, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	_, _ = h.Write(length[:])
+	_, _ = h.Write(data)
+}
@@ -0,0 +1,47 @@
+package transcript
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRecordRecompute(t *testing.T) {
+	a := New("qsafe-test")
+	_ = a.Append("first", Raw("hello"))
+	_ = a.Append("second", Raw("world"))
+
+	rec := a.Record()
+	if rec.Domain != "qsafe-test" || rec.Version != Version || len(rec.Entries) != 2 {
+		t.Fatalf("unexpected record header: %+v", rec)
+	}
+	got, err := rec.Recompute()
+	if err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	if !bytes.Equal(got, a.Snapshot()) || !bytes.Equal(got, rec.Entries[1].Hash) {
+		t.Fatal("recomputed hash differs from snapshot")
+	}
+	if raw, err := ParseRaw(rec.Entries[0].Encoding); err != nil || string(raw) != "hello" {
+		t.Fatalf("parse raw: %q, %v", raw, err)
+	}
+	if entries := a.Entries(); len(entries) != 2 || entries[1] != fmt.Sprintf("second:%x", rec.Entries[1].Encoding) {
+		t.Fatalf("unexpected entries %q", entries)
+	}
+
+	tampered := a.Record()
+	tampered.Entries[0].Encoding[len(tampered.Entries[0].Encoding)-1] ^= 0x01
+	if _, err := tampered.Recompute(); !errors.Is(err, ErrRecordMismatch) {
+		t.Fatalf("expected tampered encoding to be detected, got %v", err)
+	}
+	relabelled := a.Record()
+	relabelled.Domain = "qsafe-other"
+	if _, err := relabelled.Recompute(); !errors.Is(err, ErrRecordMismatch) {
+		t.Fatalf("expected changed domain to be detected, got %v", err)
+	}
+	// Records are copies; mutating one must not disturb the accumulator.
+	if _, err := a.Record().Recompute(); err != nil {
+		t.Fatalf("accumulator record altered by caller: %v", err)
+	}
+}